@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"pos-backend/internal/config"
 	"pos-backend/internal/database"
@@ -21,18 +23,62 @@ func main() {
 	}
 	defer db.Close()
 
+	pricing := repositories.PricingConfig{
+		TaxRate:            cfg.TaxRate,
+		AllowNegativeStock: cfg.AllowNegativeStock,
+		CashRounding: repositories.CashRounding{
+			Increment: cfg.CashRoundingIncrement,
+			Mode:      cfg.CashRoundingMode,
+		},
+	}
+	receipts := repositories.ReceiptConfig{
+		Prefix:      cfg.ReceiptPrefix,
+		StoreCode:   cfg.StoreCode,
+		Scope:       cfg.ReceiptScope,
+		YearlyReset: cfg.ReceiptYearlyReset,
+	}
+	layawayPolicy := repositories.LayawayPolicy{
+		MinDepositPercent: cfg.LayawayMinDepositPercent,
+		DefaultTerm:       cfg.LayawayTerm,
+		ForfeitPercent:    cfg.LayawayForfeitPercent,
+		ForfeitFlatFee:    cfg.LayawayForfeitFee,
+	}
+
 	productRepo := repositories.NewProductRepository(db)
-	saleRepo := repositories.NewSaleRepository(db)
+	saleRepo := repositories.NewSaleRepository(db, pricing, receipts)
 	userRepo := repositories.NewUserRepository(db)
 	reportRepo := repositories.NewReportRepository(db)
+	parkedSaleRepo := repositories.NewParkedSaleRepository(db)
+	shiftRepo := repositories.NewShiftRepository(db)
+	layawayRepo := repositories.NewLayawayRepository(db, pricing, receipts, layawayPolicy)
+	categoryRepo := repositories.NewCategoryRepository(db)
+	unitRepo := repositories.NewUnitRepository(db)
 
 	productHandler := handlers.NewProductHandler(productRepo)
-	saleHandler := handlers.NewSaleHandler(saleRepo)
+	saleHandler := handlers.NewSaleHandler(saleRepo, cfg.JWTSecret)
 	authHandler := handlers.NewAuthHandler(userRepo, cfg.JWTSecret)
 	userHandler := handlers.NewUserHandler(userRepo, cfg.JWTSecret)
 	reportHandler := handlers.NewReportHandler(reportRepo)
+	parkedSaleHandler := handlers.NewParkedSaleHandler(parkedSaleRepo, cfg.ParkedSaleTTL)
+	shiftHandler := handlers.NewShiftHandler(shiftRepo, cfg.JWTSecret)
+	layawayHandler := handlers.NewLayawayHandler(layawayRepo, cfg.JWTSecret)
+	categoryHandler := handlers.NewCategoryHandler(categoryRepo)
+	unitHandler := handlers.NewUnitHandler(unitRepo)
+
+	r := router.NewRouter(
+		productHandler,
+		saleHandler,
+		authHandler,
+		userHandler,
+		reportHandler,
+		parkedSaleHandler,
+		shiftHandler,
+		layawayHandler,
+		categoryHandler,
+		unitHandler,
+	)
 
-	r := router.NewRouter(productHandler, saleHandler, authHandler, userHandler, reportHandler)
+	go applyPriceChanges(productRepo, cfg.PriceChangeInterval)
 
 	addr := fmt.Sprintf(":%s", cfg.Port)
 	log.Printf("Server listening on %s ...", addr)
@@ -41,3 +87,20 @@ func main() {
 		log.Fatalf("server error: %v", err)
 	}
 }
+
+// applyPriceChanges puts scheduled prices into effect as they come due,
+// starting with any that fell due while the server was down.
+func applyPriceChanges(repo *repositories.ProductRepository, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := repo.ApplyDuePriceChanges(context.Background(), time.Now().UTC())
+		if err != nil {
+			log.Printf("apply price changes: %v", err)
+		} else if n > 0 {
+			log.Printf("applied %d scheduled price changes", n)
+		}
+		<-ticker.C
+	}
+}
@@ -8,16 +8,18 @@ import (
 )
 
 type Claims struct {
-	UserID int64  `json:"user_id"`
-	Role   string `json:"role"`
+	UserID     int64  `json:"user_id"`
+	Role       string `json:"role"`
+	TerminalID string `json:"terminal_id,omitempty"` // till the session signed in on
 	jwt.RegisteredClaims
 }
 
-func GenerateToken(userID int64, role, secret string, ttl time.Duration) (string, error) {
+func GenerateToken(userID int64, role, terminalID, secret string, ttl time.Duration) (string, error) {
 	now := time.Now()
 	claims := &Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:     userID,
+		Role:       role,
+		TerminalID: terminalID,
 		RegisteredClaims: jwt.RegisteredClaims{
 			IssuedAt:  jwt.NewNumericDate(now),
 			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
@@ -0,0 +1,212 @@
+// Package barcode validates product barcodes and normalizes scanner input.
+package barcode
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	EAN13   = "ean13"
+	EAN8    = "ean8"
+	UPCA    = "upca"
+	Code128 = "code128"
+)
+
+// maxCode128Length is a practical limit for a printed Code 128 label.
+const maxCode128Length = 48
+
+var (
+	ErrInvalid       = errors.New("invalid barcode")
+	ErrInvalidLayout = errors.New("invalid barcode layout")
+)
+
+// Normalize cleans up a code as it arrives from a scanner: surrounding
+// whitespace and the line terminator are dropped, as is an AIM symbology
+// identifier such as "]E0" that some scanners prefix.
+func Normalize(code string) string {
+	code = strings.TrimSpace(code)
+	if len(code) > 3 && code[0] == ']' {
+		code = code[3:]
+	}
+	return code
+}
+
+// Detect guesses the symbology of a code typed in without one: 13 and 12
+// digits are EAN-13 and UPC-A, anything else is Code 128. EAN-8 must be
+// given explicitly since eight-digit internal codes are common.
+func Detect(code string) string {
+	if isDigits(code) {
+		switch len(code) {
+		case 13:
+			return EAN13
+		case 12:
+			return UPCA
+		}
+	}
+	return Code128
+}
+
+// Validate checks the length, characters and check digit of code. Code 128
+// check characters are not part of the scanned data, so only its
+// characters and length are checked.
+func Validate(code, symbology string) error {
+	if code == "" {
+		return fmt.Errorf("%w: code is empty", ErrInvalid)
+	}
+
+	switch symbology {
+	case EAN13:
+		return validateGTIN(code, 13, "EAN-13")
+	case EAN8:
+		return validateGTIN(code, 8, "EAN-8")
+	case UPCA:
+		return validateGTIN(code, 12, "UPC-A")
+	case Code128:
+		if len(code) > maxCode128Length {
+			return fmt.Errorf("%w: Code 128 is limited to %d characters", ErrInvalid, maxCode128Length)
+		}
+		for _, c := range code {
+			if c < 0x20 || c > 0x7e {
+				return fmt.Errorf("%w: Code 128 only takes printable ASCII", ErrInvalid)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%w: unknown symbology %q", ErrInvalid, symbology)
+	}
+}
+
+func validateGTIN(code string, length int, name string) error {
+	if len(code) != length || !isDigits(code) {
+		return fmt.Errorf("%w: %s needs %d digits", ErrInvalid, name, length)
+	}
+	if want := CheckDigit(code[:length-1]); code[length-1] != want {
+		return fmt.Errorf("%w: %s check digit should be %c", ErrInvalid, name, want)
+	}
+	return nil
+}
+
+// CheckDigit computes the GS1 mod-10 check digit for the digits before it.
+func CheckDigit(digits string) byte {
+	sum := 0
+	// weights alternate 3, 1 starting from the digit next to the check digit
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
+
+// LookupKey is the form a code is indexed under. GTINs are zero-padded to
+// 14 digits so a UPC-A and the EAN-13 it is printed as find each other.
+func LookupKey(code, symbology string) string {
+	switch symbology {
+	case EAN13, EAN8, UPCA:
+		return strings.Repeat("0", 14-len(code)) + code
+	}
+	return code
+}
+
+// LookupKeys returns the keys a scanned code may be stored under: the code
+// as a Code 128 value and, when it is a valid GTIN, its padded form.
+func LookupKeys(code string) []string {
+	keys := []string{code}
+	if isDigits(code) {
+		switch len(code) {
+		case 8, 12, 13, 14:
+			if CheckDigit(code[:len(code)-1]) == code[len(code)-1] {
+				keys = append(keys, strings.Repeat("0", 14-len(code))+code)
+			}
+		}
+	}
+	return keys
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+const (
+	ValueWeight = "weight" // kilograms
+	ValuePrice  = "price"
+)
+
+// EmbeddedLayout describes an in-store EAN-13 (prefix 20-29, or 02 for a
+// UPC-A) that carries a PLU right after the prefix and a weight or price
+// just before the check digit. Digits in between, such as a price check
+// digit, are ignored.
+type EmbeddedLayout struct {
+	Prefix        string
+	PLULength     int
+	ValueKind     string // ValueWeight or ValuePrice
+	ValueLength   int
+	ValueDecimals int // e.g. 3 for grams in a weight, 2 for cents in a price
+}
+
+// Validate reports a layout that cannot describe an EAN-13. Its errors wrap
+// ErrInvalidLayout.
+func (l EmbeddedLayout) Validate() error {
+	if l.Prefix == "" || len(l.Prefix) > 3 || !isDigits(l.Prefix) {
+		return fmt.Errorf("%w: prefix must be 1 to 3 digits", ErrInvalidLayout)
+	}
+	if l.ValueKind != ValueWeight && l.ValueKind != ValuePrice {
+		return fmt.Errorf("%w: value kind must be %q or %q", ErrInvalidLayout, ValueWeight, ValuePrice)
+	}
+	if l.PLULength < 1 || l.ValueLength < 1 {
+		return fmt.Errorf("%w: PLU and value need at least one digit", ErrInvalidLayout)
+	}
+	if len(l.Prefix)+l.PLULength+l.ValueLength > 12 {
+		return fmt.Errorf("%w: prefix, PLU and value do not fit in 12 digits", ErrInvalidLayout)
+	}
+	if l.ValueDecimals < 0 || l.ValueDecimals > l.ValueLength {
+		return fmt.Errorf("%w: value decimals must be between 0 and the value length", ErrInvalidLayout)
+	}
+	return nil
+}
+
+// Parse extracts the PLU and the embedded value from code. ok is false when
+// the code is not a valid EAN-13 or UPC-A with this layout's prefix.
+func (l EmbeddedLayout) Parse(code string) (plu string, value float64, ok bool) {
+	if len(code) == 12 {
+		code = "0" + code
+	}
+	if len(code) != 13 || !isDigits(code) || !strings.HasPrefix(code, l.Prefix) {
+		return "", 0, false
+	}
+	if CheckDigit(code[:12]) != code[12] {
+		return "", 0, false
+	}
+
+	plu = code[len(l.Prefix) : len(l.Prefix)+l.PLULength]
+
+	var raw int64
+	for i := 12 - l.ValueLength; i < 12; i++ {
+		raw = raw*10 + int64(code[i]-'0')
+	}
+	value = float64(raw) / math.Pow10(l.ValueDecimals)
+
+	return NormalizePLU(plu), value, true
+}
+
+// NormalizePLU drops leading zeros so "00123" on a label finds PLU 123.
+func NormalizePLU(plu string) string {
+	plu = strings.TrimLeft(strings.TrimSpace(plu), "0")
+	if plu == "" {
+		return "0"
+	}
+	return plu
+}
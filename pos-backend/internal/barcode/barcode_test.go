@@ -0,0 +1,227 @@
+package barcode
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{"400638133393", '1'}, // EAN-13
+		{"03600029145", '2'},  // UPC-A
+		{"9638507", '4'},      // EAN-8
+		{"0000000000000", '0'},
+		{"590123412345", '7'},
+	}
+
+	for _, tt := range tests {
+		if got := CheckDigit(tt.digits); got != tt.want {
+			t.Errorf("CheckDigit(%q) = %c, want %c", tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name      string
+		code      string
+		symbology string
+		wantErr   bool
+	}{
+		{"ean13", "4006381333931", EAN13, false},
+		{"ean13 bad check digit", "4006381333932", EAN13, true},
+		{"ean13 too short", "400638133393", EAN13, true},
+		{"ean13 letters", "40063813339A1", EAN13, true},
+		{"ean8", "96385074", EAN8, false},
+		{"ean8 bad check digit", "96385075", EAN8, true},
+		{"upca", "036000291452", UPCA, false},
+		{"upca bad check digit", "036000291453", UPCA, true},
+		{"code128", "ABC-123 x", Code128, false},
+		{"code128 control character", "ABC\t123", Code128, true},
+		{"code128 too long", "0123456789012345678901234567890123456789012345678", Code128, true},
+		{"empty", "", EAN13, true},
+		{"unknown symbology", "123", "qr", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.code, tt.symbology)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate(%q, %q) = %v, want error %v", tt.code, tt.symbology, err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalid) {
+				t.Errorf("error %v does not wrap ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"4006381333931", EAN13},
+		{"036000291452", UPCA},
+		{"96385074", Code128}, // EAN-8 must be given explicitly
+		{"ABC123", Code128},
+		{"12345678901234", Code128},
+	}
+
+	for _, tt := range tests {
+		if got := Detect(tt.code); got != tt.want {
+			t.Errorf("Detect(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{"4006381333931\r\n", "4006381333931"},
+		{"  ABC ", "ABC"},
+		{"]E04006381333931", "4006381333931"},
+		{"]C1", "]C1"},
+	}
+
+	for _, tt := range tests {
+		if got := Normalize(tt.code); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestLookupKey(t *testing.T) {
+	tests := []struct {
+		code      string
+		symbology string
+		want      string
+	}{
+		{"4006381333931", EAN13, "04006381333931"},
+		{"036000291452", UPCA, "00036000291452"},
+		{"96385074", EAN8, "00000096385074"},
+		{"ABC123", Code128, "ABC123"},
+		{"036000291452", Code128, "036000291452"},
+	}
+
+	for _, tt := range tests {
+		if got := LookupKey(tt.code, tt.symbology); got != tt.want {
+			t.Errorf("LookupKey(%q, %q) = %q, want %q", tt.code, tt.symbology, got, tt.want)
+		}
+	}
+}
+
+func TestLookupKeys(t *testing.T) {
+	tests := []struct {
+		code string
+		want []string
+	}{
+		// a UPC-A and the EAN-13 it is printed as share a padded key
+		{"036000291452", []string{"036000291452", "00036000291452"}},
+		{"0036000291452", []string{"0036000291452", "00036000291452"}},
+		{"96385074", []string{"96385074", "00000096385074"}},
+		{"4006381333932", []string{"4006381333932"}}, // bad check digit
+		{"ABC123", []string{"ABC123"}},
+	}
+
+	for _, tt := range tests {
+		if got := LookupKeys(tt.code); !slices.Equal(got, tt.want) {
+			t.Errorf("LookupKeys(%q) = %q, want %q", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizePLU(t *testing.T) {
+	tests := []struct {
+		plu  string
+		want string
+	}{
+		{"00123", "123"},
+		{" 42 ", "42"},
+		{"0000", "0"},
+		{"", "0"},
+	}
+
+	for _, tt := range tests {
+		if got := NormalizePLU(tt.plu); got != tt.want {
+			t.Errorf("NormalizePLU(%q) = %q, want %q", tt.plu, got, tt.want)
+		}
+	}
+}
+
+func TestEmbeddedLayoutValidate(t *testing.T) {
+	valid := EmbeddedLayout{Prefix: "2", PLULength: 5, ValueKind: ValueWeight, ValueLength: 5, ValueDecimals: 3}
+
+	tests := []struct {
+		name    string
+		change  func(l *EmbeddedLayout)
+		wantErr bool
+	}{
+		{"valid", func(l *EmbeddedLayout) {}, false},
+		{"price", func(l *EmbeddedLayout) { l.ValueKind, l.ValueDecimals = ValuePrice, 2 }, false},
+		{"empty prefix", func(l *EmbeddedLayout) { l.Prefix = "" }, true},
+		{"long prefix", func(l *EmbeddedLayout) { l.Prefix = "2001" }, true},
+		{"letter prefix", func(l *EmbeddedLayout) { l.Prefix = "2A" }, true},
+		{"unknown value kind", func(l *EmbeddedLayout) { l.ValueKind = "count" }, true},
+		{"no PLU", func(l *EmbeddedLayout) { l.PLULength = 0 }, true},
+		{"no value", func(l *EmbeddedLayout) { l.ValueLength, l.ValueDecimals = 0, 0 }, true},
+		{"does not fit", func(l *EmbeddedLayout) { l.PLULength = 7 }, true},
+		{"negative decimals", func(l *EmbeddedLayout) { l.ValueDecimals = -1 }, true},
+		{"more decimals than digits", func(l *EmbeddedLayout) { l.ValueDecimals = 6 }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := valid
+			tt.change(&l)
+			err := l.Validate()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() = %v, want error %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrInvalidLayout) {
+				t.Errorf("error %v does not wrap ErrInvalidLayout", err)
+			}
+		})
+	}
+}
+
+func TestEmbeddedLayoutParse(t *testing.T) {
+	weight := EmbeddedLayout{Prefix: "2", PLULength: 5, ValueKind: ValueWeight, ValueLength: 5, ValueDecimals: 3}
+	price := EmbeddedLayout{Prefix: "02", PLULength: 5, ValueKind: ValuePrice, ValueLength: 4, ValueDecimals: 2}
+
+	// withCheck appends the check digit to the first 12 digits of a label
+	withCheck := func(digits string) string { return digits + string(CheckDigit(digits)) }
+
+	tests := []struct {
+		name   string
+		layout EmbeddedLayout
+		code   string
+		plu    string
+		value  float64
+		ok     bool
+	}{
+		{"weight", weight, withCheck("200123001500"), "123", 1.5, true},
+		{"weight ignores the digit between PLU and value", weight, withCheck("200123901500"), "123", 1.5, true},
+		{"price on a UPC-A", price, withCheck("021234500399")[1:], "12345", 3.99, true},
+		{"price on its EAN-13 form", price, withCheck("021234500399"), "12345", 3.99, true},
+		{"other prefix", weight, "4006381333931", "", 0, false},
+		{"bad check digit", weight, "2001230015001", "", 0, false},
+		{"too short", weight, "20012300150", "", 0, false},
+		{"letters", weight, "20012A0015003", "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plu, value, ok := tt.layout.Parse(tt.code)
+			if ok != tt.ok || plu != tt.plu || value != tt.value {
+				t.Errorf("Parse(%q) = %q, %v, %v; want %q, %v, %v", tt.code, plu, value, ok, tt.plu, tt.value, tt.ok)
+			}
+		})
+	}
+}
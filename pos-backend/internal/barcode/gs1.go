@@ -0,0 +1,255 @@
+package barcode
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// groupSeparator is FNC1 as scanners transmit it inside a GS1 element
+// string, ending a variable-length field.
+const groupSeparator = '\x1d'
+
+// GS1 holds the application identifiers (AIs) a POS cares about from a
+// GS1-128, GS1 DataBar or GS1 DataMatrix element string.
+type GS1 struct {
+	GTIN       string     // AI 01
+	Lot        string     // AI 10
+	Serial     string     // AI 21
+	Expiry     *time.Time // AI 17
+	BestBefore *time.Time // AI 15
+	NetWeight  *float64   // AI 310n, kilograms
+	Price      *float64   // AI 392n, amount payable in local currency
+
+	// Elements holds every AI read, including the ones above.
+	Elements map[string]string
+	order    []string
+}
+
+// aiSpec gives the data length of an AI; variable-length AIs end at a
+// group separator or the end of the input.
+type aiSpec struct {
+	length   int
+	variable bool
+}
+
+// gs1AIs lists the supported AIs by their two-digit start. The 3x and 39x
+// families carry a decimal-point digit as the fourth AI digit.
+var gs1AIs = map[string]struct {
+	aiLength int
+	spec     aiSpec
+}{
+	"00": {2, aiSpec{length: 18}},
+	"01": {2, aiSpec{length: 14}},
+	"02": {2, aiSpec{length: 14}},
+	"10": {2, aiSpec{length: 20, variable: true}},
+	"11": {2, aiSpec{length: 6}},
+	"13": {2, aiSpec{length: 6}},
+	"15": {2, aiSpec{length: 6}},
+	"16": {2, aiSpec{length: 6}},
+	"17": {2, aiSpec{length: 6}},
+	"21": {2, aiSpec{length: 20, variable: true}},
+	"30": {2, aiSpec{length: 8, variable: true}},
+	"31": {4, aiSpec{length: 6}},
+	"32": {4, aiSpec{length: 6}},
+	"37": {2, aiSpec{length: 8, variable: true}},
+	"39": {4, aiSpec{length: 15, variable: true}},
+}
+
+// IsGS1 reports whether raw scanner input looks like a GS1 element string:
+// it carries a GS1 symbology identifier, uses the human-readable "(01)"
+// form, or starts with a GTIN followed by more data.
+func IsGS1(raw string) bool {
+	raw = strings.TrimSpace(raw)
+	for _, id := range []string{"]C1", "]e0", "]d2", "]Q3"} {
+		if strings.HasPrefix(raw, id) {
+			return true
+		}
+	}
+	if strings.HasPrefix(raw, "(") {
+		return true
+	}
+	return len(raw) > 16 && strings.HasPrefix(raw, "01") && isDigits(raw[2:16])
+}
+
+// ParseGS1 decodes an element string as sent by a scanner, with or without
+// its symbology identifier, or in the "(01)…(17)…" form printed under the
+// bars.
+func ParseGS1(raw string) (*GS1, error) {
+	s := strings.TrimSpace(raw)
+	if len(s) > 3 && s[0] == ']' {
+		s = s[3:]
+	}
+	s = strings.TrimPrefix(s, string(groupSeparator))
+
+	g := &GS1{Elements: make(map[string]string)}
+
+	if strings.HasPrefix(s, "(") {
+		if err := g.parseBracketed(s); err != nil {
+			return nil, err
+		}
+	} else if err := g.parseRaw(s); err != nil {
+		return nil, err
+	}
+
+	if len(g.order) == 0 {
+		return nil, fmt.Errorf("%w: no GS1 data", ErrInvalid)
+	}
+	if err := g.interpret(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func (g *GS1) parseBracketed(s string) error {
+	for s != "" {
+		if s[0] != '(' {
+			return fmt.Errorf("%w: expected '(' before an AI", ErrInvalid)
+		}
+		end := strings.IndexByte(s, ')')
+		if end < 0 {
+			return fmt.Errorf("%w: unterminated AI", ErrInvalid)
+		}
+		ai := s[1:end]
+		s = s[end+1:]
+
+		next := strings.IndexByte(s, '(')
+		if next < 0 {
+			next = len(s)
+		}
+		if err := g.add(ai, s[:next]); err != nil {
+			return err
+		}
+		s = s[next:]
+	}
+	return nil
+}
+
+func (g *GS1) parseRaw(s string) error {
+	for s != "" {
+		if len(s) < 2 {
+			return fmt.Errorf("%w: truncated AI", ErrInvalid)
+		}
+		def, ok := gs1AIs[s[:2]]
+		if !ok || len(s) < def.aiLength {
+			return fmt.Errorf("%w: unsupported AI %q", ErrInvalid, s[:min(len(s), 4)])
+		}
+		ai := s[:def.aiLength]
+		s = s[def.aiLength:]
+
+		n := def.spec.length
+		if def.spec.variable {
+			if sep := strings.IndexByte(s, groupSeparator); sep >= 0 && sep < n {
+				n = sep
+			}
+		}
+		n = min(n, len(s))
+
+		if err := g.add(ai, s[:n]); err != nil {
+			return err
+		}
+		s = strings.TrimPrefix(s[n:], string(groupSeparator))
+	}
+	return nil
+}
+
+// add checks value against the AI's length rules and records it.
+func (g *GS1) add(ai, value string) error {
+	def, ok := gs1AIs[ai[:min(len(ai), 2)]]
+	if !ok || len(ai) != def.aiLength || !isDigits(ai) {
+		return fmt.Errorf("%w: unsupported AI %q", ErrInvalid, ai)
+	}
+	if def.spec.variable {
+		if value == "" || len(value) > def.spec.length {
+			return fmt.Errorf("%w: AI %s takes 1 to %d characters", ErrInvalid, ai, def.spec.length)
+		}
+	} else if len(value) != def.spec.length {
+		return fmt.Errorf("%w: AI %s takes %d characters", ErrInvalid, ai, def.spec.length)
+	}
+	if _, dup := g.Elements[ai]; dup {
+		return fmt.Errorf("%w: AI %s appears twice", ErrInvalid, ai)
+	}
+
+	g.Elements[ai] = value
+	g.order = append(g.order, ai)
+	return nil
+}
+
+// interpret fills the typed fields from the elements.
+func (g *GS1) interpret() error {
+	for _, ai := range g.order {
+		v := g.Elements[ai]
+		var err error
+
+		switch {
+		case ai == "01":
+			if !isDigits(v) || CheckDigit(v[:13]) != v[13] {
+				return fmt.Errorf("%w: GTIN check digit is wrong", ErrInvalid)
+			}
+			g.GTIN = v
+		case ai == "10":
+			g.Lot = v
+		case ai == "21":
+			g.Serial = v
+		case ai == "17":
+			g.Expiry, err = gs1Date(v)
+		case ai == "15":
+			g.BestBefore, err = gs1Date(v)
+		case strings.HasPrefix(ai, "310"):
+			g.NetWeight, err = gs1Decimal(v, ai[3])
+		case strings.HasPrefix(ai, "392"):
+			g.Price, err = gs1Decimal(v, ai[3])
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: AI %s: %v", ErrInvalid, ai, err)
+		}
+	}
+	return nil
+}
+
+// String renders the elements in the human-readable "(01)…(10)…" form,
+// which is how scanned GS1 codes are stored.
+func (g *GS1) String() string {
+	var b strings.Builder
+	for _, ai := range g.order {
+		b.WriteString("(" + ai + ")" + g.Elements[ai])
+	}
+	return b.String()
+}
+
+// gs1Date reads YYMMDD. Years are taken as 20YY; a day of 00 means the
+// last day of the month.
+func gs1Date(v string) (*time.Time, error) {
+	if !isDigits(v) {
+		return nil, fmt.Errorf("date must be YYMMDD")
+	}
+	year, _ := strconv.Atoi(v[0:2])
+	month, _ := strconv.Atoi(v[2:4])
+	day, _ := strconv.Atoi(v[4:6])
+	if month < 1 || month > 12 {
+		return nil, fmt.Errorf("month %02d is out of range", month)
+	}
+
+	t := time.Date(2000+year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+	if day == 0 {
+		t = time.Date(2000+year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC)
+	} else if t.Day() != day {
+		return nil, fmt.Errorf("day %02d is out of range", day)
+	}
+	return &t, nil
+}
+
+func gs1Decimal(v string, decimals byte) (*float64, error) {
+	if !isDigits(v) {
+		return nil, fmt.Errorf("value must be digits")
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	f := float64(n) / math.Pow10(int(decimals-'0'))
+	return &f, nil
+}
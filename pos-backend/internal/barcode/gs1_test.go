@@ -0,0 +1,156 @@
+package barcode
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestIsGS1(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want bool
+	}{
+		{"]C101040063813339311017", true},
+		{"]d201040063813339311017", true},
+		{"(01)04006381333931(10)ABC", true},
+		{"0104006381333931" + "10ABC", true},
+		{"0104006381333931", false}, // a bare GTIN-14
+		{"4006381333931", false},
+		{"ABC123", false},
+	}
+
+	for _, tt := range tests {
+		if got := IsGS1(tt.raw); got != tt.want {
+			t.Errorf("IsGS1(%q) = %v, want %v", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParseGS1(t *testing.T) {
+	tests := []struct {
+		name       string
+		raw        string
+		gtin       string
+		lot        string
+		serial     string
+		expiry     string
+		bestBefore string
+		weight     float64
+		price      float64
+		str        string
+	}{
+		{
+			name:   "bracketed",
+			raw:    "(01)04006381333931(17)261231(10)LOT42",
+			gtin:   "04006381333931",
+			lot:    "LOT42",
+			expiry: "2026-12-31",
+			str:    "(01)04006381333931(17)261231(10)LOT42",
+		},
+		{
+			name:   "raw with symbology identifier and FNC1",
+			raw:    "]C10104006381333931" + "10LOT42\x1d" + "21SN7" + "\x1d17261231",
+			gtin:   "04006381333931",
+			lot:    "LOT42",
+			serial: "SN7",
+			expiry: "2026-12-31",
+			str:    "(01)04006381333931(10)LOT42(21)SN7(17)261231",
+		},
+		{
+			name:   "weight and price",
+			raw:    "0104006381333931" + "3103001250" + "3922000599",
+			gtin:   "04006381333931",
+			weight: 1.25,
+			price:  5.99,
+			str:    "(01)04006381333931(3103)001250(3922)000599",
+		},
+		{
+			name:       "day 00 is the end of the month",
+			raw:        "(01)04006381333931(15)260200",
+			gtin:       "04006381333931",
+			bestBefore: "2026-02-28",
+			str:        "(01)04006381333931(15)260200",
+		},
+		{
+			name: "lot at the end needs no separator",
+			raw:  "0104006381333931" + "10ABC",
+			gtin: "04006381333931",
+			lot:  "ABC",
+			str:  "(01)04006381333931(10)ABC",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := ParseGS1(tt.raw)
+			if err != nil {
+				t.Fatalf("ParseGS1(%q): %v", tt.raw, err)
+			}
+			if g.GTIN != tt.gtin || g.Lot != tt.lot || g.Serial != tt.serial {
+				t.Errorf("GTIN, lot, serial = %q, %q, %q; want %q, %q, %q", g.GTIN, g.Lot, g.Serial, tt.gtin, tt.lot, tt.serial)
+			}
+			if got := formatDate(g.Expiry); got != tt.expiry {
+				t.Errorf("expiry = %q, want %q", got, tt.expiry)
+			}
+			if got := formatDate(g.BestBefore); got != tt.bestBefore {
+				t.Errorf("best before = %q, want %q", got, tt.bestBefore)
+			}
+			if got := valueOf(g.NetWeight); got != tt.weight {
+				t.Errorf("weight = %v, want %v", got, tt.weight)
+			}
+			if got := valueOf(g.Price); got != tt.price {
+				t.Errorf("price = %v, want %v", got, tt.price)
+			}
+			if got := g.String(); got != tt.str {
+				t.Errorf("String() = %q, want %q", got, tt.str)
+			}
+		})
+	}
+}
+
+func TestParseGS1Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+	}{
+		{"empty", ""},
+		{"bad GTIN check digit", "(01)04006381333932"},
+		{"short GTIN", "(01)0400638133393"},
+		{"unsupported AI", "(99)ABC"},
+		{"unterminated AI", "(01"},
+		{"text before an AI", "X(01)04006381333931"},
+		{"repeated AI", "(01)04006381333931(10)A(10)B"},
+		{"month out of range", "(01)04006381333931(17)261301"},
+		{"day out of range", "(01)04006381333931(17)260230"},
+		{"weight with letters", "(01)04006381333931(3103)0012A0"},
+		{"lot too long", "(01)04006381333931(10)ABCDEFGHIJKLMNOPQRSTU"},
+		{"truncated AI", "01040063813339311"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g, err := ParseGS1(tt.raw)
+			if err == nil {
+				t.Fatalf("ParseGS1(%q) = %v, want an error", tt.raw, g)
+			}
+			if !errors.Is(err, ErrInvalid) {
+				t.Errorf("error %v does not wrap ErrInvalid", err)
+			}
+		})
+	}
+}
+
+func formatDate(d *time.Time) string {
+	if d == nil {
+		return ""
+	}
+	return d.Format("2006-01-02")
+}
+
+func valueOf(v *float64) float64 {
+	if v == nil {
+		return 0
+	}
+	return *v
+}
@@ -1,11 +1,50 @@
 package config
 
-import "os"
+import (
+	"os"
+	"strconv"
+	"time"
+)
 
 type Config struct {
 	DBPath    string
 	Port      string
 	JWTSecret string
+
+	// ParkedSaleTTL is how long a parked cart is kept before it expires
+	// and its stock reservation is released.
+	ParkedSaleTTL time.Duration
+
+	// PriceChangeInterval is how often scheduled price changes that have
+	// come due are applied (PRICE_CHANGE_INTERVAL).
+	PriceChangeInterval time.Duration
+
+	// TaxRate is added on top of discounted line totals, e.g. 0.15 for 15%.
+	TaxRate float64
+
+	// Cash rounding: CASH_ROUNDING_INCREMENT (e.g. 0.05, 0 = off) and
+	// CASH_ROUNDING_MODE ("nearest", "up" or "down").
+	CashRoundingIncrement float64
+	CashRoundingMode      string
+
+	// AllowNegativeStock lets sales take stock below zero for products that
+	// do not set their own policy (ALLOW_NEGATIVE_STOCK).
+	AllowNegativeStock bool
+
+	// Layaway rules: LAYAWAY_MIN_DEPOSIT_PERCENT, LAYAWAY_TERM_DAYS,
+	// LAYAWAY_FORFEIT_PERCENT and LAYAWAY_FORFEIT_FEE. Percentages are
+	// fractions, e.g. 0.2 for 20%.
+	LayawayMinDepositPercent float64
+	LayawayTerm              time.Duration
+	LayawayForfeitPercent    float64
+	LayawayForfeitFee        float64
+
+	// Receipt numbering: RECEIPT_PREFIX, STORE_CODE, RECEIPT_SCOPE
+	// ("store" or "terminal") and RECEIPT_YEARLY_RESET.
+	ReceiptPrefix      string
+	StoreCode          string
+	ReceiptScope       string
+	ReceiptYearlyReset bool
 }
 
 func Load() *Config {
@@ -25,9 +64,102 @@ func Load() *Config {
 		jwtSecret = "dev-secret-change-me"
 	}
 
+	parkedSaleTTL := 24 * time.Hour
+	if v := os.Getenv("PARKED_SALE_TTL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			parkedSaleTTL = d
+		}
+	}
+
+	priceChangeInterval := time.Minute
+	if v := os.Getenv("PRICE_CHANGE_INTERVAL"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			priceChangeInterval = d
+		}
+	}
+
+	taxRate := envFloat("TAX_RATE", 0)
+
+	cashRoundingIncrement := envFloat("CASH_ROUNDING_INCREMENT", 0)
+
+	cashRoundingMode := os.Getenv("CASH_ROUNDING_MODE")
+	if cashRoundingMode != "up" && cashRoundingMode != "down" {
+		cashRoundingMode = "nearest"
+	}
+
+	allowNegativeStock := false
+	if v := os.Getenv("ALLOW_NEGATIVE_STOCK"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			allowNegativeStock = b
+		}
+	}
+
+	layawayMinDeposit := envFloat("LAYAWAY_MIN_DEPOSIT_PERCENT", 0.1)
+	layawayForfeitPercent := envFloat("LAYAWAY_FORFEIT_PERCENT", 0)
+	layawayForfeitFee := envFloat("LAYAWAY_FORFEIT_FEE", 0)
+
+	layawayTerm := 30 * 24 * time.Hour
+	if v := os.Getenv("LAYAWAY_TERM_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			layawayTerm = time.Duration(n) * 24 * time.Hour
+		}
+	}
+
+	receiptPrefix := os.Getenv("RECEIPT_PREFIX")
+	if receiptPrefix == "" {
+		receiptPrefix = "R"
+	}
+
+	storeCode := os.Getenv("STORE_CODE")
+	if storeCode == "" {
+		storeCode = "S1"
+	}
+
+	receiptScope := os.Getenv("RECEIPT_SCOPE")
+	if receiptScope != "terminal" {
+		receiptScope = "store"
+	}
+
+	receiptYearlyReset := true
+	if v := os.Getenv("RECEIPT_YEARLY_RESET"); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			receiptYearlyReset = b
+		}
+	}
+
 	return &Config{
-		DBPath:    dbPath,
-		Port:      port,
-		JWTSecret: jwtSecret,
+		DBPath:        dbPath,
+		Port:          port,
+		JWTSecret:     jwtSecret,
+		ParkedSaleTTL: parkedSaleTTL,
+		TaxRate:       taxRate,
+
+		PriceChangeInterval: priceChangeInterval,
+
+		CashRoundingIncrement: cashRoundingIncrement,
+		CashRoundingMode:      cashRoundingMode,
+
+		AllowNegativeStock: allowNegativeStock,
+
+		LayawayMinDepositPercent: layawayMinDeposit,
+		LayawayTerm:              layawayTerm,
+		LayawayForfeitPercent:    layawayForfeitPercent,
+		LayawayForfeitFee:        layawayForfeitFee,
+
+		ReceiptPrefix:      receiptPrefix,
+		StoreCode:          storeCode,
+		ReceiptScope:       receiptScope,
+		ReceiptYearlyReset: receiptYearlyReset,
+	}
+}
+
+// envFloat reads a non-negative number from the environment, falling back
+// to def when it is unset or invalid.
+func envFloat(key string, def float64) float64 {
+	if v := os.Getenv(key); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil && f >= 0 {
+			return f
+		}
 	}
+	return def
 }
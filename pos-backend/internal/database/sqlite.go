@@ -18,17 +18,17 @@ func NewSQLiteDB(dbPath string) (*sql.DB, error) {
 		}
 	}
 
-	db, err := sql.Open("sqlite", dbPath)
+	// Pragmas go in the DSN so every pooled connection gets them, not just
+	// the first one. Write transactions start with BEGIN IMMEDIATE so two
+	// tills take the write lock up front and wait on each other for up to
+	// busy_timeout instead of failing when upgrading a read lock.
+	dsn := dbPath + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate"
+
+	db, err := sql.Open("sqlite", dsn)
 	if err != nil {
 		return nil, fmt.Errorf("open sqlite db: %w", err)
 	}
 
-	// Enable foreign key constraints
-	if _, err := db.Exec("PRAGMA foreign_keys = ON;"); err != nil {
-		db.Close()
-		return nil, fmt.Errorf("enable foreign_keys: %w", err)
-	}
-
 	if err := Migrate(db); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("run migrations: %w", err)
@@ -97,5 +97,694 @@ CREATE TABLE IF NOT EXISTS users (
 		return fmt.Errorf("create users table: %w", err)
 	}
 
+	createParkedSalesTable := `
+CREATE TABLE IF NOT EXISTS parked_sales (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    label TEXT NOT NULL,
+    terminal_id TEXT NOT NULL DEFAULT '',
+    reserve_stock INTEGER NOT NULL DEFAULT 0,
+    expires_at DATETIME NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+
+	if _, err := db.Exec(createParkedSalesTable); err != nil {
+		return fmt.Errorf("create parked_sales table: %w", err)
+	}
+
+	createParkedSaleItemsTable := `
+CREATE TABLE IF NOT EXISTS parked_sale_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    parked_sale_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    unit_price REAL, -- NULL = use product price when resumed
+    FOREIGN KEY (parked_sale_id) REFERENCES parked_sales(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);`
+
+	if _, err := db.Exec(createParkedSaleItemsTable); err != nil {
+		return fmt.Errorf("create parked_sale_items table: %w", err)
+	}
+
+	// Soft reservations hold stock back from other tills without touching
+	// products.stock. source/source_id point at the owning record, e.g.
+	// ("parked_sale", 12).
+	createStockReservationsTable := `
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    source TEXT NOT NULL,
+    source_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    expires_at DATETIME, -- NULL = held until released
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_product ON stock_reservations(product_id);
+CREATE INDEX IF NOT EXISTS idx_stock_reservations_source ON stock_reservations(source, source_id);`
+
+	if _, err := db.Exec(createStockReservationsTable); err != nil {
+		return fmt.Errorf("create stock_reservations table: %w", err)
+	}
+
+	// Price breakdown stored with each sale so receipts match the quote.
+	added, err := addColumnIfMissing(db, "sales", "subtotal", "REAL NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	if added {
+		if _, err := db.Exec(`UPDATE sales SET subtotal = total_amount`); err != nil {
+			return fmt.Errorf("backfill sales.subtotal: %w", err)
+		}
+	}
+	if _, err := addColumnIfMissing(db, "sales", "discount_amount", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "sales", "tax_amount", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	added, err = addColumnIfMissing(db, "sale_items", "list_price", "REAL NOT NULL DEFAULT 0")
+	if err != nil {
+		return err
+	}
+	if added {
+		if _, err := db.Exec(`UPDATE sale_items SET list_price = unit_price`); err != nil {
+			return fmt.Errorf("backfill sale_items.list_price: %w", err)
+		}
+	}
+	if _, err := addColumnIfMissing(db, "sale_items", "discount_amount", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "sale_items", "tax_amount", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// Receipt numbers are allocated from these counters inside the sale
+	// transaction so a rolled back sale never burns a number.
+	createReceiptSequencesTable := `
+CREATE TABLE IF NOT EXISTS receipt_sequences (
+    scope TEXT NOT NULL,
+    year INTEGER NOT NULL, -- 0 when numbering does not reset yearly
+    last_number INTEGER NOT NULL,
+    PRIMARY KEY (scope, year)
+);`
+
+	if _, err := db.Exec(createReceiptSequencesTable); err != nil {
+		return fmt.Errorf("create receipt_sequences table: %w", err)
+	}
+
+	if _, err := addColumnIfMissing(db, "sales", "receipt_number", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_sales_receipt_number ON sales(receipt_number)`); err != nil {
+		return fmt.Errorf("create sales receipt_number index: %w", err)
+	}
+
+	// Who rang up the sale and on which till. NULL user_id = recorded
+	// before cashiers were tracked.
+	if _, err := addColumnIfMissing(db, "sales", "user_id", "INTEGER REFERENCES users(id)"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "sales", "terminal_id", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_sales_user_id ON sales(user_id)`); err != nil {
+		return fmt.Errorf("create sales user_id index: %w", err)
+	}
+
+	createShiftsTable := `
+CREATE TABLE IF NOT EXISTS shifts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    terminal_id TEXT NOT NULL,
+    user_id INTEGER NOT NULL,
+    status TEXT NOT NULL, -- "open" or "closed"
+    opening_float REAL NOT NULL,
+    expected_cash REAL, -- set at close
+    counted_cash REAL,
+    variance REAL,
+    opened_at DATETIME NOT NULL,
+    closed_at DATETIME,
+    closed_by INTEGER,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (closed_by) REFERENCES users(id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_shifts_open_terminal ON shifts(terminal_id) WHERE status = 'open';`
+
+	if _, err := db.Exec(createShiftsTable); err != nil {
+		return fmt.Errorf("create shifts table: %w", err)
+	}
+
+	createCashMovementsTable := `
+CREATE TABLE IF NOT EXISTS cash_movements (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    shift_id INTEGER NOT NULL,
+    kind TEXT NOT NULL, -- "paid_in" or "paid_out"
+    amount REAL NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    user_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (shift_id) REFERENCES shifts(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id)
+);`
+
+	if _, err := db.Exec(createCashMovementsTable); err != nil {
+		return fmt.Errorf("create cash_movements table: %w", err)
+	}
+
+	if _, err := addColumnIfMissing(db, "sales", "rounding_amount", "REAL NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+
+	// One row per payment on a sale. amount is what was applied to the sale
+	// total; tips are kept apart so they never count as revenue.
+	hadTenders, err := tableExists(db, "sale_tenders")
+	if err != nil {
+		return err
+	}
+
+	createSaleTendersTable := `
+CREATE TABLE IF NOT EXISTS sale_tenders (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sale_id INTEGER NOT NULL,
+    method TEXT NOT NULL,
+    amount REAL NOT NULL,
+    tip_amount REAL NOT NULL DEFAULT 0,
+    tip_user_id INTEGER, -- employee receiving the tip
+    tip_pool TEXT NOT NULL DEFAULT '', -- or a shared pool
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (sale_id) REFERENCES sales(id) ON DELETE CASCADE,
+    FOREIGN KEY (tip_user_id) REFERENCES users(id)
+);
+CREATE INDEX IF NOT EXISTS idx_sale_tenders_sale_id ON sale_tenders(sale_id);`
+
+	if _, err := db.Exec(createSaleTendersTable); err != nil {
+		return fmt.Errorf("create sale_tenders table: %w", err)
+	}
+
+	if !hadTenders {
+		// sales recorded before tenders existed were paid in a single method
+		backfill := `
+INSERT INTO sale_tenders (sale_id, method, amount, created_at)
+SELECT id, payment_method, total_amount, created_at FROM sales;`
+		if _, err := db.Exec(backfill); err != nil {
+			return fmt.Errorf("backfill sale_tenders: %w", err)
+		}
+	}
+
+	if _, err := addColumnIfMissing(db, "sales", "shift_id", "INTEGER REFERENCES shifts(id)"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_sales_shift_id ON sales(shift_id)`); err != nil {
+		return fmt.Errorf("create sales shift_id index: %w", err)
+	}
+
+	createLayawaysTable := `
+CREATE TABLE IF NOT EXISTS layaways (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    customer_name TEXT NOT NULL,
+    customer_phone TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL, -- "open", "completed" or "cancelled"
+    subtotal REAL NOT NULL,
+    discount_amount REAL NOT NULL DEFAULT 0,
+    tax_amount REAL NOT NULL DEFAULT 0,
+    total_amount REAL NOT NULL,
+    paid_amount REAL NOT NULL DEFAULT 0,
+    forfeited_amount REAL NOT NULL DEFAULT 0,
+    refunded_amount REAL NOT NULL DEFAULT 0,
+    due_date DATETIME NOT NULL,
+    user_id INTEGER NOT NULL,
+    terminal_id TEXT NOT NULL DEFAULT '',
+    sale_id INTEGER, -- set when the final payment converts it to a sale
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    closed_at DATETIME,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (sale_id) REFERENCES sales(id)
+);`
+
+	if _, err := db.Exec(createLayawaysTable); err != nil {
+		return fmt.Errorf("create layaways table: %w", err)
+	}
+
+	createLayawayItemsTable := `
+CREATE TABLE IF NOT EXISTS layaway_items (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    layaway_id INTEGER NOT NULL,
+    product_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL,
+    list_price REAL NOT NULL,
+    unit_price REAL NOT NULL,
+    discount_amount REAL NOT NULL DEFAULT 0,
+    tax_amount REAL NOT NULL DEFAULT 0,
+    line_total REAL NOT NULL,
+    FOREIGN KEY (layaway_id) REFERENCES layaways(id) ON DELETE CASCADE,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE RESTRICT
+);`
+
+	if _, err := db.Exec(createLayawayItemsTable); err != nil {
+		return fmt.Errorf("create layaway_items table: %w", err)
+	}
+
+	// Refunds on cancellation are stored as negative amounts so the sum of
+	// a layaway's payments is always what the store currently holds.
+	createLayawayPaymentsTable := `
+CREATE TABLE IF NOT EXISTS layaway_payments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    layaway_id INTEGER NOT NULL,
+    method TEXT NOT NULL,
+    amount REAL NOT NULL,
+    user_id INTEGER NOT NULL,
+    terminal_id TEXT NOT NULL DEFAULT '',
+    shift_id INTEGER,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (layaway_id) REFERENCES layaways(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (shift_id) REFERENCES shifts(id)
+);
+CREATE INDEX IF NOT EXISTS idx_layaway_payments_shift_id ON layaway_payments(shift_id);`
+
+	if _, err := db.Exec(createLayawayPaymentsTable); err != nil {
+		return fmt.Errorf("create layaway_payments table: %w", err)
+	}
+
+	// An exchange is a single sale that returns lines from an earlier sale
+	// and sells new ones. Return lines carry a negative quantity and point
+	// at the line they came from so it cannot be returned twice.
+	if _, err := addColumnIfMissing(db, "sales", "kind", "TEXT NOT NULL DEFAULT 'sale'"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "sales", "original_sale_id", "INTEGER REFERENCES sales(id)"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "sale_items", "returned_item_id", "INTEGER REFERENCES sale_items(id)"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_sale_items_returned_item_id ON sale_items(returned_item_id)`); err != nil {
+		return fmt.Errorf("create sale_items returned_item_id index: %w", err)
+	}
+
+	// NULL = follow the store-wide ALLOW_NEGATIVE_STOCK setting.
+	if _, err := addColumnIfMissing(db, "products", "allow_negative_stock", "INTEGER"); err != nil {
+		return err
+	}
+
+	// Product search indexes. products_fts matches whole words and
+	// prefixes; products_trigram backs the typo-tolerant fallback. Both are
+	// external-content tables kept in sync with products by triggers.
+	hadProductSearch, err := tableExists(db, "products_fts")
+	if err != nil {
+		return err
+	}
+
+	createProductSearch := `
+CREATE VIRTUAL TABLE IF NOT EXISTS products_fts USING fts5(
+    name, sku, content='products', content_rowid='id', tokenize='unicode61 remove_diacritics 2'
+);
+CREATE VIRTUAL TABLE IF NOT EXISTS products_trigram USING fts5(
+    name, sku, content='products', content_rowid='id', tokenize='trigram'
+);
+CREATE TRIGGER IF NOT EXISTS products_search_ai AFTER INSERT ON products BEGIN
+    INSERT INTO products_fts(rowid, name, sku) VALUES (new.id, new.name, new.sku);
+    INSERT INTO products_trigram(rowid, name, sku) VALUES (new.id, new.name, new.sku);
+END;
+CREATE TRIGGER IF NOT EXISTS products_search_ad AFTER DELETE ON products BEGIN
+    INSERT INTO products_fts(products_fts, rowid, name, sku) VALUES ('delete', old.id, old.name, old.sku);
+    INSERT INTO products_trigram(products_trigram, rowid, name, sku) VALUES ('delete', old.id, old.name, old.sku);
+END;
+CREATE TRIGGER IF NOT EXISTS products_search_au AFTER UPDATE OF name, sku ON products BEGIN
+    INSERT INTO products_fts(products_fts, rowid, name, sku) VALUES ('delete', old.id, old.name, old.sku);
+    INSERT INTO products_trigram(products_trigram, rowid, name, sku) VALUES ('delete', old.id, old.name, old.sku);
+    INSERT INTO products_fts(rowid, name, sku) VALUES (new.id, new.name, new.sku);
+    INSERT INTO products_trigram(rowid, name, sku) VALUES (new.id, new.name, new.sku);
+END;`
+
+	if _, err := db.Exec(createProductSearch); err != nil {
+		return fmt.Errorf("create product search index: %w", err)
+	}
+
+	if !hadProductSearch {
+		// index the products that existed before search was added
+		rebuild := `
+INSERT INTO products_fts(products_fts) VALUES ('rebuild');
+INSERT INTO products_trigram(products_trigram) VALUES ('rebuild');`
+		if _, err := db.Exec(rebuild); err != nil {
+			return fmt.Errorf("build product search index: %w", err)
+		}
+	}
+
+	// A product can carry several barcodes, e.g. the single unit and a case
+	// pack that sells pack_quantity units per scan. lookup_key is the
+	// normalized code scans are matched against.
+	createProductBarcodesTable := `
+CREATE TABLE IF NOT EXISTS product_barcodes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL,
+    code TEXT NOT NULL,
+    symbology TEXT NOT NULL,
+    lookup_key TEXT NOT NULL UNIQUE,
+    pack_quantity INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_product_barcodes_product_id ON product_barcodes(product_id);`
+
+	if _, err := db.Exec(createProductBarcodesTable); err != nil {
+		return fmt.Errorf("create product_barcodes table: %w", err)
+	}
+
+	// Scale labels identify products by PLU and embed a weight or price.
+	// barcode_rules describe the in-store prefixes and where the PLU and
+	// value sit in the code.
+	if _, err := addColumnIfMissing(db, "products", "plu", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_products_plu ON products(plu) WHERE plu IS NOT NULL`); err != nil {
+		return fmt.Errorf("create products plu index: %w", err)
+	}
+
+	createBarcodeRulesTable := `
+CREATE TABLE IF NOT EXISTS barcode_rules (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    prefix TEXT NOT NULL UNIQUE,
+    plu_length INTEGER NOT NULL,
+    value_kind TEXT NOT NULL,
+    value_length INTEGER NOT NULL,
+    value_decimals INTEGER NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`
+
+	if _, err := db.Exec(createBarcodeRulesTable); err != nil {
+		return fmt.Errorf("create barcode_rules table: %w", err)
+	}
+
+	// Lines sold by scanning keep the code, and the weight read from a
+	// variable-weight label.
+	if _, err := addColumnIfMissing(db, "sale_items", "barcode", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "sale_items", "weight", "REAL"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "parked_sale_items", "barcode", "TEXT"); err != nil {
+		return err
+	}
+
+	// GS1 codes carry the batch and expiry of the unit sold, kept for
+	// recalls and traceability.
+	if _, err := addColumnIfMissing(db, "sale_items", "lot", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "sale_items", "expiry_date", "TEXT"); err != nil {
+		return err
+	}
+
+	// Categories form a tree through parent_id. Sibling names are unique;
+	// top-level categories share parent 0 for that check.
+	createCategoriesTable := `
+CREATE TABLE IF NOT EXISTS categories (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    parent_id INTEGER,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (parent_id) REFERENCES categories(id) ON DELETE RESTRICT
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_categories_sibling_name ON categories(COALESCE(parent_id, 0), name COLLATE NOCASE);
+CREATE INDEX IF NOT EXISTS idx_categories_parent_id ON categories(parent_id);`
+
+	if _, err := db.Exec(createCategoriesTable); err != nil {
+		return fmt.Errorf("create categories table: %w", err)
+	}
+
+	if _, err := addColumnIfMissing(db, "products", "category_id", "INTEGER REFERENCES categories(id)"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_products_category_id ON products(category_id)`); err != nil {
+		return fmt.Errorf("create products category_id index: %w", err)
+	}
+
+	// Variants are ordinary products pointing at their parent, so stock,
+	// barcodes and sales work on them unchanged. own_price marks a variant
+	// whose price no longer follows the parent's.
+	if _, err := addColumnIfMissing(db, "products", "parent_id", "INTEGER REFERENCES products(id) ON DELETE CASCADE"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "products", "own_price", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_products_parent_id ON products(parent_id)`); err != nil {
+		return fmt.Errorf("create products parent_id index: %w", err)
+	}
+
+	// A parent's option types (size, color) and their values; code is the
+	// value's part of a generated variant SKU.
+	createProductOptionsTable := `
+CREATE TABLE IF NOT EXISTS product_options (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_options_name ON product_options(product_id, name COLLATE NOCASE);
+
+CREATE TABLE IF NOT EXISTS product_option_values (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    option_id INTEGER NOT NULL,
+    value TEXT NOT NULL,
+    code TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY (option_id) REFERENCES product_options(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_option_values_value ON product_option_values(option_id, value COLLATE NOCASE);
+
+CREATE TABLE IF NOT EXISTS product_variant_values (
+    variant_id INTEGER NOT NULL,
+    option_value_id INTEGER NOT NULL,
+    PRIMARY KEY (variant_id, option_value_id),
+    FOREIGN KEY (variant_id) REFERENCES products(id) ON DELETE CASCADE,
+    FOREIGN KEY (option_value_id) REFERENCES product_option_values(id) ON DELETE RESTRICT
+);`
+
+	if _, err := db.Exec(createProductOptionsTable); err != nil {
+		return fmt.Errorf("create product options tables: %w", err)
+	}
+
+	// Units of measure. decimals is the precision a quantity in the unit may
+	// have. The stock and quantity columns declared INTEGER before units
+	// existed are not rebuilt: INTEGER affinity only converts a value that
+	// is a whole number, so a fractional quantity such as 1.25 is kept as
+	// the REAL it was written as.
+	createUnitsTable := `
+CREATE TABLE IF NOT EXISTS units (
+    code TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    decimals INTEGER NOT NULL DEFAULT 0
+);
+INSERT OR IGNORE INTO units (code, name, decimals) VALUES
+    ('pcs', 'Pieces', 0),
+    ('kg', 'Kilograms', 3),
+    ('g', 'Grams', 0),
+    ('l', 'Litres', 3),
+    ('ml', 'Millilitres', 0),
+    ('m', 'Metres', 2);`
+
+	if _, err := db.Exec(createUnitsTable); err != nil {
+		return fmt.Errorf("create units table: %w", err)
+	}
+
+	// products.unit is the unit stock is counted and sold in. Purchase
+	// units convert into it, e.g. a case holding 24.
+	if _, err := addColumnIfMissing(db, "products", "unit", "TEXT NOT NULL DEFAULT 'pcs'"); err != nil {
+		return err
+	}
+
+	createProductUnitsTable := `
+CREATE TABLE IF NOT EXISTS product_units (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    factor REAL NOT NULL,
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_units_name ON product_units(product_id, name COLLATE NOCASE);`
+
+	if _, err := db.Exec(createProductUnitsTable); err != nil {
+		return fmt.Errorf("create product_units table: %w", err)
+	}
+
+	// A kit is a product made of other products; it has no stock of its
+	// own. Each kit line sold records what it took from every component
+	// and the share of the line's revenue the component stands for.
+	createKitTables := `
+CREATE TABLE IF NOT EXISTS kit_components (
+    kit_id INTEGER NOT NULL,
+    component_id INTEGER NOT NULL,
+    quantity REAL NOT NULL,
+    PRIMARY KEY (kit_id, component_id),
+    FOREIGN KEY (kit_id) REFERENCES products(id) ON DELETE CASCADE,
+    FOREIGN KEY (component_id) REFERENCES products(id) ON DELETE RESTRICT
+);
+CREATE INDEX IF NOT EXISTS idx_kit_components_component_id ON kit_components(component_id);
+
+CREATE TABLE IF NOT EXISTS sale_item_components (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sale_item_id INTEGER NOT NULL,
+    component_id INTEGER NOT NULL,
+    quantity REAL NOT NULL,
+    revenue REAL NOT NULL,
+    FOREIGN KEY (sale_item_id) REFERENCES sale_items(id) ON DELETE CASCADE,
+    FOREIGN KEY (component_id) REFERENCES products(id) ON DELETE RESTRICT
+);
+CREATE INDEX IF NOT EXISTS idx_sale_item_components_sale_item_id ON sale_item_components(sale_item_id);`
+
+	if _, err := db.Exec(createKitTables); err != nil {
+		return fmt.Errorf("create kit tables: %w", err)
+	}
+
+	// Archived products are off the POS but stay in sale history and
+	// reports, which a hard delete cannot offer once a product has sold.
+	if _, err := addColumnIfMissing(db, "products", "archived_at", "DATETIME"); err != nil {
+		return err
+	}
+
+	// Every edit of a product bumps its version, which clients send back in
+	// If-Match so an edit based on a stale copy is refused.
+	if _, err := addColumnIfMissing(db, "products", "version", "INTEGER NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+
+	hadProductPrices, err := tableExists(db, "product_prices")
+	if err != nil {
+		return err
+	}
+
+	// product_prices is the price history: each price a product had and
+	// from when, written by trigger whatever path changes the price.
+	// price_changes are prices set in advance, applied once they are due.
+	createPriceTables := `
+CREATE TABLE IF NOT EXISTS product_prices (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL,
+    price REAL NOT NULL,
+    effective_at DATETIME NOT NULL,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_product_prices_product_id ON product_prices(product_id, effective_at);
+
+CREATE TRIGGER IF NOT EXISTS products_price_ai AFTER INSERT ON products BEGIN
+    INSERT INTO product_prices (product_id, price, effective_at) VALUES (new.id, new.price, new.updated_at);
+END;
+CREATE TRIGGER IF NOT EXISTS products_price_au AFTER UPDATE OF price ON products WHEN new.price <> old.price BEGIN
+    INSERT INTO product_prices (product_id, price, effective_at) VALUES (new.id, new.price, new.updated_at);
+END;
+
+CREATE TABLE IF NOT EXISTS price_changes (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id INTEGER NOT NULL,
+    price REAL NOT NULL,
+    effective_at DATETIME NOT NULL,
+    status TEXT NOT NULL DEFAULT 'scheduled',
+    created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    applied_at DATETIME,
+    FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_price_changes_due ON price_changes(status, effective_at);
+CREATE INDEX IF NOT EXISTS idx_price_changes_product_id ON price_changes(product_id);`
+
+	if _, err := db.Exec(createPriceTables); err != nil {
+		return fmt.Errorf("create price tables: %w", err)
+	}
+
+	if !hadProductPrices {
+		// start the history of existing products at their current price
+		_, err := db.Exec(`INSERT INTO product_prices (product_id, price, effective_at) SELECT id, price, updated_at FROM products`)
+		if err != nil {
+			return fmt.Errorf("backfill product_prices: %w", err)
+		}
+	}
+
+	// Sale lines keep the unit cost of the day they were sold, so margins
+	// do not move when a product's cost is changed later. A cost is NULL
+	// when it is not known: never entered for the product, or sold before
+	// costs were tracked.
+	if _, err := addColumnIfMissing(db, "products", "cost", "REAL"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "sale_items", "unit_cost", "REAL"); err != nil {
+		return err
+	}
+	if _, err := addColumnIfMissing(db, "sale_item_components", "unit_cost", "REAL"); err != nil {
+		return err
+	}
+
+	// A resumed cart stays, holding its stock, until the sale it became is
+	// rung up or it is abandoned; resumed_at hides it from the parked list.
+	if _, err := addColumnIfMissing(db, "parked_sales", "resumed_at", "DATETIME"); err != nil {
+		return err
+	}
+
 	return nil
 }
+
+// addColumnIfMissing lets Migrate extend tables created by earlier versions,
+// since SQLite has no ADD COLUMN IF NOT EXISTS. It reports whether the
+// column was added so callers can backfill existing rows once.
+func addColumnIfMissing(db *sql.DB, table, column, definition string) (bool, error) {
+	exists, err := columnExists(db, table, column)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition)); err != nil {
+		return false, fmt.Errorf("add %s.%s column: %w", table, column, err)
+	}
+
+	return true, nil
+}
+
+func tableExists(db *sql.DB, table string) (bool, error) {
+	var n int
+	err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?`, table).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("inspect %s table: %w", table, err)
+	}
+	return n > 0, nil
+}
+
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, fmt.Errorf("inspect %s table: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return false, fmt.Errorf("inspect %s table: %w", table, err)
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return false, fmt.Errorf("inspect %s table: %w", table, err)
+	}
+
+	return false, nil
+}
@@ -87,8 +87,9 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 }
 
 type loginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	TerminalID string `json:"terminal_id,omitempty"` // tills sign in with their id; back office leaves it out
 }
 
 type loginResponse struct {
@@ -124,7 +125,7 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := auth.GenerateToken(user.ID, user.Role, h.jwtSecret, 24*time.Hour)
+	token, err := auth.GenerateToken(user.ID, user.Role, strings.TrimSpace(req.TerminalID), h.jwtSecret, 24*time.Hour)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to generate token")
 		return
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"pos-backend/internal/models"
+	"pos-backend/internal/repositories"
+)
+
+type CategoryHandler struct {
+	repo *repositories.CategoryRepository
+}
+
+func NewCategoryHandler(repo *repositories.CategoryRepository) *CategoryHandler {
+	return &CategoryHandler{repo: repo}
+}
+
+func (h *CategoryHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/categories", h.GetCategories)
+	r.Post("/categories", h.CreateCategory)
+	r.Get("/categories/{id}", h.GetCategoryByID)
+	r.Put("/categories/{id}", h.UpdateCategory)
+	r.Delete("/categories/{id}", h.DeleteCategory)
+}
+
+type categoryRequest struct {
+	Name      string `json:"name"`
+	ParentID  *int64 `json:"parent_id"` // omit or null for a top-level category
+	SortOrder int    `json:"sort_order"`
+	Active    *bool  `json:"active"` // defaults to true
+}
+
+// toCategory validates req and returns the category it describes, or a
+// client-facing message.
+func (req *categoryRequest) toCategory() (*models.Category, string) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, "name is required"
+	}
+	if req.ParentID != nil && *req.ParentID <= 0 {
+		return nil, "parent_id must be a positive integer"
+	}
+
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	return &models.Category{
+		Name:      name,
+		ParentID:  req.ParentID,
+		SortOrder: req.SortOrder,
+		Active:    active,
+	}, ""
+}
+
+func writeCategoryError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, "category not found")
+	case errors.Is(err, repositories.ErrCategoryNotFound):
+		writeError(w, http.StatusBadRequest, "parent category not found")
+	case errors.Is(err, repositories.ErrCategoryCycle):
+		writeError(w, http.StatusBadRequest, err.Error())
+	case errors.Is(err, repositories.ErrCategoryNameTaken),
+		errors.Is(err, repositories.ErrCategoryInUse):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, fallback)
+	}
+}
+
+// GetCategories returns the category tree, or a flat list with flat=true.
+// Inactive categories are left out unless include_inactive=true.
+func (h *CategoryHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	var includeInactive, flat bool
+	if v := q.Get("include_inactive"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "include_inactive must be true or false")
+			return
+		}
+		includeInactive = b
+	}
+	if v := q.Get("flat"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "flat must be true or false")
+			return
+		}
+		flat = b
+	}
+
+	var (
+		categories []models.Category
+		err        error
+	)
+	if flat {
+		categories, err = h.repo.GetAll(r.Context(), includeInactive)
+	} else {
+		categories, err = h.repo.GetTree(r.Context(), includeInactive)
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch categories")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, categories)
+}
+
+func (h *CategoryHandler) GetCategoryByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid category id")
+		return
+	}
+
+	c, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		writeCategoryError(w, err, "failed to fetch category")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, c)
+}
+
+func (h *CategoryHandler) CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var req categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	c, msg := req.toCategory()
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	if err := h.repo.Create(r.Context(), c); err != nil {
+		writeCategoryError(w, err, "failed to create category")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, c)
+}
+
+func (h *CategoryHandler) UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid category id")
+		return
+	}
+
+	var req categoryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	c, msg := req.toCategory()
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+	c.ID = id
+
+	if err := h.repo.Update(r.Context(), c); err != nil {
+		writeCategoryError(w, err, "failed to update category")
+		return
+	}
+
+	updated, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		writeCategoryError(w, err, "failed to fetch category")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, updated)
+}
+
+func (h *CategoryHandler) DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid category id")
+		return
+	}
+
+	if err := h.repo.Delete(r.Context(), id); err != nil {
+		writeCategoryError(w, err, "failed to delete category")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,277 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"pos-backend/internal/repositories"
+)
+
+type LayawayHandler struct {
+	repo      *repositories.LayawayRepository
+	jwtSecret string
+}
+
+func NewLayawayHandler(repo *repositories.LayawayRepository, jwtSecret string) *LayawayHandler {
+	return &LayawayHandler{repo: repo, jwtSecret: jwtSecret}
+}
+
+func (h *LayawayHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/layaways", h.GetLayaways)
+	r.Post("/layaways", h.CreateLayaway)
+	r.Get("/layaways/{id}", h.GetLayawayByID)
+	r.Post("/layaways/{id}/payments", h.AddPayment)
+	r.Post("/layaways/{id}/cancel", h.CancelLayaway)
+}
+
+type layawayPaymentRequest struct {
+	Method     string  `json:"method"`
+	Amount     float64 `json:"amount"`
+	TerminalID string  `json:"terminal_id,omitempty"`
+}
+
+type createLayawayRequest struct {
+	CustomerName  string                  `json:"customer_name"`
+	CustomerPhone string                  `json:"customer_phone"`
+	Items         []createSaleItemRequest `json:"items"`
+	DueDate       string                  `json:"due_date,omitempty"` // YYYY-MM-DD, defaults to the store term
+	Deposit       layawayPaymentRequest   `json:"deposit"`
+	TerminalID    string                  `json:"terminal_id,omitempty"`
+}
+
+type cancelLayawayRequest struct {
+	RefundMethod string `json:"refund_method"`
+	TerminalID   string `json:"terminal_id,omitempty"`
+}
+
+// writeLayawayError maps layaway state errors and falls back to the shared
+// pricing and stock mapping.
+func writeLayawayError(w http.ResponseWriter, err error, fallback string) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, "layaway not found")
+	case errors.Is(err, repositories.ErrDepositTooSmall):
+		writeError(w, http.StatusBadRequest, "deposit is below the minimum required")
+	case errors.Is(err, repositories.ErrLayawayOverpayment):
+		writeError(w, http.StatusBadRequest, "payment exceeds the balance due")
+	case errors.Is(err, repositories.ErrLayawayNotOpen):
+		writeError(w, http.StatusConflict, "layaway is not open")
+	default:
+		writeSaleError(w, err, fallback)
+	}
+}
+
+func (h *LayawayHandler) CreateLayaway(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var req createLayawayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	req.CustomerName = strings.TrimSpace(req.CustomerName)
+	if req.CustomerName == "" {
+		writeError(w, http.StatusBadRequest, "customer_name is required")
+		return
+	}
+
+	items, msg := parseSaleItems(req.Items)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	var dueDate time.Time
+	if req.DueDate != "" {
+		dueDate, err = time.Parse(dateLayout, req.DueDate)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "due_date must be YYYY-MM-DD")
+			return
+		}
+		// the layaway is due at the end of the given day
+		dueDate = dueDate.Add(24*time.Hour - time.Second)
+		if dueDate.Before(time.Now().UTC()) {
+			writeError(w, http.StatusBadRequest, "due_date must not be in the past")
+			return
+		}
+	}
+
+	method := strings.TrimSpace(strings.ToLower(req.Deposit.Method))
+	if method == "" {
+		writeError(w, http.StatusBadRequest, "deposit.method is required")
+		return
+	}
+	if req.Deposit.Amount < 0 {
+		writeError(w, http.StatusBadRequest, "deposit.amount must be >= 0")
+		return
+	}
+
+	terminalID, err := sessionTerminal(claims, req.TerminalID)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	l, err := h.repo.Create(r.Context(), &repositories.CreateLayawayParams{
+		CustomerName:  req.CustomerName,
+		CustomerPhone: strings.TrimSpace(req.CustomerPhone),
+		Items:         items,
+		DueDate:       dueDate,
+		Deposit:       repositories.TenderParam{Method: method, Amount: req.Deposit.Amount},
+		UserID:        claims.UserID,
+		TerminalID:    terminalID,
+	})
+	if err != nil {
+		writeLayawayError(w, err, "failed to create layaway")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, l)
+}
+
+func (h *LayawayHandler) GetLayaways(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := repositories.LayawayFilter{
+		Status: strings.TrimSpace(q.Get("status")),
+	}
+
+	switch filter.Status {
+	case "", repositories.LayawayStatusOpen, repositories.LayawayStatusCompleted, repositories.LayawayStatusCancelled:
+	default:
+		writeError(w, http.StatusBadRequest, "status must be 'open', 'completed' or 'cancelled'")
+		return
+	}
+
+	if v := q.Get("overdue"); v != "" {
+		overdue, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "overdue must be true or false")
+			return
+		}
+		filter.Overdue = overdue
+	}
+
+	list, err := h.repo.GetAll(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch layaways")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *LayawayHandler) GetLayawayByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid layaway id")
+		return
+	}
+
+	l, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		writeLayawayError(w, err, "failed to fetch layaway")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (h *LayawayHandler) AddPayment(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid layaway id")
+		return
+	}
+
+	var req layawayPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	method := strings.TrimSpace(strings.ToLower(req.Method))
+	if method == "" {
+		writeError(w, http.StatusBadRequest, "method is required")
+		return
+	}
+	if req.Amount <= 0 {
+		writeError(w, http.StatusBadRequest, "amount must be > 0")
+		return
+	}
+
+	terminalID, err := sessionTerminal(claims, req.TerminalID)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	l, err := h.repo.AddPayment(r.Context(), id, &repositories.LayawayPaymentParams{
+		Method:     method,
+		Amount:     req.Amount,
+		UserID:     claims.UserID,
+		TerminalID: terminalID,
+	})
+	if err != nil {
+		writeLayawayError(w, err, "failed to record layaway payment")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, l)
+}
+
+func (h *LayawayHandler) CancelLayaway(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid layaway id")
+		return
+	}
+
+	var req cancelLayawayRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	refundMethod := strings.TrimSpace(strings.ToLower(req.RefundMethod))
+	if refundMethod == "" {
+		refundMethod = "cash"
+	}
+
+	terminalID, err := sessionTerminal(claims, req.TerminalID)
+	if err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	l, err := h.repo.Cancel(r.Context(), id, refundMethod, claims.UserID, terminalID)
+	if err != nil {
+		writeLayawayError(w, err, "failed to cancel layaway")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, l)
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"pos-backend/internal/repositories"
+)
+
+type ParkedSaleHandler struct {
+	repo       *repositories.ParkedSaleRepository
+	defaultTTL time.Duration
+}
+
+func NewParkedSaleHandler(repo *repositories.ParkedSaleRepository, defaultTTL time.Duration) *ParkedSaleHandler {
+	return &ParkedSaleHandler{repo: repo, defaultTTL: defaultTTL}
+}
+
+func (h *ParkedSaleHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/parked-sales", h.GetParkedSales)
+	r.Post("/parked-sales", h.ParkSale)
+	r.Get("/parked-sales/{id}", h.GetParkedSaleByID)
+	r.Post("/parked-sales/{id}/resume", h.ResumeParkedSale)
+	r.Delete("/parked-sales/{id}", h.DeleteParkedSale)
+}
+
+type parkSaleRequest struct {
+	Label        string                  `json:"label"`
+	TerminalID   string                  `json:"terminal_id"`
+	ReserveStock bool                    `json:"reserve_stock"`
+	TTLMinutes   int64                   `json:"ttl_minutes,omitempty"` // 0 = server default
+	Items        []createSaleItemRequest `json:"items"`
+}
+
+func (h *ParkedSaleHandler) ParkSale(w http.ResponseWriter, r *http.Request) {
+	var req parkSaleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	req.Label = strings.TrimSpace(req.Label)
+	if req.Label == "" {
+		writeError(w, http.StatusBadRequest, "label is required")
+		return
+	}
+	if req.TTLMinutes < 0 {
+		writeError(w, http.StatusBadRequest, "ttl_minutes must be >= 0")
+		return
+	}
+
+	items, msg := parseSaleItems(req.Items)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	ttl := h.defaultTTL
+	if req.TTLMinutes > 0 {
+		ttl = time.Duration(req.TTLMinutes) * time.Minute
+	}
+
+	params := &repositories.ParkSaleParams{
+		Label:        req.Label,
+		TerminalID:   strings.TrimSpace(req.TerminalID),
+		ReserveStock: req.ReserveStock,
+		TTL:          ttl,
+		Items:        items,
+	}
+
+	ps, err := h.repo.Park(r.Context(), params)
+	if err != nil {
+		var linesErr *repositories.SaleLinesError
+		if errors.Is(err, repositories.ErrInsufficientStock) && !errors.As(err, &linesErr) {
+			writeError(w, http.StatusConflict, "insufficient stock to reserve one or more products")
+			return
+		}
+		// lines that could not be sold cannot be parked either
+		writeSaleError(w, err, "failed to park sale")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ps)
+}
+
+func (h *ParkedSaleHandler) GetParkedSales(w http.ResponseWriter, r *http.Request) {
+	list, err := h.repo.GetAll(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch parked sales")
+		return
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (h *ParkedSaleHandler) GetParkedSaleByID(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid parked sale id")
+		return
+	}
+
+	ps, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "parked sale not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch parked sale")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ps)
+}
+
+func (h *ParkedSaleHandler) ResumeParkedSale(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid parked sale id")
+		return
+	}
+
+	ps, err := h.repo.Resume(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "parked sale not found")
+			return
+		}
+		if errors.Is(err, repositories.ErrParkedSaleResumed) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to resume parked sale")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ps)
+}
+
+func (h *ParkedSaleHandler) DeleteParkedSale(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid parked sale id")
+		return
+	}
+
+	if err := h.repo.Delete(r.Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "parked sale not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete parked sale")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
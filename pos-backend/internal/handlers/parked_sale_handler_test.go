@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestParkSale(t *testing.T) {
+	srv, db, token := newProductTestServer(t)
+
+	// cheese is stocked by the kilogram and sold from GS1 weight labels
+	cheese := insertTestProduct(t, db, "CHEESE", 2, nil)
+	if _, err := db.Exec(`UPDATE products SET unit = 'kg' WHERE id = ?`, cheese); err != nil {
+		t.Fatalf("set unit: %v", err)
+	}
+	_, err := db.Exec(`INSERT INTO product_barcodes (product_id, code, symbology, lookup_key) VALUES (?, '4006381333931', 'ean13', '04006381333931')`, cheese)
+	if err != nil {
+		t.Fatalf("insert barcode: %v", err)
+	}
+	const label = "(01)04006381333931(3103)001250" // 1.250 kg
+
+	archived := insertTestProduct(t, db, "OLD", 5, nil)
+	if _, err := db.Exec(`UPDATE products SET archived_at = CURRENT_TIMESTAMP WHERE id = ?`, archived); err != nil {
+		t.Fatalf("archive product: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		item    string
+		reserve bool
+		status  int
+	}{
+		{"archived product", fmt.Sprintf(`{"product_id":%d,"quantity":1}`, archived), true, http.StatusBadRequest},
+		{"archived product without a hold", fmt.Sprintf(`{"product_id":%d,"quantity":1}`, archived), false, http.StatusBadRequest},
+		{"label holds its weight", fmt.Sprintf(`{"barcode":%q,"quantity":1}`, label), true, http.StatusCreated},
+		{"second label is more than is left", fmt.Sprintf(`{"barcode":%q,"quantity":1}`, label), true, http.StatusConflict},
+		{"a cart without a hold leaves stock to the sale", fmt.Sprintf(`{"barcode":%q,"quantity":1}`, label), false, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"label":"hold","reserve_stock":%t,"items":[%s]}`, tt.reserve, tt.item)
+			if status, resp := doRequest(t, srv, token, http.MethodPost, "/parked-sales", body); status != tt.status {
+				t.Errorf("status = %d, want %d (%s)", status, tt.status, resp)
+			}
+		})
+	}
+
+	var held float64
+	if err := db.QueryRow(`SELECT COALESCE(SUM(quantity), 0) FROM stock_reservations WHERE product_id = ?`, cheese).Scan(&held); err != nil {
+		t.Fatalf("read reservations: %v", err)
+	}
+	if held != 1.25 {
+		t.Errorf("cheese held = %v kg, want 1.25", held)
+	}
+}
+
+func TestCreateSaleFromParkedSale(t *testing.T) {
+	srv, db, token := newProductTestServer(t)
+
+	id := insertTestProduct(t, db, "TEA", 1, nil)
+	status, resp := doRequest(t, srv, token, http.MethodPost, "/parked-sales",
+		fmt.Sprintf(`{"label":"hold","reserve_stock":true,"items":[{"product_id":%d,"quantity":1}]}`, id))
+	if status != http.StatusCreated {
+		t.Fatalf("park: status %d (%s)", status, resp)
+	}
+	var cart struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(resp), &cart); err != nil {
+		t.Fatalf("decode parked sale: %v", err)
+	}
+
+	sale := func(parkedSaleID int64) string {
+		return fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":1}],"payment_method":"cash","paid_amount":10,"parked_sale_id":%d}`, id, parkedSaleID)
+	}
+
+	steps := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{"a cart still parked is not taken", http.MethodPost, "/sales", sale(cart.ID), http.StatusConflict},
+		{"an unknown cart", http.MethodPost, "/sales", sale(9999), http.StatusNotFound},
+		{"resume", http.MethodPost, fmt.Sprintf("/parked-sales/%d/resume", cart.ID), "", http.StatusOK},
+		{"the resumed cart sells its hold", http.MethodPost, "/sales", sale(cart.ID), http.StatusCreated},
+		{"the cart went with its sale", http.MethodPost, "/sales", sale(cart.ID), http.StatusNotFound},
+	}
+
+	for _, s := range steps {
+		if status, resp := doRequest(t, srv, token, s.method, s.path, s.body); status != s.status {
+			t.Fatalf("%s: status %d, want %d (%s)", s.name, status, s.status, resp)
+		}
+	}
+
+	var reservations int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM stock_reservations`).Scan(&reservations); err != nil {
+		t.Fatalf("count reservations: %v", err)
+	}
+	if reservations != 0 {
+		t.Errorf("%d reservations left, want 0", reservations)
+	}
+}
@@ -4,11 +4,17 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
+	"pos-backend/internal/barcode"
 	"pos-backend/internal/models"
 	"pos-backend/internal/repositories"
 )
@@ -26,18 +32,157 @@ func (h *ProductHandler) RegisterRoutes(r chi.Router) {
 	r.Post("/products", h.CreateProduct)
 	r.Get("/products/{id}", h.GetProductByID)
 	r.Put("/products/{id}", h.UpdateProduct)
+	r.Patch("/products/{id}", h.PatchProduct)
 	r.Delete("/products/{id}", h.DeleteProduct)
+	r.Post("/products/{id}/archive", h.ArchiveProduct)
+	r.Post("/products/{id}/unarchive", h.UnarchiveProduct)
 
 	r.Get("/products/low-stock", h.GetLowStockProducts)
+	r.Get("/products/export", h.ExportProducts)
+	r.Post("/products/import", h.ImportProducts)
+
+	r.Get("/products/{id}/variants", h.GetVariants)
+	r.Post("/products/{id}/variants", h.GenerateVariants)
+
+	r.Get("/products/by-barcode/{code}", h.GetProductByBarcode)
+	r.Post("/products/{id}/barcodes", h.AddBarcode)
+	r.Delete("/products/{id}/barcodes/{barcodeID}", h.DeleteBarcode)
+
+	r.Post("/products/{id}/units", h.AddUnit)
+	r.Delete("/products/{id}/units/{unitID}", h.DeleteUnit)
+	r.Post("/products/{id}/receive", h.ReceiveStock)
+
+	r.Put("/products/{id}/components", h.SetComponents)
+
+	r.Get("/products/{id}/prices", h.GetPriceHistory)
+	r.Post("/products/{id}/prices", h.SchedulePrice)
+	r.Get("/price-changes", h.GetPriceChanges)
+	r.Post("/price-changes", h.SchedulePriceChanges)
+	r.Post("/price-changes/{id}/cancel", h.CancelPriceChange)
+
+	r.Get("/barcode-rules", h.GetBarcodeRules)
+	r.Post("/barcode-rules", h.CreateBarcodeRule)
+	r.Delete("/barcode-rules/{id}", h.DeleteBarcodeRule)
 }
 
+// parseProductFilter reads the search, filter, sort and page parameters of
+// GET /products. It returns a client-facing message when one is unusable.
+func parseProductFilter(r *http.Request) (repositories.ProductFilter, string) {
+	q := r.URL.Query()
+	filter := repositories.ProductFilter{
+		Query:  strings.TrimSpace(q.Get("q")),
+		Cursor: strings.TrimSpace(q.Get("cursor")),
+	}
+
+	if v := q.Get("category_id"); v != "" {
+		categoryID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || categoryID <= 0 {
+			return filter, "category_id must be a positive integer"
+		}
+		filter.CategoryID = categoryID
+	}
+
+	switch v := q.Get("level"); v {
+	case "", repositories.ProductLevelParent, repositories.ProductLevelVariant:
+		filter.Level = v
+	default:
+		return filter, "level must be parent or variant"
+	}
+
+	if v := q.Get("min_price"); v != "" {
+		minPrice, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, "min_price must be a number"
+		}
+		filter.MinPrice = &minPrice
+	}
+	if v := q.Get("max_price"); v != "" {
+		maxPrice, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, "max_price must be a number"
+		}
+		filter.MaxPrice = &maxPrice
+	}
+
+	if v := q.Get("in_stock"); v != "" {
+		inStock, err := strconv.ParseBool(v)
+		if err != nil {
+			return filter, "in_stock must be true or false"
+		}
+		filter.InStock = inStock
+	}
+
+	// archived products only show up when asked for
+	switch v := q.Get("status"); v {
+	case "", repositories.ProductStatusActive:
+	case repositories.ProductStatusArchived, repositories.ProductStatusAll:
+		filter.Status = v
+	default:
+		return filter, "status must be active, archived or all"
+	}
+
+	// sort=price or sort=-price; a leading "-" means descending
+	if v := strings.TrimSpace(q.Get("sort")); v != "" {
+		filter.Desc = strings.HasPrefix(v, "-")
+		filter.Sort = strings.TrimPrefix(v, "-")
+		switch filter.Sort {
+		case repositories.ProductSortName, repositories.ProductSortPrice,
+			repositories.ProductSortStock, repositories.ProductSortCreatedAt:
+		case repositories.ProductSortRelevance:
+			if filter.Query == "" {
+				return filter, "sort=relevance requires q"
+			}
+		default:
+			return filter, "sort must be relevance, name, price, stock or created_at, optionally prefixed with '-'"
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, "limit must be a positive integer"
+		}
+		filter.Limit = limit
+	}
+
+	return filter, ""
+}
+
+// GetProducts returns a ProductPage when the client sends limit or cursor,
+// and otherwise the plain array of matching products older clients expect.
 func (h *ProductHandler) GetProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.repo.GetAll(r.Context())
+	filter, msg := parseProductFilter(r)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	// the unpaged listing has no total to report
+	filter.SkipCount = !wantsPage(r)
+	page, err := h.repo.GetAll(r.Context(), filter)
 	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to fetch products")
 		return
 	}
+	if wantsPage(r) {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
 
+	// the unpaged listing, as it was before ProductPage
+	products := page.Items
+	for page.NextCursor != "" {
+		filter.Cursor = page.NextCursor
+		if page, err = h.repo.GetAll(r.Context(), filter); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to fetch products")
+			return
+		}
+		products = append(products, page.Items...)
+	}
 	writeJSON(w, http.StatusOK, products)
 }
 
@@ -59,14 +204,41 @@ func (h *ProductHandler) GetProductByID(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	w.Header().Set("ETag", productETag(product.Version))
 	writeJSON(w, http.StatusOK, product)
 }
 
+// productETag is the entity tag of a product version, sent back in
+// If-Match to update that version only.
+func productETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatchVersion returns the product version If-Match asks for, 0 when the
+// header is absent or "*". ok is false for a tag this API never issues,
+// which can match no version.
+func ifMatchVersion(r *http.Request) (version int64, ok bool) {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if v == "" || v == "*" {
+		return 0, true
+	}
+	n, err := strconv.ParseInt(strings.Trim(strings.TrimPrefix(v, "W/"), `"`), 10, 64)
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return n, true
+}
+
 type createProductRequest struct {
-	Name  string  `json:"name"`
-	SKU   string  `json:"sku"`
-	Price float64 `json:"price"`
-	Stock int64   `json:"stock"`
+	Name               string   `json:"name"`
+	SKU                string   `json:"sku"`
+	Price              float64  `json:"price"`
+	Cost               *float64 `json:"cost"` // unit cost, for margins; omit when unknown
+	Stock              float64  `json:"stock"`
+	AllowNegativeStock *bool    `json:"allow_negative_stock"` // omit to follow the store setting
+	PLU                string   `json:"plu,omitempty"`        // numeric code used by scale labels
+	CategoryID         *int64   `json:"category_id,omitempty"`
+	Unit               string   `json:"unit,omitempty"` // defaults to "pcs"
 }
 
 func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
@@ -79,27 +251,63 @@ func (h *ProductHandler) CreateProduct(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "name and sku are required")
 		return
 	}
+	if req.Cost != nil && *req.Cost < 0 {
+		writeError(w, http.StatusBadRequest, "cost cannot be negative")
+		return
+	}
+	req.PLU = strings.TrimSpace(req.PLU)
+	if !isPLU(req.PLU) {
+		writeError(w, http.StatusBadRequest, "plu must be digits only")
+		return
+	}
 
 	p := &models.Product{
-		Name:  req.Name,
-		SKU:   req.SKU,
-		Price: req.Price,
-		Stock: req.Stock,
+		Name:               req.Name,
+		SKU:                req.SKU,
+		Price:              req.Price,
+		Cost:               req.Cost,
+		Stock:              req.Stock,
+		AllowNegativeStock: req.AllowNegativeStock,
+		PLU:                req.PLU,
+		CategoryID:         req.CategoryID,
+		Unit:               strings.TrimSpace(req.Unit),
 	}
 
 	if err := h.repo.Create(r.Context(), p); err != nil {
+		if errors.Is(err, repositories.ErrPLUTaken) || errors.Is(err, repositories.ErrSKUTaken) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if errors.Is(err, repositories.ErrCategoryNotFound) {
+			writeError(w, http.StatusBadRequest, "category not found")
+			return
+		}
+		if errors.Is(err, repositories.ErrUnitNotFound) {
+			writeError(w, http.StatusBadRequest, "unit not found")
+			return
+		}
+		if errors.Is(err, repositories.ErrInvalidQuantity) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to create product")
 		return
 	}
 
+	w.Header().Set("ETag", productETag(p.Version))
 	writeJSON(w, http.StatusCreated, p)
 }
 
 type updateProductRequest struct {
-	Name  string  `json:"name"`
-	SKU   string  `json:"sku"`
-	Price float64 `json:"price"`
-	Stock int64   `json:"stock"`
+	Name               string   `json:"name"`
+	SKU                string   `json:"sku"`
+	Price              float64  `json:"price"`
+	Cost               *float64 `json:"cost"` // unit cost, for margins; omit when unknown
+	Stock              float64  `json:"stock"`
+	AllowNegativeStock *bool    `json:"allow_negative_stock"` // omit to follow the store setting
+	PLU                string   `json:"plu,omitempty"`        // numeric code used by scale labels
+	CategoryID         *int64   `json:"category_id,omitempty"`
+	Unit               string   `json:"unit,omitempty"` // defaults to "pcs"
 }
 
 func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
@@ -119,21 +327,158 @@ func (h *ProductHandler) UpdateProduct(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "name and sku are required")
 		return
 	}
+	if req.Cost != nil && *req.Cost < 0 {
+		writeError(w, http.StatusBadRequest, "cost cannot be negative")
+		return
+	}
+	req.PLU = strings.TrimSpace(req.PLU)
+	if !isPLU(req.PLU) {
+		writeError(w, http.StatusBadRequest, "plu must be digits only")
+		return
+	}
+
+	// a full update overwrites every field, stock included, so it must
+	// name the version it was read at ("*" overwrites whatever is there)
+	if r.Header.Get("If-Match") == "" {
+		writeError(w, http.StatusPreconditionRequired, "If-Match with the product's ETag is required")
+		return
+	}
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		writeError(w, http.StatusPreconditionFailed, "product was changed since it was read")
+		return
+	}
 
 	p := &models.Product{
-		ID:    id,
+		ID:                 id,
+		Name:               req.Name,
+		SKU:                req.SKU,
+		Price:              req.Price,
+		Cost:               req.Cost,
+		Stock:              req.Stock,
+		AllowNegativeStock: req.AllowNegativeStock,
+		PLU:                req.PLU,
+		CategoryID:         req.CategoryID,
+		Unit:               strings.TrimSpace(req.Unit),
+		Version:            version,
+	}
+
+	if err := h.repo.Update(r.Context(), p); err != nil {
+		writeProductUpdateError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", productETag(p.Version))
+	writeJSON(w, http.StatusOK, p)
+}
+
+// patchProductRequest holds the fields to change; the rest keep their
+// value.
+type patchProductRequest struct {
+	Name               *string         `json:"name"`
+	SKU                *string         `json:"sku"`
+	Price              *float64        `json:"price"`
+	Cost               *float64        `json:"cost"`
+	Stock              *float64        `json:"stock"`
+	Unit               *string         `json:"unit"`
+	PLU                *string         `json:"plu"`                  // "" clears it
+	CategoryID         json.RawMessage `json:"category_id"`          // null clears it
+	AllowNegativeStock json.RawMessage `json:"allow_negative_stock"` // null goes back to the store setting
+}
+
+// PatchProduct changes only the fields in the body. With If-Match set to
+// the ETag of a GET, the change is refused with 412 when someone else has
+// edited the product since.
+func (h *ProductHandler) PatchProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var req patchProductRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	patch := repositories.ProductPatch{
 		Name:  req.Name,
 		SKU:   req.SKU,
 		Price: req.Price,
+		Cost:  req.Cost,
 		Stock: req.Stock,
+		Unit:  req.Unit,
+		PLU:   req.PLU,
+	}
+	if (patch.Name != nil && *patch.Name == "") || (patch.SKU != nil && *patch.SKU == "") {
+		writeError(w, http.StatusBadRequest, "name and sku cannot be empty")
+		return
+	}
+	if patch.Cost != nil && *patch.Cost < 0 {
+		writeError(w, http.StatusBadRequest, "cost cannot be negative")
+		return
+	}
+	if patch.Unit != nil {
+		unit := strings.TrimSpace(*patch.Unit)
+		patch.Unit = &unit
+	}
+	if patch.PLU != nil {
+		plu := strings.TrimSpace(*patch.PLU)
+		if !isPLU(plu) {
+			writeError(w, http.StatusBadRequest, "plu must be digits only")
+			return
+		}
+		patch.PLU = &plu
+	}
+	if req.CategoryID != nil {
+		patch.SetCategoryID = true
+		if err := json.Unmarshal(req.CategoryID, &patch.CategoryID); err != nil {
+			writeError(w, http.StatusBadRequest, "category_id must be a number or null")
+			return
+		}
+	}
+	if req.AllowNegativeStock != nil {
+		patch.SetAllowNegativeStock = true
+		if err := json.Unmarshal(req.AllowNegativeStock, &patch.AllowNegativeStock); err != nil {
+			writeError(w, http.StatusBadRequest, "allow_negative_stock must be true, false or null")
+			return
+		}
 	}
 
-	if err := h.repo.Update(r.Context(), p); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to update product")
+	version, ok := ifMatchVersion(r)
+	if !ok {
+		writeError(w, http.StatusPreconditionFailed, "product was changed since it was read")
 		return
 	}
 
-	writeJSON(w, http.StatusOK, p)
+	product, err := h.repo.Patch(r.Context(), id, patch, version)
+	if err != nil {
+		writeProductUpdateError(w, err)
+		return
+	}
+
+	w.Header().Set("ETag", productETag(product.Version))
+	writeJSON(w, http.StatusOK, product)
+}
+
+func writeProductUpdateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		writeError(w, http.StatusNotFound, "product not found")
+	case errors.Is(err, repositories.ErrVersionConflict):
+		writeError(w, http.StatusPreconditionFailed, "product was changed since it was read")
+	case errors.Is(err, repositories.ErrPLUTaken), errors.Is(err, repositories.ErrSKUTaken):
+		writeError(w, http.StatusConflict, err.Error())
+	case errors.Is(err, repositories.ErrCategoryNotFound):
+		writeError(w, http.StatusBadRequest, "category not found")
+	case errors.Is(err, repositories.ErrUnitNotFound):
+		writeError(w, http.StatusBadRequest, "unit not found")
+	case errors.Is(err, repositories.ErrInvalidQuantity):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to update product")
+	}
 }
 
 func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
@@ -145,21 +490,157 @@ func (h *ProductHandler) DeleteProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.repo.Delete(r.Context(), id); err != nil {
-		writeError(w, http.StatusInternalServerError, "failed to delete product")
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "product not found")
+		case errors.Is(err, repositories.ErrProductInUse):
+			writeError(w, http.StatusConflict, "product has sales or other records referring to it; archive it instead")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to delete product")
+		}
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// ArchiveProduct takes a product off the POS without losing its history.
+func (h *ProductHandler) ArchiveProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	product, err := h.repo.Archive(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "product not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to archive product")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, product)
+}
+
+func (h *ProductHandler) UnarchiveProduct(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	product, err := h.repo.Unarchive(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "product not found")
+		case errors.Is(err, repositories.ErrParentArchived):
+			writeError(w, http.StatusConflict, "the parent product is archived; unarchive it first")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to unarchive product")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, product)
+}
+
+func (h *ProductHandler) GetVariants(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	product, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "product not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch variants")
+		return
+	}
+
+	variants := product.Variants
+	if variants == nil {
+		variants = []models.Product{}
+	}
+	writeJSON(w, http.StatusOK, variants)
+}
+
+type generateVariantsRequest struct {
+	Options []struct {
+		Name   string `json:"name"`
+		Values []struct {
+			Value string `json:"value"`
+			Code  string `json:"code,omitempty"` // SKU part; derived from the value when omitted
+		} `json:"values"`
+	} `json:"options"`
+	SKUPattern string `json:"sku_pattern,omitempty"` // e.g. "{sku}-{Size}-{Color}"
+}
+
+// GenerateVariants sets a product's option types and creates the missing
+// variants of their matrix.
+func (h *ProductHandler) GenerateVariants(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var req generateVariantsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	params := repositories.GenerateVariantsParams{SKUPattern: strings.TrimSpace(req.SKUPattern)}
+	for _, o := range req.Options {
+		option := models.ProductOption{Name: o.Name}
+		for _, v := range o.Values {
+			option.Values = append(option.Values, models.ProductOptionValue{Value: v.Value, Code: v.Code})
+		}
+		params.Options = append(params.Options, option)
+	}
+
+	matrix, err := h.repo.GenerateVariants(r.Context(), id, params)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "product not found")
+		case errors.Is(err, repositories.ErrInvalidOptions),
+			errors.Is(err, repositories.ErrInvalidSKUPattern),
+			errors.Is(err, repositories.ErrTooManyVariants),
+			errors.Is(err, repositories.ErrVariantOfVariant):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, repositories.ErrOptionsMismatch),
+			errors.Is(err, repositories.ErrSKUTaken):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to generate variants")
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if len(matrix.Created) > 0 {
+		status = http.StatusCreated
+	}
+	writeJSON(w, status, matrix)
+}
+
 func (h *ProductHandler) GetLowStockProducts(w http.ResponseWriter, r *http.Request) {
 	thresholdStr := r.URL.Query().Get("threshold")
-	var threshold int64 = 5 // default
+	var threshold float64 = 5 // default
 
 	if thresholdStr != "" {
-		val, err := strconv.ParseInt(thresholdStr, 10, 64)
+		val, err := strconv.ParseFloat(thresholdStr, 64)
 		if err != nil || val < 0 {
-			writeError(w, http.StatusBadRequest, "threshold must be a non-negative integer")
+			writeError(w, http.StatusBadRequest, "threshold must be a non-negative number")
 			return
 		}
 		threshold = val
@@ -173,3 +654,545 @@ func (h *ProductHandler) GetLowStockProducts(w http.ResponseWriter, r *http.Requ
 
 	writeJSON(w, http.StatusOK, products)
 }
+
+// ExportProducts downloads the catalog as CSV, in the format
+// ImportProducts reads.
+func (h *ProductHandler) ExportProducts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="products.csv"`)
+
+	// the header is already out by the time a row could fail, so a failed
+	// export can only be logged; the client gets a truncated file
+	if err := h.repo.ExportCSV(r.Context(), w); err != nil {
+		log.Printf("export products: %v", err)
+	}
+}
+
+// maxImportSize bounds an uploaded catalog file.
+const maxImportSize = 10 << 20
+
+// ImportProducts creates and updates products by SKU from a CSV file,
+// either as the request body or as the "file" field of a multipart form.
+// With dry_run=true it only reports what would change. A file with any
+// invalid row is rejected whole, with the same per-row report.
+func (h *ProductHandler) ImportProducts(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "dry_run must be true or false")
+			return
+		}
+		dryRun = b
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	var file io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, http.StatusRequestEntityTooLarge, "the file is larger than 10 MB")
+				return
+			}
+			writeError(w, http.StatusBadRequest, "a CSV file is required in the file field")
+			return
+		}
+		defer f.Close()
+		file = f
+	}
+
+	result, err := h.repo.ImportCSV(r.Context(), file, dryRun)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			writeError(w, http.StatusRequestEntityTooLarge, "the file is larger than 10 MB")
+		case errors.Is(err, repositories.ErrInvalidCSV):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to import products")
+		}
+		return
+	}
+
+	status := http.StatusOK
+	if result.Invalid > 0 && !dryRun {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, result)
+}
+
+func (h *ProductHandler) GetProductByBarcode(w http.ResponseWriter, r *http.Request) {
+	// codes may hold characters that arrive escaped, e.g. "/" in Code 128
+	code, err := url.PathUnescape(chi.URLParam(r, "code"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid barcode")
+		return
+	}
+
+	scan, err := h.repo.GetByBarcode(r.Context(), code)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no product has this barcode")
+			return
+		}
+		if errors.Is(err, barcode.ErrInvalid) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to look up barcode")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, scan)
+}
+
+type addBarcodeRequest struct {
+	Code         string  `json:"code"`
+	Symbology    string  `json:"symbology,omitempty"`     // detected from the code when omitted
+	PackQuantity float64 `json:"pack_quantity,omitempty"` // defaults to 1
+}
+
+func (h *ProductHandler) AddBarcode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var req addBarcodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.PackQuantity < 0 {
+		writeError(w, http.StatusBadRequest, "pack_quantity must be > 0")
+		return
+	}
+
+	b := &models.Barcode{
+		ProductID:    id,
+		Code:         req.Code,
+		Symbology:    strings.TrimSpace(strings.ToLower(req.Symbology)),
+		PackQuantity: req.PackQuantity,
+	}
+
+	if err := h.repo.AddBarcode(r.Context(), b); err != nil {
+		switch {
+		case errors.Is(err, barcode.ErrInvalid):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, repositories.ErrBarcodeTaken):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "product not found")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to add barcode")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, b)
+}
+
+func (h *ProductHandler) DeleteBarcode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+	barcodeID, err := strconv.ParseInt(chi.URLParam(r, "barcodeID"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid barcode id")
+		return
+	}
+
+	if err := h.repo.DeleteBarcode(r.Context(), id, barcodeID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "barcode not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete barcode")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type addUnitRequest struct {
+	Name   string  `json:"name"`   // e.g. "case"
+	Factor float64 `json:"factor"` // how many of the product's unit it holds
+}
+
+func (h *ProductHandler) AddUnit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var req addUnitRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	u := &models.ProductUnit{ProductID: id, Name: req.Name, Factor: req.Factor}
+
+	if err := h.repo.AddUnit(r.Context(), u); err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrInvalidUnit):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, repositories.ErrProductUnitTaken):
+			writeError(w, http.StatusConflict, err.Error())
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "product not found")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to add unit")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, u)
+}
+
+func (h *ProductHandler) DeleteUnit(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+	unitID, err := strconv.ParseInt(chi.URLParam(r, "unitID"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid unit id")
+		return
+	}
+
+	if err := h.repo.DeleteUnit(r.Context(), id, unitID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "unit not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete unit")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type receiveStockRequest struct {
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit,omitempty"` // a purchase unit; omit for the product's own unit
+}
+
+// ReceiveStock books a delivery, converting purchase units into the
+// product's stock unit.
+func (h *ProductHandler) ReceiveStock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var req receiveStockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	product, err := h.repo.ReceiveStock(r.Context(), id, req.Quantity, req.Unit)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "product not found")
+		case errors.Is(err, repositories.ErrUnitNotFound):
+			writeError(w, http.StatusBadRequest, "the product has no unit named "+strconv.Quote(req.Unit))
+		case errors.Is(err, repositories.ErrInvalidQuantity):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to receive stock")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, product)
+}
+
+type setComponentsRequest struct {
+	Components []struct {
+		ProductID int64   `json:"product_id"`
+		Quantity  float64 `json:"quantity"`
+	} `json:"components"` // empty turns the kit back into a plain product
+}
+
+// SetComponents makes the product a kit of the given components, or a
+// plain product again when the list is empty.
+func (h *ProductHandler) SetComponents(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var req setComponentsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	components := make([]models.KitComponent, len(req.Components))
+	for i, c := range req.Components {
+		components[i] = models.KitComponent{ProductID: c.ProductID, Quantity: c.Quantity}
+	}
+
+	if err := h.repo.SetComponents(r.Context(), id, components); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "product not found")
+		case errors.Is(err, repositories.ErrKitComponentNotFound),
+			errors.Is(err, repositories.ErrInvalidKit),
+			errors.Is(err, repositories.ErrKitNesting):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to set kit components")
+		}
+		return
+	}
+
+	product, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch product")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, product)
+}
+
+// GetPriceHistory returns the prices a product has had and the changes
+// scheduled for it.
+func (h *ProductHandler) GetPriceHistory(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	history, err := h.repo.PriceHistory(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "product not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch price history")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
+
+type schedulePriceRequest struct {
+	ProductID   int64     `json:"product_id"` // taken from the path on /products/{id}/prices
+	Price       float64   `json:"price"`
+	EffectiveAt time.Time `json:"effective_at"` // RFC 3339, in the future
+}
+
+// SchedulePrice sets a product's price from a future time on.
+func (h *ProductHandler) SchedulePrice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid product id")
+		return
+	}
+
+	var req schedulePriceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	changes, err := h.repo.SchedulePriceChanges(r.Context(), []models.PriceChange{
+		{ProductID: id, Price: req.Price, EffectiveAt: req.EffectiveAt},
+	})
+	if err != nil {
+		if errors.Is(err, repositories.ErrProductNotFound) {
+			writeError(w, http.StatusNotFound, "product not found")
+			return
+		}
+		writePriceChangeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, changes[0])
+}
+
+type schedulePriceChangesRequest struct {
+	Changes []schedulePriceRequest `json:"changes"`
+}
+
+// SchedulePriceChanges schedules a batch of price changes, e.g. next
+// week's promotion, all at once or none at all.
+func (h *ProductHandler) SchedulePriceChanges(w http.ResponseWriter, r *http.Request) {
+	var req schedulePriceChangesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	changes := make([]models.PriceChange, len(req.Changes))
+	for i, c := range req.Changes {
+		changes[i] = models.PriceChange{ProductID: c.ProductID, Price: c.Price, EffectiveAt: c.EffectiveAt}
+	}
+
+	scheduled, err := h.repo.SchedulePriceChanges(r.Context(), changes)
+	if err != nil {
+		writePriceChangeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, scheduled)
+}
+
+func writePriceChangeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrInvalidPriceChange), errors.Is(err, repositories.ErrProductNotFound):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "failed to schedule price changes")
+	}
+}
+
+// GetPriceChanges lists price changes by status, scheduled ones by
+// default, optionally for one product_id.
+func (h *ProductHandler) GetPriceChanges(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	status := q.Get("status")
+	switch status {
+	case "":
+		status = repositories.PriceChangeScheduled
+	case repositories.PriceChangeScheduled, repositories.PriceChangeApplied, repositories.PriceChangeCancelled:
+	default:
+		writeError(w, http.StatusBadRequest, "status must be scheduled, applied or cancelled")
+		return
+	}
+
+	var productID int64
+	if v := q.Get("product_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			writeError(w, http.StatusBadRequest, "product_id must be a positive integer")
+			return
+		}
+		productID = id
+	}
+
+	changes, err := h.repo.GetPriceChanges(r.Context(), status, productID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch price changes")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, changes)
+}
+
+// CancelPriceChange withdraws a scheduled price change.
+func (h *ProductHandler) CancelPriceChange(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid price change id")
+		return
+	}
+
+	change, err := h.repo.CancelPriceChange(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			writeError(w, http.StatusNotFound, "price change not found")
+		case errors.Is(err, repositories.ErrPriceChangeNotScheduled):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to cancel price change")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, change)
+}
+
+func isPLU(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (h *ProductHandler) GetBarcodeRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := h.repo.GetBarcodeRules(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch barcode rules")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rules)
+}
+
+type createBarcodeRuleRequest struct {
+	Prefix        string `json:"prefix"`
+	PLULength     int    `json:"plu_length"`
+	ValueKind     string `json:"value_kind"` // "weight" or "price"
+	ValueLength   int    `json:"value_length"`
+	ValueDecimals int    `json:"value_decimals"`
+}
+
+func (h *ProductHandler) CreateBarcodeRule(w http.ResponseWriter, r *http.Request) {
+	var req createBarcodeRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	rule := &models.BarcodeRule{
+		Prefix:        strings.TrimSpace(req.Prefix),
+		PLULength:     req.PLULength,
+		ValueKind:     strings.TrimSpace(strings.ToLower(req.ValueKind)),
+		ValueLength:   req.ValueLength,
+		ValueDecimals: req.ValueDecimals,
+	}
+
+	if err := h.repo.CreateBarcodeRule(r.Context(), rule); err != nil {
+		switch {
+		case errors.Is(err, barcode.ErrInvalidLayout):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, repositories.ErrBarcodeRuleExists):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to create barcode rule")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, rule)
+}
+
+func (h *ProductHandler) DeleteBarcodeRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid barcode rule id")
+		return
+	}
+
+	if err := h.repo.DeleteBarcodeRule(r.Context(), id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "barcode rule not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete barcode rule")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"pos-backend/internal/auth"
+	"pos-backend/internal/database"
+	"pos-backend/internal/models"
+	"pos-backend/internal/repositories"
+)
+
+// newProductTestServer serves the product, sale and parked sale routes on a
+// fresh database file and returns a manager token for it.
+func newProductTestServer(t *testing.T) (*httptest.Server, *sql.DB, string) {
+	t.Helper()
+
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "pos.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	res, err := db.Exec(`INSERT INTO users (name, email, password_hash, role) VALUES ('Back Office', 'office@example.com', 'x', 'manager')`)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	userID, _ := res.LastInsertId()
+
+	token, err := auth.GenerateToken(userID, "manager", "", testJWTSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	sales := repositories.NewSaleRepository(db, repositories.PricingConfig{}, repositories.ReceiptConfig{
+		Prefix:      "R",
+		StoreCode:   "T",
+		Scope:       repositories.ReceiptScopeStore,
+		YearlyReset: true,
+	})
+
+	r := chi.NewRouter()
+	NewProductHandler(repositories.NewProductRepository(db)).RegisterRoutes(r)
+	NewSaleHandler(sales, testJWTSecret).RegisterRoutes(r)
+	NewParkedSaleHandler(repositories.NewParkedSaleRepository(db), time.Hour).RegisterRoutes(r)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	return srv, db, token
+}
+
+// productStock reads the stock the product listing shows for id.
+func productStock(t *testing.T, srv *httptest.Server, token string, id int64) float64 {
+	t.Helper()
+
+	status, body := doRequest(t, srv, token, http.MethodGet, fmt.Sprintf("/products/%d", id), "")
+	if status != http.StatusOK {
+		t.Fatalf("get product %d: status %d (%s)", id, status, body)
+	}
+	var p struct {
+		Stock float64 `json:"stock"`
+	}
+	if err := json.Unmarshal([]byte(body), &p); err != nil {
+		t.Fatalf("decode product: %v", err)
+	}
+	return p.Stock
+}
+
+func TestKitStock(t *testing.T) {
+	srv, db, token := newProductTestServer(t)
+
+	bun := insertTestProduct(t, db, "BUN", 10, nil)
+	patty := insertTestProduct(t, db, "PATTY", 3, nil)
+	kit := insertTestProduct(t, db, "BURGER", 0, nil)
+
+	body := fmt.Sprintf(`{"components":[{"product_id":%d,"quantity":2},{"product_id":%d,"quantity":1}]}`, bun, patty)
+	if status, resp := doRequest(t, srv, token, http.MethodPut, fmt.Sprintf("/products/%d/components", kit), body); status != http.StatusOK {
+		t.Fatalf("set components: status %d (%s)", status, resp)
+	}
+
+	steps := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		status   int
+		kitStock float64
+	}{
+		{"components make up three", "", "", "", 0, 3},
+		{
+			"a parked cart holds a patty",
+			http.MethodPost, "/parked-sales",
+			fmt.Sprintf(`{"label":"hold","reserve_stock":true,"items":[{"product_id":%d,"quantity":1}]}`, patty),
+			http.StatusCreated, 2,
+		},
+		{
+			"selling two kits",
+			http.MethodPost, "/sales",
+			fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":2}],"payment_method":"cash","paid_amount":20}`, kit),
+			http.StatusCreated, 0,
+		},
+		{
+			"the held patty is not sold",
+			http.MethodPost, "/sales",
+			fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":1}],"payment_method":"cash","paid_amount":10}`, kit),
+			http.StatusConflict, 0,
+		},
+	}
+
+	for _, s := range steps {
+		if s.method != "" {
+			if status, resp := doRequest(t, srv, token, s.method, s.path, s.body); status != s.status {
+				t.Fatalf("%s: status %d, want %d (%s)", s.name, status, s.status, resp)
+			}
+		}
+		if got := productStock(t, srv, token, kit); got != s.kitStock {
+			t.Errorf("%s: kit stock = %v, want %v", s.name, got, s.kitStock)
+		}
+	}
+
+	var bunsLeft, pattiesLeft float64
+	if err := db.QueryRow(`SELECT stock FROM products WHERE id = ?`, bun).Scan(&bunsLeft); err != nil {
+		t.Fatalf("read stock: %v", err)
+	}
+	if err := db.QueryRow(`SELECT stock FROM products WHERE id = ?`, patty).Scan(&pattiesLeft); err != nil {
+		t.Fatalf("read stock: %v", err)
+	}
+	if bunsLeft != 6 || pattiesLeft != 1 {
+		t.Errorf("components left = %v buns, %v patties; want 6, 1", bunsLeft, pattiesLeft)
+	}
+}
+
+func TestImportProducts(t *testing.T) {
+	const file = "sku,name,price,stock\nCSV-1,Tea,2.50,10\ncsv-1,Green tea,3,5\nEXIST,Renamed,10,7\n"
+
+	tests := []struct {
+		name     string
+		query    string
+		file     string
+		status   int
+		applied  bool
+		invalid  int
+		products int
+	}{
+		{"dry run", "?dry_run=true", file, http.StatusOK, false, 0, 1},
+		// SKUs match exactly, so CSV-1 and csv-1 are two products
+		{"import", "", file, http.StatusOK, true, 0, 3},
+		{"repeated sku", "", file + "CSV-1,Again,1,1\n", http.StatusUnprocessableEntity, false, 1, 1},
+		{"repeated sku dry run", "?dry_run=true", file + "CSV-1,Again,1,1\n", http.StatusOK, false, 1, 1},
+		{"bad price", "", "sku,price\nCSV-2,abc\n", http.StatusUnprocessableEntity, false, 1, 1},
+		{"no sku column", "", "name,price\nTea,1\n", http.StatusBadRequest, false, 0, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, db, token := newProductTestServer(t)
+			existing := insertTestProduct(t, db, "EXIST", 1, nil)
+
+			status, body := doRequest(t, srv, token, http.MethodPost, "/products/import"+tt.query, tt.file, "Content-Type", "text/csv")
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", status, tt.status, body)
+			}
+
+			if status != http.StatusBadRequest {
+				var result repositories.ProductImportResult
+				if err := json.Unmarshal([]byte(body), &result); err != nil {
+					t.Fatalf("decode result: %v", err)
+				}
+				if result.Applied != tt.applied || result.Invalid != tt.invalid {
+					t.Errorf("applied, invalid = %v, %d; want %v, %d", result.Applied, result.Invalid, tt.applied, tt.invalid)
+				}
+			}
+
+			var products int
+			if err := db.QueryRow(`SELECT COUNT(*) FROM products`).Scan(&products); err != nil {
+				t.Fatalf("count products: %v", err)
+			}
+			if products != tt.products {
+				t.Errorf("products = %d, want %d", products, tt.products)
+			}
+
+			var name string
+			if err := db.QueryRow(`SELECT name FROM products WHERE id = ?`, existing).Scan(&name); err != nil {
+				t.Fatalf("read product: %v", err)
+			}
+			want := "EXIST"
+			if tt.applied {
+				want = "Renamed"
+			}
+			if name != want {
+				t.Errorf("existing product name = %q, want %q", name, want)
+			}
+		})
+	}
+}
+
+func TestDeleteProduct(t *testing.T) {
+	srv, db, token := newProductTestServer(t)
+
+	unsold := insertTestProduct(t, db, "UNSOLD", 5, nil)
+	sold := insertTestProduct(t, db, "SOLD", 5, nil)
+	sale := fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":1}],"payment_method":"cash","paid_amount":10}`, sold)
+	if status, resp := doRequest(t, srv, token, http.MethodPost, "/sales", sale); status != http.StatusCreated {
+		t.Fatalf("create sale: status %d (%s)", status, resp)
+	}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"unsold", fmt.Sprintf("/products/%d", unsold), http.StatusNoContent},
+		{"already deleted", fmt.Sprintf("/products/%d", unsold), http.StatusNotFound},
+		{"never existed", "/products/9999", http.StatusNotFound},
+		{"has sales", fmt.Sprintf("/products/%d", sold), http.StatusConflict},
+		{"bad id", "/products/abc", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if status, resp := doRequest(t, srv, token, http.MethodDelete, tt.path, ""); status != tt.status {
+				t.Errorf("status = %d, want %d (%s)", status, tt.status, resp)
+			}
+		})
+	}
+
+	// the sold product is still there, with its sale
+	if got := productStock(t, srv, token, sold); got != 4 {
+		t.Errorf("sold product stock = %v, want 4", got)
+	}
+}
+
+func TestUpdateProductIfMatch(t *testing.T) {
+	srv, db, token := newProductTestServer(t)
+
+	id := insertTestProduct(t, db, "EDIT", 5, nil)
+	path := fmt.Sprintf("/products/%d", id)
+
+	var read int64
+	if err := db.QueryRow(`SELECT version FROM products WHERE id = ?`, id).Scan(&read); err != nil {
+		t.Fatalf("read version: %v", err)
+	}
+	stale := productETag(read)
+
+	// a sale moves the stock an edit read at the old version would overwrite
+	sale := fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":1}],"payment_method":"cash","paid_amount":10}`, id)
+	if status, resp := doRequest(t, srv, token, http.MethodPost, "/sales", sale); status != http.StatusCreated {
+		t.Fatalf("create sale: status %d (%s)", status, resp)
+	}
+	current := productETag(read + 1)
+
+	const put = `{"name":"Edited","sku":"EDIT","price":12,"stock":5}`
+	tests := []struct {
+		name    string
+		method  string
+		body    string
+		ifMatch string
+		status  int
+	}{
+		{"put without If-Match", http.MethodPut, put, "", http.StatusPreconditionRequired},
+		{"put at the version before the sale", http.MethodPut, put, stale, http.StatusPreconditionFailed},
+		{"patch at the version before the sale", http.MethodPatch, `{"price":11}`, stale, http.StatusPreconditionFailed},
+		{"put at the current version", http.MethodPut, put, current, http.StatusOK},
+		{"put over any version", http.MethodPut, put, "*", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headers []string
+			if tt.ifMatch != "" {
+				headers = []string{"If-Match", tt.ifMatch}
+			}
+			if status, resp := doRequest(t, srv, token, tt.method, path, tt.body, headers...); status != tt.status {
+				t.Errorf("status = %d, want %d (%s)", status, tt.status, resp)
+			}
+		})
+	}
+
+	var price float64
+	if err := db.QueryRow(`SELECT price FROM products WHERE id = ?`, id).Scan(&price); err != nil {
+		t.Fatalf("read price: %v", err)
+	}
+	if price != 12 {
+		t.Errorf("price = %v, want 12", price)
+	}
+}
+
+func TestGetProductsUnpaged(t *testing.T) {
+	srv, db, token := newProductTestServer(t)
+
+	if _, err := db.Exec(`INSERT INTO products (name, sku, price, stock) VALUES ('Green tea', 'TEA-1', 3, 5), ('Black coffee', 'COF-1', 4, 5)`); err != nil {
+		t.Fatalf("insert products: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"sort=name", 2},
+		{"q=green", 1},
+		{"q=gren", 1}, // a typo falls back to the fuzzy search
+		{"q=zzzz", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			status, resp := doRequest(t, srv, token, http.MethodGet, "/products?"+tt.query, "")
+			if status != http.StatusOK {
+				t.Fatalf("unpaged: status %d (%s)", status, resp)
+			}
+			var products []models.Product
+			if err := json.Unmarshal([]byte(resp), &products); err != nil {
+				t.Fatalf("decode products: %v", err)
+			}
+			if len(products) != tt.want {
+				t.Errorf("unpaged listing has %d products, want %d", len(products), tt.want)
+			}
+
+			status, resp = doRequest(t, srv, token, http.MethodGet, "/products?limit=10&"+tt.query, "")
+			if status != http.StatusOK {
+				t.Fatalf("paged: status %d (%s)", status, resp)
+			}
+			var page repositories.ProductPage
+			if err := json.Unmarshal([]byte(resp), &page); err != nil {
+				t.Fatalf("decode page: %v", err)
+			}
+			if len(page.Items) != tt.want || page.TotalCount != int64(tt.want) {
+				t.Errorf("page has %d products of %d, want %d", len(page.Items), page.TotalCount, tt.want)
+			}
+		})
+	}
+}
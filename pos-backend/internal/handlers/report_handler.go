@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 	"time"
@@ -22,6 +23,9 @@ func (h *ReportHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/reports/summary", h.GetSummary)
 	r.Get("/reports/daily", h.GetDaily)
 	r.Get("/reports/top-products", h.GetTopProducts)
+	r.Get("/reports/categories", h.GetCategorySales)
+	r.Get("/reports/tips", h.GetTipsPayout)
+	r.Get("/reports/gross-profit", h.GetGrossProfit)
 }
 
 const dateLayout = "2006-01-02"
@@ -51,6 +55,40 @@ func parseDateRange(r *http.Request) (time.Time, time.Time, error) {
 	return from, to, nil
 }
 
+// parseReportFilter reads the date range plus the optional user_id
+// (cashier) filter shared by all reports.
+func parseReportFilter(r *http.Request) (repositories.ReportFilter, error) {
+	from, to, err := parseDateRange(r)
+	if err != nil {
+		return repositories.ReportFilter{}, err
+	}
+
+	f := repositories.ReportFilter{From: from, To: to}
+
+	if v := r.URL.Query().Get("user_id"); v != "" {
+		userID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || userID <= 0 {
+			return repositories.ReportFilter{}, errBadUserID
+		}
+		f.UserID = userID
+	}
+
+	if v := r.URL.Query().Get("shift_id"); v != "" {
+		shiftID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || shiftID <= 0 {
+			return repositories.ReportFilter{}, errBadShiftID
+		}
+		f.ShiftID = shiftID
+	}
+
+	return f, nil
+}
+
+var (
+	errBadUserID  = errors.New("user_id must be a positive integer")
+	errBadShiftID = errors.New("shift_id must be a positive integer")
+)
+
 var ErrBadDateRange = &badDateRangeError{}
 
 type badDateRangeError struct{}
@@ -60,13 +98,13 @@ func (e *badDateRangeError) Error() string {
 }
 
 func (h *ReportHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
-	from, to, err := parseDateRange(r)
+	f, err := parseReportFilter(r)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	summary, err := h.repo.SalesSummary(r.Context(), from, to)
+	summary, err := h.repo.SalesSummary(r.Context(), f)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to fetch summary report")
 		return
@@ -76,13 +114,13 @@ func (h *ReportHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ReportHandler) GetDaily(w http.ResponseWriter, r *http.Request) {
-	from, to, err := parseDateRange(r)
+	f, err := parseReportFilter(r)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	rows, err := h.repo.DailySales(r.Context(), from, to)
+	rows, err := h.repo.DailySales(r.Context(), f)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to fetch daily report")
 		return
@@ -92,7 +130,7 @@ func (h *ReportHandler) GetDaily(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *ReportHandler) GetTopProducts(w http.ResponseWriter, r *http.Request) {
-	from, to, err := parseDateRange(r)
+	f, err := parseReportFilter(r)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
@@ -109,7 +147,17 @@ func (h *ReportHandler) GetTopProducts(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	rows, err := h.repo.TopProducts(r.Context(), from, to, limit)
+	// level=parent counts variant sales towards their parent product,
+	// level=component splits kits into their components
+	level := r.URL.Query().Get("level")
+	switch level {
+	case "", repositories.ProductLevelVariant, repositories.ProductLevelParent, repositories.ProductLevelComponent:
+	default:
+		writeError(w, http.StatusBadRequest, "level must be parent, variant or component")
+		return
+	}
+
+	rows, err := h.repo.TopProducts(r.Context(), f, level, limit)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to fetch top products")
 		return
@@ -117,3 +165,85 @@ func (h *ReportHandler) GetTopProducts(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, rows)
 }
+
+// GetCategorySales rolls revenue up the category tree. parent_id narrows
+// the rows to that category's direct subcategories.
+func (h *ReportHandler) GetCategorySales(w http.ResponseWriter, r *http.Request) {
+	f, err := parseReportFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var parentID int64
+	if v := r.URL.Query().Get("parent_id"); v != "" {
+		parentID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || parentID <= 0 {
+			writeError(w, http.StatusBadRequest, "parent_id must be a positive integer")
+			return
+		}
+	}
+
+	rows, err := h.repo.CategorySales(r.Context(), f, parentID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch category report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rows)
+}
+
+// GetTipsPayout reports tips per shift and employee or pool. Filters are
+// the usual date range plus shift_id and recipient_id (the tipped employee).
+func (h *ReportHandler) GetTipsPayout(w http.ResponseWriter, r *http.Request) {
+	f, err := parseReportFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var recipientID int64
+	if v := r.URL.Query().Get("recipient_id"); v != "" {
+		recipientID, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || recipientID <= 0 {
+			writeError(w, http.StatusBadRequest, "recipient_id must be a positive integer")
+			return
+		}
+	}
+
+	rows, err := h.repo.TipsPayout(r.Context(), f, recipientID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch tips report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rows)
+}
+
+// GetGrossProfit reports gross profit and margin by product, category,
+// day or cashier (group_by, product by default).
+func (h *ReportHandler) GetGrossProfit(w http.ResponseWriter, r *http.Request) {
+	f, err := parseReportFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	groupBy := r.URL.Query().Get("group_by")
+	switch groupBy {
+	case "":
+		groupBy = repositories.GroupByProduct
+	case repositories.GroupByProduct, repositories.GroupByCategory, repositories.GroupByDay, repositories.GroupByCashier:
+	default:
+		writeError(w, http.StatusBadRequest, "group_by must be product, category, day or cashier")
+		return
+	}
+
+	rows, err := h.repo.GrossProfit(r.Context(), f, groupBy)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch gross profit report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, rows)
+}
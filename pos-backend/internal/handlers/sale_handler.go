@@ -6,6 +6,8 @@ import (
 	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -13,97 +15,526 @@ import (
 )
 
 type SaleHandler struct {
-	repo *repositories.SaleRepository
+	repo      *repositories.SaleRepository
+	jwtSecret string
 }
 
-func NewSaleHandler(repo *repositories.SaleRepository) *SaleHandler {
-	return &SaleHandler{repo: repo}
+func NewSaleHandler(repo *repositories.SaleRepository, jwtSecret string) *SaleHandler {
+	return &SaleHandler{repo: repo, jwtSecret: jwtSecret}
 }
 
 func (h *SaleHandler) RegisterRoutes(r chi.Router) {
 	r.Get("/sales", h.GetSales)
 	r.Post("/sales", h.CreateSale)
+	r.Post("/sales/quote", h.QuoteSale)
 	r.Get("/sales/{id}", h.GetSaleByID)
+	r.Post("/sales/{id}/exchange", h.CreateExchange)
+	r.Post("/sales/{id}/exchange/quote", h.QuoteExchange)
 }
 
 type createSaleItemRequest struct {
 	ProductID int64    `json:"product_id"`
-	Quantity  int64    `json:"quantity"`
+	Barcode   string   `json:"barcode,omitempty"`    // scanned code, instead of product_id
+	Quantity  float64  `json:"quantity"`             // scans for a barcode line, defaults to 1
 	UnitPrice *float64 `json:"unit_price,omitempty"` // optional override
 }
 
+type tenderRequest struct {
+	Method    string  `json:"method"`
+	Amount    float64 `json:"amount"`
+	TipAmount float64 `json:"tip_amount,omitempty"`
+	TipUserID int64   `json:"tip_user_id,omitempty"` // defaults to the cashier
+	TipPool   string  `json:"tip_pool,omitempty"`
+}
+
+// createSaleRequest accepts either a single payment (payment_method,
+// paid_amount and optionally tip_amount) or a list of split tenders.
 type createSaleRequest struct {
 	Items         []createSaleItemRequest `json:"items"`
 	PaymentMethod string                  `json:"payment_method"`
 	PaidAmount    float64                 `json:"paid_amount"`
+	TipAmount     float64                 `json:"tip_amount,omitempty"`
+	TipPool       string                  `json:"tip_pool,omitempty"`
+	Tenders       []tenderRequest         `json:"tenders,omitempty"`
+	TerminalID    string                  `json:"terminal_id,omitempty"`
+	ParkedSaleID  int64                   `json:"parked_sale_id,omitempty"` // resumed cart being rung up
 }
 
-func (h *SaleHandler) CreateSale(w http.ResponseWriter, r *http.Request) {
+type returnItemRequest struct {
+	SaleItemID int64   `json:"sale_item_id,omitempty"`
+	ProductID  int64   `json:"product_id,omitempty"` // used when sale_item_id is not given
+	Quantity   float64 `json:"quantity"`
+}
+
+// exchangeRequest takes the lines coming back and the new lines in one go.
+// Payment fields are only needed when the new lines cost more; when they
+// cost less the difference is refunded with refund_method (default cash).
+type exchangeRequest struct {
+	createSaleRequest
+	ReturnedItems []returnItemRequest `json:"returned_items"`
+	RefundMethod  string              `json:"refund_method,omitempty"`
+}
+
+// parseSaleItems validates cart lines shared by sales, quotes and parked
+// carts. It returns a client-facing message when a line is unusable.
+func parseSaleItems(reqItems []createSaleItemRequest) ([]repositories.CreateSaleItemParam, string) {
+	if len(reqItems) == 0 {
+		return nil, "at least one item is required"
+	}
+
+	var items []repositories.CreateSaleItemParam
+	for _, it := range reqItems {
+		it.Barcode = strings.TrimSpace(it.Barcode)
+		if it.Barcode != "" {
+			// the barcode decides the product
+			it.ProductID = 0
+			if it.Quantity == 0 {
+				it.Quantity = 1
+			}
+		} else if it.ProductID <= 0 {
+			return nil, "invalid product_id"
+		}
+		if it.Quantity <= 0 {
+			return nil, "quantity must be > 0"
+		}
+		items = append(items, repositories.CreateSaleItemParam{
+			ProductID:         it.ProductID,
+			Barcode:           it.Barcode,
+			Quantity:          it.Quantity,
+			UnitPriceOverride: it.UnitPrice,
+		})
+	}
+
+	return items, ""
+}
+
+func parseTenders(req *createSaleRequest) ([]repositories.TenderParam, string) {
+	reqTenders := req.Tenders
+	if len(reqTenders) == 0 {
+		reqTenders = []tenderRequest{{
+			Method:    req.PaymentMethod,
+			Amount:    req.PaidAmount,
+			TipAmount: req.TipAmount,
+			TipPool:   req.TipPool,
+		}}
+	}
+
+	var tenders []repositories.TenderParam
+	for _, t := range reqTenders {
+		method := strings.TrimSpace(strings.ToLower(t.Method))
+		if method == "" {
+			return nil, "payment_method is required"
+		}
+		if t.Amount < 0 {
+			return nil, "paid_amount must be >= 0"
+		}
+		if t.TipAmount < 0 {
+			return nil, "tip_amount must be >= 0"
+		}
+		pool := strings.TrimSpace(t.TipPool)
+		if pool != "" && t.TipUserID != 0 {
+			return nil, "tip_user_id and tip_pool cannot both be set"
+		}
+		tenders = append(tenders, repositories.TenderParam{
+			Method:    method,
+			Amount:    t.Amount,
+			TipAmount: t.TipAmount,
+			TipUserID: t.TipUserID,
+			TipPool:   pool,
+		})
+	}
+
+	return tenders, ""
+}
+
+// decodeCreateSale parses and validates a sale payload. It writes the error
+// response itself and returns false when the request is unusable.
+func decodeCreateSale(w http.ResponseWriter, r *http.Request) (*repositories.CreateSaleParams, bool) {
 	var req createSaleRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid JSON body")
-		return
+		return nil, false
 	}
 
-	if len(req.Items) == 0 {
-		writeError(w, http.StatusBadRequest, "at least one item is required")
-		return
+	items, msg := parseSaleItems(req.Items)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return nil, false
 	}
-	if req.PaymentMethod == "" {
-		writeError(w, http.StatusBadRequest, "payment_method is required")
-		return
+
+	tenders, msg := parseTenders(&req)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return nil, false
 	}
-	if req.PaidAmount < 0 {
-		writeError(w, http.StatusBadRequest, "paid_amount must be >= 0")
-		return
+
+	return &repositories.CreateSaleParams{
+		Items:        items,
+		Tenders:      tenders,
+		TerminalID:   strings.TrimSpace(req.TerminalID),
+		ParkedSaleID: req.ParkedSaleID,
+	}, true
+}
+
+// decodeExchange parses an exchange against the sale in the URL. Like
+// decodeCreateSale it writes the error response itself.
+func decodeExchange(w http.ResponseWriter, r *http.Request) (*repositories.CreateSaleParams, bool) {
+	originalID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid sale id")
+		return nil, false
 	}
 
-	var items []repositories.CreateSaleItemParam
-	for _, it := range req.Items {
-		if it.ProductID <= 0 {
-			writeError(w, http.StatusBadRequest, "invalid product_id")
-			return
+	var req exchangeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return nil, false
+	}
+
+	if len(req.ReturnedItems) == 0 {
+		writeError(w, http.StatusBadRequest, "at least one returned item is required")
+		return nil, false
+	}
+
+	var returns []repositories.ReturnItemParam
+	for _, it := range req.ReturnedItems {
+		if it.SaleItemID <= 0 && it.ProductID <= 0 {
+			writeError(w, http.StatusBadRequest, "returned items need a sale_item_id or product_id")
+			return nil, false
 		}
 		if it.Quantity <= 0 {
-			writeError(w, http.StatusBadRequest, "quantity must be > 0")
-			return
+			writeError(w, http.StatusBadRequest, "returned quantity must be > 0")
+			return nil, false
 		}
-		items = append(items, repositories.CreateSaleItemParam{
-			ProductID:         it.ProductID,
-			Quantity:          it.Quantity,
-			UnitPriceOverride: it.UnitPrice,
+		returns = append(returns, repositories.ReturnItemParam{
+			SaleItemID: it.SaleItemID,
+			ProductID:  it.ProductID,
+			Quantity:   it.Quantity,
 		})
 	}
 
-	params := &repositories.CreateSaleParams{
-		Items:         items,
-		PaymentMethod: req.PaymentMethod,
-		PaidAmount:    req.PaidAmount,
+	items, msg := parseSaleItems(req.Items)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return nil, false
+	}
+
+	var tenders []repositories.TenderParam
+	if len(req.Tenders) > 0 || strings.TrimSpace(req.PaymentMethod) != "" {
+		tenders, msg = parseTenders(&req.createSaleRequest)
+		if msg != "" {
+			writeError(w, http.StatusBadRequest, msg)
+			return nil, false
+		}
+	}
+
+	return &repositories.CreateSaleParams{
+		Items:          items,
+		Tenders:        tenders,
+		TerminalID:     strings.TrimSpace(req.TerminalID),
+		OriginalSaleID: originalID,
+		Returns:        returns,
+		RefundMethod:   strings.TrimSpace(strings.ToLower(req.RefundMethod)),
+	}, true
+}
+
+// saleLinesErrorResponse lists the cart lines that stopped a sale so the
+// till can highlight them.
+type saleLinesErrorResponse struct {
+	Error string                   `json:"error"`
+	Lines []repositories.LineError `json:"lines"`
+}
+
+// writeSaleError maps pricing and stock errors shared by quotes and sales.
+// Stock conflicts are 409; a cart naming unknown products is a 400.
+func writeSaleError(w http.ResponseWriter, err error, fallback string) {
+	var linesErr *repositories.SaleLinesError
+	if errors.As(err, &linesErr) {
+		status, message := http.StatusConflict, "insufficient stock for one or more lines"
+		if errors.Is(err, repositories.ErrItemExpired) {
+			message = "one or more lines cannot be sold"
+		}
+		if errors.Is(err, repositories.ErrProductNotFound) || errors.Is(err, repositories.ErrVariantRequired) ||
+			errors.Is(err, repositories.ErrInvalidQuantity) || errors.Is(err, repositories.ErrProductArchived) {
+			status, message = http.StatusBadRequest, "one or more lines cannot be sold"
+		}
+		writeJSON(w, status, saleLinesErrorResponse{Error: message, Lines: linesErr.Lines})
+		return
+	}
+	if errors.Is(err, repositories.ErrProductNotFound) {
+		writeError(w, http.StatusBadRequest, "one or more products not found")
+		return
+	}
+	if errors.Is(err, repositories.ErrInsufficientStock) {
+		writeError(w, http.StatusConflict, "insufficient stock for one or more products")
+		return
+	}
+	if errors.Is(err, repositories.ErrTerminalRequired) {
+		writeError(w, http.StatusBadRequest, "terminal_id is required")
+		return
+	}
+	if errors.Is(err, repositories.ErrReturnNotFound) {
+		writeError(w, http.StatusBadRequest, "one or more returned items are not on the original sale")
+		return
+	}
+	if errors.Is(err, repositories.ErrReturnExceedsSold) {
+		writeError(w, http.StatusBadRequest, "returned quantity exceeds what is left to return")
+		return
+	}
+	if errors.Is(err, repositories.ErrPaymentRequired) {
+		writeError(w, http.StatusBadRequest, "payment is required for the amount due")
+		return
+	}
+	if errors.Is(err, repositories.ErrUnderpaid) || errors.Is(err, repositories.ErrTipUserNotFound) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, repositories.ErrParkedSaleNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if errors.Is(err, repositories.ErrParkedSaleNotResumed) {
+		writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, repositories.ErrNoPaymentDue) {
+		writeError(w, http.StatusBadRequest, "no payment is due; the difference is refunded")
+		return
+	}
+	writeError(w, http.StatusInternalServerError, fallback)
+}
+
+func (h *SaleHandler) CreateSale(w http.ResponseWriter, r *http.Request) {
+	// every sale is attributed to the cashier who rang it up
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	params, ok := decodeCreateSale(w, r)
+	if !ok {
+		return
+	}
+	params.UserID = claims.UserID
+	if params.TerminalID, err = sessionTerminal(claims, params.TerminalID); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
 	}
 
 	sale, err := h.repo.Create(r.Context(), params)
 	if err != nil {
-		if errors.Is(err, repositories.ErrProductNotFound) {
-			writeError(w, http.StatusBadRequest, "one or more products not found")
+		writeSaleError(w, err, "failed to create sale")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, sale)
+}
+
+// QuoteSale prices a cart using the same code path as CreateSale but does
+// not record a sale or touch stock. The session is read the same way, so
+// tips default to the same cashier and the same terminal is checked.
+func (h *SaleHandler) QuoteSale(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	params, ok := decodeCreateSale(w, r)
+	if !ok {
+		return
+	}
+	params.UserID = claims.UserID
+	if params.TerminalID, err = sessionTerminal(claims, params.TerminalID); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	quote, err := h.repo.Quote(r.Context(), params)
+	if err != nil {
+		writeSaleError(w, err, "failed to price sale")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, quote)
+}
+
+// CreateExchange returns lines from an earlier sale and sells new ones as a
+// single transaction, settling only the net difference.
+func (h *SaleHandler) CreateExchange(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	params, ok := decodeExchange(w, r)
+	if !ok {
+		return
+	}
+	params.UserID = claims.UserID
+	if params.TerminalID, err = sessionTerminal(claims, params.TerminalID); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	sale, err := h.repo.Create(r.Context(), params)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "sale not found")
 			return
 		}
-		if errors.Is(err, repositories.ErrInsufficientStock) {
-			writeError(w, http.StatusBadRequest, "insufficient stock for one or more products")
+		writeSaleError(w, err, "failed to create exchange")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, sale)
+}
+
+func (h *SaleHandler) QuoteExchange(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	params, ok := decodeExchange(w, r)
+	if !ok {
+		return
+	}
+	params.UserID = claims.UserID
+	if params.TerminalID, err = sessionTerminal(claims, params.TerminalID); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+
+	quote, err := h.repo.Quote(r.Context(), params)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "sale not found")
 			return
 		}
-		writeError(w, http.StatusInternalServerError, "failed to create sale")
+		writeSaleError(w, err, "failed to price exchange")
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, sale)
+	writeJSON(w, http.StatusOK, quote)
 }
 
+// parseSaleFilter reads the listing filters, sort and page parameters of
+// GET /sales. It returns a client-facing message when one is unusable.
+func parseSaleFilter(r *http.Request) (repositories.SaleFilter, string) {
+	q := r.URL.Query()
+	filter := repositories.SaleFilter{
+		ReceiptNumber: strings.TrimSpace(q.Get("receipt_number")),
+		PaymentMethod: strings.TrimSpace(strings.ToLower(q.Get("payment_method"))),
+		Cursor:        strings.TrimSpace(q.Get("cursor")),
+		Desc:          true,
+	}
+
+	if v := q.Get("user_id"); v != "" {
+		userID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || userID <= 0 {
+			return filter, "user_id must be a positive integer"
+		}
+		filter.UserID = userID
+	}
+
+	if v := q.Get("product_id"); v != "" {
+		productID, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || productID <= 0 {
+			return filter, "product_id must be a positive integer"
+		}
+		filter.ProductID = productID
+	}
+
+	// unlike reports, either end of the date range may be left open
+	if v := q.Get("from"); v != "" {
+		from, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return filter, "from must be YYYY-MM-DD"
+		}
+		filter.From = from
+	}
+	if v := q.Get("to"); v != "" {
+		to, err := time.Parse(dateLayout, v)
+		if err != nil {
+			return filter, "to must be YYYY-MM-DD"
+		}
+		filter.To = to.Add(24 * time.Hour)
+	}
+
+	if v := q.Get("min_total"); v != "" {
+		minTotal, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, "min_total must be a number"
+		}
+		filter.MinTotal = &minTotal
+	}
+	if v := q.Get("max_total"); v != "" {
+		maxTotal, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, "max_total must be a number"
+		}
+		filter.MaxTotal = &maxTotal
+	}
+
+	// sort=total_amount or sort=-total_amount; a leading "-" means descending
+	if v := strings.TrimSpace(q.Get("sort")); v != "" {
+		filter.Desc = strings.HasPrefix(v, "-")
+		filter.Sort = strings.TrimPrefix(v, "-")
+		if filter.Sort != repositories.SaleSortCreatedAt && filter.Sort != repositories.SaleSortTotalAmount {
+			return filter, "sort must be created_at or total_amount, optionally prefixed with '-'"
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 {
+			return filter, "limit must be a positive integer"
+		}
+		filter.Limit = limit
+	}
+
+	return filter, ""
+}
+
+// GetSales returns a SalePage when the client sends limit or cursor, and
+// otherwise the plain array of matching sales older clients expect.
 func (h *SaleHandler) GetSales(w http.ResponseWriter, r *http.Request) {
-	sales, err := h.repo.GetAll(r.Context())
+	filter, msg := parseSaleFilter(r)
+	if msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	// the unpaged listing has no total to report
+	filter.SkipCount = !wantsPage(r)
+	page, err := h.repo.GetAll(r.Context(), filter)
 	if err != nil {
+		if errors.Is(err, repositories.ErrInvalidCursor) {
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to fetch sales")
 		return
 	}
+	if wantsPage(r) {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+
+	// the unpaged listing, as it was before SalePage
+	sales := page.Items
+	for page.NextCursor != "" {
+		filter.Cursor = page.NextCursor
+		if page, err = h.repo.GetAll(r.Context(), filter); err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to fetch sales")
+			return
+		}
+		sales = append(sales, page.Items...)
+	}
 	writeJSON(w, http.StatusOK, sales)
 }
 
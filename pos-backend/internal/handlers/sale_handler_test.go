@@ -0,0 +1,376 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"pos-backend/internal/auth"
+	"pos-backend/internal/database"
+	"pos-backend/internal/models"
+	"pos-backend/internal/repositories"
+)
+
+const testJWTSecret = "test-secret"
+
+// newSaleTestServer serves the sale routes on a fresh database file and
+// returns a cashier token for it.
+func newSaleTestServer(t *testing.T) (*httptest.Server, *sql.DB, string) {
+	t.Helper()
+
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "pos.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	res, err := db.Exec(`INSERT INTO users (name, email, password_hash, role) VALUES ('Till', 'till@example.com', 'x', 'cashier')`)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	userID, _ := res.LastInsertId()
+
+	token, err := auth.GenerateToken(userID, "cashier", "", testJWTSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	repo := repositories.NewSaleRepository(db, repositories.PricingConfig{}, repositories.ReceiptConfig{
+		Prefix:      "R",
+		StoreCode:   "T",
+		Scope:       repositories.ReceiptScopeStore,
+		YearlyReset: true,
+	})
+
+	r := chi.NewRouter()
+	NewSaleHandler(repo, testJWTSecret).RegisterRoutes(r)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	return srv, db, token
+}
+
+func insertTestProduct(t *testing.T, db *sql.DB, sku string, stock int64, allowNegative any) int64 {
+	t.Helper()
+
+	res, err := db.Exec(
+		`INSERT INTO products (name, sku, price, stock, allow_negative_stock) VALUES (?, ?, 10, ?, ?)`,
+		sku, sku, stock, allowNegative,
+	)
+	if err != nil {
+		t.Fatalf("insert product: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+// doRequest sends body to path on srv and returns the status and response
+// body. Headers are given as name, value pairs.
+func doRequest(t *testing.T, srv *httptest.Server, token, method, path, body string, headers ...string) (int, string) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	return resp.StatusCode, string(respBody)
+}
+
+// hammerSales posts n single-unit sales of productID concurrently and
+// counts the response codes.
+func hammerSales(t *testing.T, srv *httptest.Server, token string, productID int64, n int) map[int]int {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":1}],"payment_method":"cash","paid_amount":10}`, productID)
+
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		statuses = make(map[int]int)
+	)
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			req, _ := http.NewRequest(http.MethodPost, srv.URL+"/sales", strings.NewReader(body))
+			req.Header.Set("Authorization", "Bearer "+token)
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Errorf("post sale: %v", err)
+				return
+			}
+			resp.Body.Close()
+
+			mu.Lock()
+			statuses[resp.StatusCode]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	return statuses
+}
+
+func TestCreateSaleConcurrentLastUnits(t *testing.T) {
+	srv, db, token := newSaleTestServer(t)
+
+	const stock, buyers = 5, 40
+	productID := insertTestProduct(t, db, "LAST", stock, nil)
+
+	statuses := hammerSales(t, srv, token, productID, buyers)
+
+	if statuses[http.StatusCreated] != stock {
+		t.Errorf("created = %d, want %d (statuses %v)", statuses[http.StatusCreated], stock, statuses)
+	}
+	if statuses[http.StatusConflict] != buyers-stock {
+		t.Errorf("conflicts = %d, want %d (statuses %v)", statuses[http.StatusConflict], buyers-stock, statuses)
+	}
+
+	var left, sales int64
+	if err := db.QueryRow(`SELECT stock FROM products WHERE id = ?`, productID).Scan(&left); err != nil {
+		t.Fatalf("read stock: %v", err)
+	}
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sales`).Scan(&sales); err != nil {
+		t.Fatalf("count sales: %v", err)
+	}
+	if left != 0 {
+		t.Errorf("stock left = %d, want 0", left)
+	}
+	if sales != stock {
+		t.Errorf("sales recorded = %d, want %d", sales, stock)
+	}
+}
+
+func TestCreateSaleConcurrentNegativeStockAllowed(t *testing.T) {
+	srv, db, token := newSaleTestServer(t)
+
+	const stock, buyers = 2, 20
+	productID := insertTestProduct(t, db, "MISCOUNTED", stock, true)
+
+	statuses := hammerSales(t, srv, token, productID, buyers)
+
+	if statuses[http.StatusCreated] != buyers {
+		t.Errorf("created = %d, want %d (statuses %v)", statuses[http.StatusCreated], buyers, statuses)
+	}
+
+	var left int64
+	if err := db.QueryRow(`SELECT stock FROM products WHERE id = ?`, productID).Scan(&left); err != nil {
+		t.Fatalf("read stock: %v", err)
+	}
+	if left != stock-buyers {
+		t.Errorf("stock left = %d, want %d", left, stock-buyers)
+	}
+}
+
+func TestCreateSaleTenders(t *testing.T) {
+	srv, db, token := newSaleTestServer(t)
+	productID := insertTestProduct(t, db, "TENDER", 100, nil)
+
+	tests := []struct {
+		name    string
+		tenders string
+		want    int
+	}{
+		{"exact cash", `"payment_method":"cash","paid_amount":20`, http.StatusCreated},
+		{"cash with change", `"payment_method":"cash","paid_amount":50`, http.StatusCreated},
+		{"underpaid cash", `"payment_method":"cash","paid_amount":19.99`, http.StatusBadRequest},
+		{"underpaid split", `"tenders":[{"method":"card","amount":5},{"method":"cash","amount":10}]`, http.StatusBadRequest},
+		{"covered split", `"tenders":[{"method":"card","amount":5},{"method":"cash","amount":15}]`, http.StatusCreated},
+		{"unknown tip user", `"tenders":[{"method":"card","amount":20,"tip_amount":2,"tip_user_id":999}]`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":2}],%s}`, productID, tt.tenders)
+			status, resp := doRequest(t, srv, token, http.MethodPost, "/sales", body)
+			if status != tt.want {
+				t.Errorf("status = %d, want %d (%s)", status, tt.want, resp)
+			}
+		})
+	}
+
+	var sales int64
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sales`).Scan(&sales); err != nil {
+		t.Fatalf("count sales: %v", err)
+	}
+	if sales != 3 {
+		t.Errorf("sales recorded = %d, want 3", sales)
+	}
+}
+
+func TestQuoteSaleSession(t *testing.T) {
+	srv, db, token := newSaleTestServer(t)
+	productID := insertTestProduct(t, db, "QUOTE", 100, nil)
+
+	var cashierID int64
+	if err := db.QueryRow(`SELECT id FROM users WHERE email = 'till@example.com'`).Scan(&cashierID); err != nil {
+		t.Fatalf("read cashier: %v", err)
+	}
+	onT1, err := auth.GenerateToken(cashierID, "cashier", "T1", testJWTSecret, time.Hour)
+	if err != nil {
+		t.Fatalf("generate token: %v", err)
+	}
+
+	body := func(terminal string) string {
+		return fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":1}],"terminal_id":%q,"tenders":[{"method":"card","amount":10,"tip_amount":1}]}`, productID, terminal)
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		body   string
+		status int
+	}{
+		{"no session", "", body(""), http.StatusUnauthorized},
+		{"another terminal", onT1, body("T2"), http.StatusForbidden},
+		{"the session terminal", onT1, body(""), http.StatusOK},
+		{"no terminal", token, body(""), http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, resp := doRequest(t, srv, tt.token, http.MethodPost, "/sales/quote", tt.body)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d (%s)", status, tt.status, resp)
+			}
+			if status != http.StatusOK {
+				return
+			}
+
+			// the tip goes to the cashier, as it would on the sale
+			var quote repositories.SaleQuote
+			if err := json.Unmarshal([]byte(resp), &quote); err != nil {
+				t.Fatalf("decode quote: %v", err)
+			}
+			if len(quote.Tenders) != 1 || quote.Tenders[0].TipUserID != cashierID {
+				t.Errorf("tenders = %+v, want the tip for user %d", quote.Tenders, cashierID)
+			}
+		})
+	}
+}
+
+func TestCreateExchangeTenders(t *testing.T) {
+	srv, db, token := newSaleTestServer(t)
+	productID := insertTestProduct(t, db, "SWAP", 100, nil)
+
+	tests := []struct {
+		name    string
+		tenders string
+		want    int
+	}{
+		{"no payment", ``, http.StatusBadRequest},
+		{"underpaid", `,"payment_method":"cash","paid_amount":5`, http.StatusBadRequest},
+		{"underpaid split", `,"tenders":[{"method":"card","amount":10},{"method":"cash","amount":9.99}]`, http.StatusBadRequest},
+		{"covered", `,"payment_method":"cash","paid_amount":20`, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sale := fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":1}],"payment_method":"cash","paid_amount":10}`, productID)
+			status, resp := doRequest(t, srv, token, http.MethodPost, "/sales", sale)
+			if status != http.StatusCreated {
+				t.Fatalf("create sale: status %d (%s)", status, resp)
+			}
+			var saleID int64
+			if err := db.QueryRow(`SELECT MAX(id) FROM sales`).Scan(&saleID); err != nil {
+				t.Fatalf("read sale id: %v", err)
+			}
+
+			// one unit back, three out: 20 is due
+			body := fmt.Sprintf(`{"returned_items":[{"product_id":%d,"quantity":1}],"items":[{"product_id":%d,"quantity":3}]%s}`,
+				productID, productID, tt.tenders)
+			status, resp = doRequest(t, srv, token, http.MethodPost, fmt.Sprintf("/sales/%d/exchange", saleID), body)
+			if status != tt.want {
+				t.Errorf("status = %d, want %d (%s)", status, tt.want, resp)
+			}
+		})
+	}
+}
+
+func TestGetSalesPaymentMethod(t *testing.T) {
+	srv, db, token := newSaleTestServer(t)
+	productID := insertTestProduct(t, db, "LIST", 100, nil)
+
+	for _, tenders := range []string{
+		`"payment_method":"cash","paid_amount":10`,
+		`"payment_method":"card","paid_amount":10`,
+		`"tenders":[{"method":"card","amount":4},{"method":"cash","amount":6}]`,
+	} {
+		body := fmt.Sprintf(`{"items":[{"product_id":%d,"quantity":1}],%s}`, productID, tenders)
+		if status, resp := doRequest(t, srv, token, http.MethodPost, "/sales", body); status != http.StatusCreated {
+			t.Fatalf("create sale: status %d (%s)", status, resp)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"?payment_method=cash", []string{"split", "cash"}}, // any cash tender
+		{"?payment_method=card", []string{"split", "card"}},
+		{"?payment_method=split", []string{"split"}},
+		{"?", []string{"split", "card", "cash"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			status, resp := doRequest(t, srv, token, http.MethodGet, "/sales"+tt.query, "")
+			if status != http.StatusOK {
+				t.Fatalf("status = %d (%s)", status, resp)
+			}
+			var sales []models.Sale
+			if err := json.Unmarshal([]byte(resp), &sales); err != nil {
+				t.Fatalf("decode sales: %v", err)
+			}
+			var got []string
+			for _, s := range sales {
+				got = append(got, s.PaymentMethod)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("payment methods = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// a paged client still gets the total across pages
+	status, resp := doRequest(t, srv, token, http.MethodGet, "/sales?limit=1", "")
+	if status != http.StatusOK {
+		t.Fatalf("paged listing: status %d (%s)", status, resp)
+	}
+	var page repositories.SalePage
+	if err := json.Unmarshal([]byte(resp), &page); err != nil {
+		t.Fatalf("decode page: %v", err)
+	}
+	if len(page.Items) != 1 || page.TotalCount != 3 || page.NextCursor == "" {
+		t.Errorf("page has %d sales of %d, next %q; want 1 of 3 and a next cursor", len(page.Items), page.TotalCount, page.NextCursor)
+	}
+}
@@ -0,0 +1,333 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+
+	"pos-backend/internal/auth"
+	"pos-backend/internal/models"
+	"pos-backend/internal/repositories"
+)
+
+type ShiftHandler struct {
+	repo      *repositories.ShiftRepository
+	jwtSecret string
+}
+
+func NewShiftHandler(repo *repositories.ShiftRepository, jwtSecret string) *ShiftHandler {
+	return &ShiftHandler{repo: repo, jwtSecret: jwtSecret}
+}
+
+func (h *ShiftHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/shifts", h.GetShifts)
+	r.Post("/shifts", h.OpenShift)
+	r.Get("/shifts/current", h.GetCurrentShift)
+	r.Get("/shifts/{id}", h.GetShiftByID)
+	r.Post("/shifts/{id}/cash-movements", h.AddCashMovement)
+	r.Post("/shifts/{id}/close", h.CloseShift)
+	r.Get("/shifts/{id}/x-report", h.GetXReport)
+	r.Get("/shifts/{id}/z-report", h.GetZReport)
+}
+
+type openShiftRequest struct {
+	TerminalID   string  `json:"terminal_id"`
+	OpeningFloat float64 `json:"opening_float"`
+}
+
+func (h *ShiftHandler) OpenShift(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	var req openShiftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	// a shift belongs to the till the cashier signed in on
+	if req.TerminalID, err = sessionTerminal(claims, req.TerminalID); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
+	if req.TerminalID == "" {
+		writeError(w, http.StatusBadRequest, "sign in with a terminal_id to open a shift")
+		return
+	}
+	if req.OpeningFloat < 0 {
+		writeError(w, http.StatusBadRequest, "opening_float must be >= 0")
+		return
+	}
+
+	sh, err := h.repo.Open(r.Context(), &repositories.OpenShiftParams{
+		TerminalID:   req.TerminalID,
+		UserID:       claims.UserID,
+		OpeningFloat: req.OpeningFloat,
+	})
+	if err != nil {
+		if errors.Is(err, repositories.ErrShiftAlreadyOpen) {
+			writeError(w, http.StatusConflict, "terminal already has an open shift")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to open shift")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, sh)
+}
+
+func (h *ShiftHandler) GetShifts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := repositories.ShiftFilter{
+		TerminalID: strings.TrimSpace(q.Get("terminal_id")),
+		Status:     strings.TrimSpace(q.Get("status")),
+	}
+
+	if filter.Status != "" && filter.Status != repositories.ShiftStatusOpen && filter.Status != repositories.ShiftStatusClosed {
+		writeError(w, http.StatusBadRequest, "status must be 'open' or 'closed'")
+		return
+	}
+
+	shifts, err := h.repo.GetAll(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch shifts")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, shifts)
+}
+
+// GetCurrentShift returns the open shift of the terminal given, by default
+// the one the caller signed in on.
+func (h *ShiftHandler) GetCurrentShift(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	terminalID := strings.TrimSpace(r.URL.Query().Get("terminal_id"))
+	if terminalID == "" {
+		terminalID = claims.TerminalID
+	}
+	if terminalID == "" {
+		writeError(w, http.StatusBadRequest, "terminal_id is required")
+		return
+	}
+
+	sh, err := h.repo.GetCurrent(r.Context(), terminalID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "no open shift for terminal")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch shift")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sh)
+}
+
+func (h *ShiftHandler) GetShiftByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shift id")
+		return
+	}
+
+	sh, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "shift not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch shift")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, sh)
+}
+
+type cashMovementRequest struct {
+	Kind   string  `json:"kind"` // "paid_in" or "paid_out"
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+func (h *ShiftHandler) AddCashMovement(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shift id")
+		return
+	}
+
+	var req cashMovementRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	req.Kind = strings.TrimSpace(strings.ToLower(req.Kind))
+	if req.Kind != repositories.CashMovementPaidIn && req.Kind != repositories.CashMovementPaidOut {
+		writeError(w, http.StatusBadRequest, "kind must be 'paid_in' or 'paid_out'")
+		return
+	}
+	if req.Amount <= 0 {
+		writeError(w, http.StatusBadRequest, "amount must be > 0")
+		return
+	}
+	if !h.sessionShift(w, r, claims, id) {
+		return
+	}
+
+	m := &models.CashMovement{
+		ShiftID: id,
+		Kind:    req.Kind,
+		Amount:  req.Amount,
+		Reason:  strings.TrimSpace(req.Reason),
+		UserID:  claims.UserID,
+	}
+
+	if err := h.repo.AddCashMovement(r.Context(), m); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "shift not found")
+			return
+		}
+		if errors.Is(err, repositories.ErrShiftClosed) {
+			writeError(w, http.StatusConflict, "shift is closed")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to record cash movement")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, m)
+}
+
+type closeShiftRequest struct {
+	CountedCash *float64 `json:"counted_cash"`
+}
+
+func (h *ShiftHandler) CloseShift(w http.ResponseWriter, r *http.Request) {
+	claims, err := claimsFromRequest(r, h.jwtSecret)
+	if err != nil {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shift id")
+		return
+	}
+
+	var req closeShiftRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.CountedCash == nil || *req.CountedCash < 0 {
+		writeError(w, http.StatusBadRequest, "counted_cash is required and must be >= 0")
+		return
+	}
+	if !h.sessionShift(w, r, claims, id) {
+		return
+	}
+
+	report, err := h.repo.Close(r.Context(), id, *req.CountedCash, claims.UserID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "shift not found")
+			return
+		}
+		if errors.Is(err, repositories.ErrShiftClosed) {
+			writeError(w, http.StatusConflict, "shift is already closed")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to close shift")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+// sessionShift checks that shift id is the drawer of the terminal the caller
+// signed in on, as sales are, and writes the error response when it is not.
+func (h *ShiftHandler) sessionShift(w http.ResponseWriter, r *http.Request, claims *auth.Claims, id int64) bool {
+	sh, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "shift not found")
+			return false
+		}
+		writeError(w, http.StatusInternalServerError, "failed to fetch shift")
+		return false
+	}
+	if _, err := sessionTerminal(claims, sh.TerminalID); err != nil {
+		writeError(w, http.StatusForbidden, err.Error())
+		return false
+	}
+	return true
+}
+
+func (h *ShiftHandler) GetXReport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shift id")
+		return
+	}
+
+	report, err := h.repo.XReport(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "shift not found")
+			return
+		}
+		if errors.Is(err, repositories.ErrShiftClosed) {
+			writeError(w, http.StatusConflict, "shift is closed; use the Z report")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to build X report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
+
+func (h *ShiftHandler) GetZReport(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid shift id")
+		return
+	}
+
+	report, err := h.repo.ZReport(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "shift not found")
+			return
+		}
+		if errors.Is(err, repositories.ErrShiftNotClosed) {
+			writeError(w, http.StatusConflict, "shift is still open; use the X report")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to build Z report")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"pos-backend/internal/auth"
+	"pos-backend/internal/database"
+	"pos-backend/internal/repositories"
+)
+
+func TestShiftTerminal(t *testing.T) {
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "pos.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	res, err := db.Exec(`INSERT INTO users (name, email, password_hash, role) VALUES ('Till', 'till@example.com', 'x', 'cashier')`)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	userID, _ := res.LastInsertId()
+
+	// the same cashier signed in on two tills
+	tokens := map[string]string{}
+	for _, terminal := range []string{"T1", "T2"} {
+		if tokens[terminal], err = auth.GenerateToken(userID, "cashier", terminal, testJWTSecret, time.Hour); err != nil {
+			t.Fatalf("generate token: %v", err)
+		}
+	}
+
+	r := chi.NewRouter()
+	NewShiftHandler(repositories.NewShiftRepository(db), testJWTSecret).RegisterRoutes(r)
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	status, resp := doRequest(t, srv, tokens["T1"], http.MethodPost, "/shifts", `{"opening_float":100}`)
+	if status != http.StatusCreated {
+		t.Fatalf("open shift: status %d (%s)", status, resp)
+	}
+	var shift struct {
+		ID int64 `json:"id"`
+	}
+	if err := json.Unmarshal([]byte(resp), &shift); err != nil {
+		t.Fatalf("decode shift: %v", err)
+	}
+
+	paidOut := `{"kind":"paid_out","amount":20,"reason":"milk"}`
+	steps := []struct {
+		name     string
+		terminal string
+		method   string
+		path     string
+		body     string
+		status   int
+	}{
+		{"another till's paid out", "T2", http.MethodPost, fmt.Sprintf("/shifts/%d/cash-movements", shift.ID), paidOut, http.StatusForbidden},
+		{"another till's close", "T2", http.MethodPost, fmt.Sprintf("/shifts/%d/close", shift.ID), `{"counted_cash":80}`, http.StatusForbidden},
+		{"another till has no shift open", "T2", http.MethodGet, "/shifts/current", "", http.StatusNotFound},
+		{"current shift of the session's till", "T1", http.MethodGet, "/shifts/current", "", http.StatusOK},
+		{"own paid out", "T1", http.MethodPost, fmt.Sprintf("/shifts/%d/cash-movements", shift.ID), paidOut, http.StatusCreated},
+		{"unknown shift", "T1", http.MethodPost, "/shifts/9999/cash-movements", paidOut, http.StatusNotFound},
+		{"own close", "T1", http.MethodPost, fmt.Sprintf("/shifts/%d/close", shift.ID), `{"counted_cash":80}`, http.StatusOK},
+	}
+
+	for _, s := range steps {
+		if status, resp := doRequest(t, srv, tokens[s.terminal], s.method, s.path, s.body); status != s.status {
+			t.Errorf("%s: status %d, want %d (%s)", s.name, status, s.status, resp)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	"pos-backend/internal/models"
+	"pos-backend/internal/repositories"
+)
+
+type UnitHandler struct {
+	repo *repositories.UnitRepository
+}
+
+func NewUnitHandler(repo *repositories.UnitRepository) *UnitHandler {
+	return &UnitHandler{repo: repo}
+}
+
+func (h *UnitHandler) RegisterRoutes(r chi.Router) {
+	r.Get("/units", h.GetUnits)
+	r.Post("/units", h.CreateUnit)
+}
+
+func (h *UnitHandler) GetUnits(w http.ResponseWriter, r *http.Request) {
+	units, err := h.repo.GetAll(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to fetch units")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, units)
+}
+
+func (h *UnitHandler) CreateUnit(w http.ResponseWriter, r *http.Request) {
+	var u models.Unit
+	if err := json.NewDecoder(r.Body).Decode(&u); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	if err := h.repo.Create(r.Context(), &u); err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrInvalidUnit):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, repositories.ErrUnitExists):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to create unit")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, u)
+}
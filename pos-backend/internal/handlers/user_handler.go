@@ -4,9 +4,7 @@ import (
 	"database/sql"
 	"errors"
 	"net/http"
-	"strings"
 
-	"pos-backend/internal/auth"
 	"pos-backend/internal/repositories"
 )
 
@@ -29,22 +27,9 @@ func (h *UserHandler) RegisterRoutes(r interface {
 }
 
 func (h *UserHandler) Me(w http.ResponseWriter, r *http.Request) {
-	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" {
-		writeError(w, http.StatusUnauthorized, "missing Authorization header")
-		return
-	}
-
-	if !strings.HasPrefix(authHeader, "Bearer ") {
-		writeError(w, http.StatusUnauthorized, "invalid Authorization header format")
-		return
-	}
-
-	tokenStr := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
-
-	claims, err := auth.ParseToken(tokenStr, h.jwtSecret)
+	claims, err := claimsFromRequest(r, h.jwtSecret)
 	if err != nil {
-		writeError(w, http.StatusUnauthorized, "invalid or expired token")
+		writeError(w, http.StatusUnauthorized, err.Error())
 		return
 	}
 
@@ -2,7 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
+
+	"pos-backend/internal/auth"
 )
 
 func writeJSON(w http.ResponseWriter, status int, data any) {
@@ -17,3 +21,51 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	}
 	writeJSON(w, status, errorResponse{Error: message})
 }
+
+var (
+	errMissingAuthHeader = errors.New("missing Authorization header")
+	errBadAuthHeader     = errors.New("invalid Authorization header format")
+	errInvalidToken      = errors.New("invalid or expired token")
+	errTerminalMismatch  = errors.New("terminal_id does not match the terminal this session signed in on")
+)
+
+// claimsFromRequest validates the bearer token on r and returns its claims.
+// The error text is safe to send back to the client.
+func claimsFromRequest(r *http.Request, jwtSecret string) (*auth.Claims, error) {
+	authHeader := r.Header.Get("Authorization")
+	if authHeader == "" {
+		return nil, errMissingAuthHeader
+	}
+
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		return nil, errBadAuthHeader
+	}
+
+	tokenStr := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+
+	claims, err := auth.ParseToken(tokenStr, jwtSecret)
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	return claims, nil
+}
+
+// sessionTerminal returns the terminal the caller signed in on. Receipt
+// numbers and shifts are keyed on it, so a terminal_id sent with a request
+// may repeat it but never name another till. The error text is safe to send
+// back to the client with a 403.
+func sessionTerminal(claims *auth.Claims, requested string) (string, error) {
+	if requested = strings.TrimSpace(requested); requested != "" && requested != claims.TerminalID {
+		return "", errTerminalMismatch
+	}
+	return claims.TerminalID, nil
+}
+
+// wantsPage reports whether a listing request opted into the paged response
+// by sending limit or cursor. Clients written before the listings were paged
+// send neither and keep getting the bare array of every row.
+func wantsPage(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Has("limit") || q.Has("cursor")
+}
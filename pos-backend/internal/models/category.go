@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type Category struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	ParentID  *int64     `json:"parent_id"` // nil for a top-level category
+	SortOrder int        `json:"sort_order"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	Children  []Category `json:"children,omitempty"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+type Layaway struct {
+	ID              int64            `json:"id"`
+	CustomerName    string           `json:"customer_name"`
+	CustomerPhone   string           `json:"customer_phone,omitempty"`
+	Status          string           `json:"status"` // "open", "completed" or "cancelled"
+	Subtotal        float64          `json:"subtotal"`
+	DiscountAmount  float64          `json:"discount_amount"`
+	TaxAmount       float64          `json:"tax_amount"`
+	TotalAmount     float64          `json:"total_amount"`
+	PaidAmount      float64          `json:"paid_amount"`
+	BalanceDue      float64          `json:"balance_due"`
+	ForfeitedAmount float64          `json:"forfeited_amount"`
+	RefundedAmount  float64          `json:"refunded_amount"`
+	DueDate         time.Time        `json:"due_date"`
+	Overdue         bool             `json:"overdue"`
+	UserID          int64            `json:"user_id"`
+	TerminalID      string           `json:"terminal_id,omitempty"`
+	SaleID          int64            `json:"sale_id,omitempty"`
+	CreatedAt       time.Time        `json:"created_at"`
+	ClosedAt        *time.Time       `json:"closed_at,omitempty"`
+	Items           []LayawayItem    `json:"items,omitempty"`
+	Payments        []LayawayPayment `json:"payments,omitempty"`
+}
+
+type LayawayItem struct {
+	ID             int64   `json:"id"`
+	LayawayID      int64   `json:"layaway_id"`
+	ProductID      int64   `json:"product_id"`
+	ProductName    string  `json:"product_name,omitempty"`
+	Quantity       float64 `json:"quantity"`
+	ListPrice      float64 `json:"list_price"`
+	UnitPrice      float64 `json:"unit_price"`
+	DiscountAmount float64 `json:"discount_amount"`
+	TaxAmount      float64 `json:"tax_amount"`
+	LineTotal      float64 `json:"line_total"`
+}
+
+type LayawayPayment struct {
+	ID         int64     `json:"id"`
+	LayawayID  int64     `json:"layaway_id"`
+	Method     string    `json:"method"`
+	Amount     float64   `json:"amount"` // negative for refunds
+	UserID     int64     `json:"user_id"`
+	TerminalID string    `json:"terminal_id,omitempty"`
+	ShiftID    int64     `json:"shift_id,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
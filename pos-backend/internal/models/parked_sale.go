@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type ParkedSale struct {
+	ID           int64            `json:"id"`
+	Label        string           `json:"label"`
+	TerminalID   string           `json:"terminal_id"`
+	ReserveStock bool             `json:"reserve_stock"`
+	ExpiresAt    time.Time        `json:"expires_at"`
+	ResumedAt    *time.Time       `json:"resumed_at,omitempty"` // pass the id as parked_sale_id when selling
+	CreatedAt    time.Time        `json:"created_at"`
+	Items        []ParkedSaleItem `json:"items,omitempty"`
+}
+
+type ParkedSaleItem struct {
+	ID           int64    `json:"id"`
+	ParkedSaleID int64    `json:"parked_sale_id"`
+	ProductID    int64    `json:"product_id"`
+	ProductName  string   `json:"product_name,omitempty"`
+	Barcode      string   `json:"barcode,omitempty"` // scanned lines; quantity counts scans
+	Quantity     float64  `json:"quantity"`
+	UnitPrice    *float64 `json:"unit_price,omitempty"` // nil = use product price
+}
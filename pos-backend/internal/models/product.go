@@ -3,11 +3,99 @@ package models
 import "time"
 
 type Product struct {
-	ID        int64     `json:"id"`
-	Name      string    `json:"name"`
-	SKU       string    `json:"sku"`
-	Price     float64   `json:"price"`
-	Stock     int64     `json:"stock"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID                 int64          `json:"id"`
+	Name               string         `json:"name"`
+	SKU                string         `json:"sku"`
+	Price              float64        `json:"price"`
+	Cost               *float64       `json:"cost"` // what one unit costs the store, nil when unknown; snapshotted onto sale lines
+	Stock              float64        `json:"stock"`
+	AllowNegativeStock *bool          `json:"allow_negative_stock"` // nil = store-wide policy
+	PLU                string         `json:"plu,omitempty"`        // scale labels refer to the product by this
+	CategoryID         *int64         `json:"category_id"`
+	ParentID           *int64         `json:"parent_id"`             // set on variants
+	OwnPrice           bool           `json:"own_price,omitempty"`   // variant price no longer follows the parent
+	Unit               string         `json:"unit"`                  // what stock is counted and sold in, e.g. "pcs" or "kg"
+	QuantityDecimals   int            `json:"quantity_decimals"`     // precision of the unit
+	ArchivedAt         *time.Time     `json:"archived_at,omitempty"` // set while the product is off the POS
+	Version            int64          `json:"version"`               // bumped by every edit; the ETag
+	CreatedAt          time.Time      `json:"created_at"`
+	UpdatedAt          time.Time      `json:"updated_at"`
+	Barcodes           []Barcode      `json:"barcodes,omitempty"`
+	Units              []ProductUnit  `json:"units,omitempty"`      // purchase units
+	Components         []KitComponent `json:"components,omitempty"` // set on kits
+
+	Options     map[string]string `json:"options,omitempty"`      // a variant's value per option type
+	OptionTypes []ProductOption   `json:"option_types,omitempty"` // a parent's option types
+	Variants    []Product         `json:"variants,omitempty"`
+}
+
+// KitComponent is a product that goes into a kit and how many of it
+// (in its own unit) one kit takes.
+type KitComponent struct {
+	ProductID   int64   `json:"product_id"`
+	ProductName string  `json:"product_name,omitempty"`
+	Quantity    float64 `json:"quantity"`
+}
+
+// ProductOption is an option type of a parent product, e.g. Size with
+// values S, M and L.
+type ProductOption struct {
+	ID     int64                `json:"id"`
+	Name   string               `json:"name"`
+	Values []ProductOptionValue `json:"values"`
+}
+
+type ProductOptionValue struct {
+	ID    int64  `json:"id"`
+	Value string `json:"value"`
+	Code  string `json:"code"` // used for {Option} in SKU patterns
+}
+
+type Barcode struct {
+	ID           int64     `json:"id"`
+	ProductID    int64     `json:"product_id"`
+	Code         string    `json:"code"`
+	Symbology    string    `json:"symbology"`     // "ean13", "ean8", "upca" or "code128"
+	PackQuantity float64   `json:"pack_quantity"` // units sold per scan
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// BarcodeRule reads in-store barcodes that embed a PLU and a weight or
+// price, e.g. prefix "21", 5-digit PLU, 5-digit price with 2 decimals.
+type BarcodeRule struct {
+	ID            int64     `json:"id"`
+	Prefix        string    `json:"prefix"`
+	PLULength     int       `json:"plu_length"`
+	ValueKind     string    `json:"value_kind"` // "weight" (kg) or "price"
+	ValueLength   int       `json:"value_length"`
+	ValueDecimals int       `json:"value_decimals"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// ProductPrice is a price a product had from EffectiveAt until the next
+// entry of its history.
+type ProductPrice struct {
+	Price       float64   `json:"price"`
+	EffectiveAt time.Time `json:"effective_at"`
+}
+
+// PriceChange is a price set in advance, taking effect at EffectiveAt.
+type PriceChange struct {
+	ID          int64      `json:"id"`
+	ProductID   int64      `json:"product_id"`
+	ProductName string     `json:"product_name,omitempty"`
+	Price       float64    `json:"price"`
+	EffectiveAt time.Time  `json:"effective_at"`
+	Status      string     `json:"status"` // "scheduled", "applied" or "cancelled"
+	CreatedAt   time.Time  `json:"created_at"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+// PriceHistory is a product's current price with the prices it had before
+// and the changes scheduled for it.
+type PriceHistory struct {
+	ProductID int64          `json:"product_id"`
+	Price     float64        `json:"price"`
+	History   []ProductPrice `json:"history"`   // newest first
+	Scheduled []PriceChange  `json:"scheduled"` // soonest first
 }
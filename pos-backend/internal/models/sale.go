@@ -3,21 +3,66 @@ package models
 import "time"
 
 type Sale struct {
-	ID            int64      `json:"id"`
-	TotalAmount   float64    `json:"total_amount"`
-	PaidAmount    float64    `json:"paid_amount"`
-	PaymentMethod string     `json:"payment_method"`
-	CreatedAt     time.Time  `json:"created_at"`
-	Items         []SaleItem `json:"items,omitempty"`
+	ID             int64        `json:"id"`
+	ReceiptNumber  string       `json:"receipt_number,omitempty"`
+	Kind           string       `json:"kind"`                       // "sale" or "exchange"
+	OriginalSaleID int64        `json:"original_sale_id,omitempty"` // sale the exchange returns items from
+	Subtotal       float64      `json:"subtotal"`
+	DiscountAmount float64      `json:"discount_amount"`
+	TaxAmount      float64      `json:"tax_amount"`
+	RoundingAmount float64      `json:"rounding_amount"`
+	TotalAmount    float64      `json:"total_amount"`
+	PaidAmount     float64      `json:"paid_amount"`
+	PaymentMethod  string       `json:"payment_method"` // "split" when several methods were used
+	TipAmount      float64      `json:"tip_amount"`     // not part of TotalAmount
+	UserID         int64        `json:"user_id,omitempty"`
+	CashierName    string       `json:"cashier_name,omitempty"`
+	TerminalID     string       `json:"terminal_id,omitempty"`
+	ShiftID        int64        `json:"shift_id,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Items          []SaleItem   `json:"items,omitempty"`
+	Tenders        []SaleTender `json:"tenders,omitempty"`
 }
 
 type SaleItem struct {
-	ID          int64     `json:"id"`
-	SaleID      int64     `json:"sale_id"`
-	ProductID   int64     `json:"product_id"`
-	ProductName string    `json:"product_name,omitempty"`
-	Quantity    int64     `json:"quantity"`
-	UnitPrice   float64   `json:"unit_price"`
-	LineTotal   float64   `json:"line_total"`
-	CreatedAt   time.Time `json:"created_at"`
+	ID             int64     `json:"id"`
+	SaleID         int64     `json:"sale_id"`
+	ProductID      int64     `json:"product_id"`
+	ProductName    string    `json:"product_name,omitempty"`
+	Quantity       float64   `json:"quantity"`
+	ListPrice      float64   `json:"list_price"`
+	UnitPrice      float64   `json:"unit_price"`
+	DiscountAmount float64   `json:"discount_amount"`
+	TaxAmount      float64   `json:"tax_amount"`
+	LineTotal      float64   `json:"line_total"`
+	UnitCost       *float64  `json:"unit_cost"`                  // product cost when sold, nil when unknown
+	ReturnedItemID int64     `json:"returned_item_id,omitempty"` // set on return lines, which have a negative quantity
+	Barcode        string    `json:"barcode,omitempty"`          // code scanned to sell the line
+	Weight         *float64  `json:"weight,omitempty"`           // kg read from a variable-weight label
+	Lot            string    `json:"lot,omitempty"`              // batch read from a GS1 code
+	ExpiryDate     string    `json:"expiry_date,omitempty"`      // YYYY-MM-DD, from a GS1 code
+	CreatedAt      time.Time `json:"created_at"`
+
+	Components []SaleItemComponent `json:"components,omitempty"` // kit lines only
+}
+
+// SaleItemComponent is what a kit line took from one component, with the
+// part of the line total allocated to it.
+type SaleItemComponent struct {
+	ProductID   int64    `json:"product_id"`
+	ProductName string   `json:"product_name,omitempty"`
+	Quantity    float64  `json:"quantity"`
+	Revenue     float64  `json:"revenue"`
+	UnitCost    *float64 `json:"unit_cost"` // component cost when sold, nil when unknown
+}
+
+type SaleTender struct {
+	ID        int64     `json:"id"`
+	SaleID    int64     `json:"sale_id"`
+	Method    string    `json:"method"`
+	Amount    float64   `json:"amount"` // applied to the sale, change excluded
+	TipAmount float64   `json:"tip_amount"`
+	TipUserID int64     `json:"tip_user_id,omitempty"`
+	TipPool   string    `json:"tip_pool,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type Shift struct {
+	ID           int64      `json:"id"`
+	TerminalID   string     `json:"terminal_id"`
+	UserID       int64      `json:"user_id"`
+	CashierName  string     `json:"cashier_name,omitempty"`
+	Status       string     `json:"status"` // "open" or "closed"
+	OpeningFloat float64    `json:"opening_float"`
+	ExpectedCash *float64   `json:"expected_cash,omitempty"` // set when closed
+	CountedCash  *float64   `json:"counted_cash,omitempty"`
+	Variance     *float64   `json:"variance,omitempty"` // counted - expected
+	OpenedAt     time.Time  `json:"opened_at"`
+	ClosedAt     *time.Time `json:"closed_at,omitempty"`
+	ClosedBy     *int64     `json:"closed_by,omitempty"`
+}
+
+type CashMovement struct {
+	ID        int64     `json:"id"`
+	ShiftID   int64     `json:"shift_id"`
+	Kind      string    `json:"kind"` // "paid_in" or "paid_out"
+	Amount    float64   `json:"amount"`
+	Reason    string    `json:"reason"`
+	UserID    int64     `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Unit is a unit of measure. Decimals is how many decimal places a
+// quantity in it may have: 0 for pieces, 3 for kilograms.
+type Unit struct {
+	Code     string `json:"code"`
+	Name     string `json:"name"`
+	Decimals int    `json:"decimals"`
+}
+
+// ProductUnit is a purchase unit of a product, e.g. a case of 24. Factor
+// is how many of the product's own unit one of it holds.
+type ProductUnit struct {
+	ID        int64     `json:"id"`
+	ProductID int64     `json:"product_id"`
+	Name      string    `json:"name"`
+	Factor    float64   `json:"factor"`
+	CreatedAt time.Time `json:"created_at"`
+}
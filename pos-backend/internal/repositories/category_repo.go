@@ -0,0 +1,272 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"pos-backend/internal/models"
+)
+
+var (
+	ErrCategoryNotFound  = errors.New("category not found")
+	ErrCategoryCycle     = errors.New("a category cannot be moved under itself or one of its subcategories")
+	ErrCategoryInUse     = errors.New("category still has subcategories or products")
+	ErrCategoryNameTaken = errors.New("a category with this name already exists at this level")
+)
+
+// categorySubtree selects the id bound to it and the ids of every category
+// below it.
+const categorySubtree = `WITH RECURSIVE subtree(id) AS (
+    SELECT ?
+    UNION ALL
+    SELECT c.id FROM categories c JOIN subtree ON c.parent_id = subtree.id
+) SELECT id FROM subtree`
+
+type CategoryRepository struct {
+	db *sql.DB
+}
+
+func NewCategoryRepository(db *sql.DB) *CategoryRepository {
+	return &CategoryRepository{db: db}
+}
+
+func scanCategory(row rowScanner, c *models.Category) error {
+	var parentID sql.NullInt64
+	if err := row.Scan(&c.ID, &c.Name, &parentID, &c.SortOrder, &c.Active, &c.CreatedAt, &c.UpdatedAt); err != nil {
+		return err
+	}
+	if parentID.Valid {
+		c.ParentID = &parentID.Int64
+	}
+	return nil
+}
+
+// GetAll returns the categories as a flat list in display order. Use
+// GetTree for navigation.
+func (r *CategoryRepository) GetAll(ctx context.Context, includeInactive bool) ([]models.Category, error) {
+	query := `SELECT id, name, parent_id, sort_order, active, created_at, updated_at FROM categories`
+	if !includeInactive {
+		query += ` WHERE active = 1`
+	}
+	query += ` ORDER BY sort_order, name COLLATE NOCASE, id`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []models.Category{}
+	for rows.Next() {
+		var c models.Category
+		if err := scanCategory(rows, &c); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// GetTree returns the top-level categories with their subcategories nested
+// in Children. Without includeInactive, an inactive category hides its
+// whole branch.
+func (r *CategoryRepository) GetTree(ctx context.Context, includeInactive bool) ([]models.Category, error) {
+	flat, err := r.GetAll(ctx, includeInactive)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int64][]models.Category)
+	var roots []models.Category
+	for _, c := range flat {
+		if c.ParentID == nil {
+			roots = append(roots, c)
+		} else {
+			children[*c.ParentID] = append(children[*c.ParentID], c)
+		}
+	}
+
+	var attach func(list []models.Category) []models.Category
+	attach = func(list []models.Category) []models.Category {
+		for i := range list {
+			list[i].Children = attach(children[list[i].ID])
+		}
+		return list
+	}
+
+	tree := attach(roots)
+	if tree == nil {
+		tree = []models.Category{}
+	}
+	return tree, nil
+}
+
+// GetByID returns the category with its direct subcategories.
+func (r *CategoryRepository) GetByID(ctx context.Context, id int64) (*models.Category, error) {
+	row := r.db.QueryRowContext(ctx,
+		`SELECT id, name, parent_id, sort_order, active, created_at, updated_at FROM categories WHERE id = ?`, id)
+
+	var c models.Category
+	if err := scanCategory(row, &c); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, name, parent_id, sort_order, active, created_at, updated_at
+         FROM categories
+         WHERE parent_id = ?
+         ORDER BY sort_order, name COLLATE NOCASE, id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var child models.Category
+		if err := scanCategory(rows, &child); err != nil {
+			return nil, err
+		}
+		c.Children = append(c.Children, child)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
+}
+
+func (r *CategoryRepository) Create(ctx context.Context, c *models.Category) error {
+	now := time.Now().UTC()
+
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO categories (name, parent_id, sort_order, active, created_at, updated_at)
+         VALUES (?, ?, ?, ?, ?, ?)`,
+		c.Name, c.ParentID, c.SortOrder, c.Active, now, now,
+	)
+	if err != nil {
+		return categoryWriteError(err)
+	}
+
+	c.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.CreatedAt = now
+	c.UpdatedAt = now
+
+	return nil
+}
+
+// Update renames, reorders, moves or (de)activates a category. Moving it
+// under itself or one of its own subcategories returns ErrCategoryCycle.
+func (r *CategoryRepository) Update(ctx context.Context, c *models.Category) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if c.ParentID != nil {
+		var cycle bool
+		err = tx.QueryRowContext(ctx,
+			`SELECT ? IN (`+categorySubtree+`)`,
+			*c.ParentID, c.ID,
+		).Scan(&cycle)
+		if err != nil {
+			return err
+		}
+		if cycle {
+			err = ErrCategoryCycle
+			return err
+		}
+	}
+
+	now := time.Now().UTC()
+	var res sql.Result
+	res, err = tx.ExecContext(ctx,
+		`UPDATE categories SET name = ?, parent_id = ?, sort_order = ?, active = ?, updated_at = ? WHERE id = ?`,
+		c.Name, c.ParentID, c.SortOrder, c.Active, now, c.ID,
+	)
+	if err != nil {
+		err = categoryWriteError(err)
+		return err
+	}
+
+	var n int64
+	n, err = res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		err = sql.ErrNoRows
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	c.UpdatedAt = now
+	return nil
+}
+
+// Delete removes an empty category. Categories that still have
+// subcategories or products return ErrCategoryInUse; deactivate those
+// instead.
+func (r *CategoryRepository) Delete(ctx context.Context, id int64) error {
+	var inUse bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM categories WHERE parent_id = ?)
+             OR EXISTS (SELECT 1 FROM products WHERE category_id = ?)`,
+		id, id,
+	).Scan(&inUse)
+	if err != nil {
+		return err
+	}
+	if inUse {
+		return ErrCategoryInUse
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM categories WHERE id = ?`, id)
+	if err != nil {
+		if isForeignKeyViolation(err) {
+			return ErrCategoryInUse
+		}
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// categoryWriteError maps constraint failures on categories: the only
+// foreign key is the parent.
+func categoryWriteError(err error) error {
+	switch {
+	case isUniqueViolation(err):
+		return ErrCategoryNameTaken
+	case isForeignKeyViolation(err):
+		return ErrCategoryNotFound
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// pageLimit applies the default and maximum page size to a requested limit.
+func pageLimit(n int) int {
+	if n <= 0 {
+		return defaultPageSize
+	}
+	return min(n, maxPageSize)
+}
+
+// listCursor is the keyset position after the last row of a page. Key is
+// the sort column value of that row and ID breaks ties, so a page starts
+// exactly where the previous one stopped even while rows are added.
+type listCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d"`
+	Key  any    `json:"k,omitempty"` // nil when the listing is ordered by id alone
+	ID   int64  `json:"i"`
+}
+
+func (c listCursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeListCursor parses a cursor and checks it was issued for the same
+// ordering as the current request.
+func decodeListCursor(s, sort string, desc bool) (listCursor, error) {
+	var c listCursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return c, ErrInvalidCursor
+	}
+	if c.Sort != sort || c.Desc != desc {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// keyset returns the condition selecting rows after c and the matching
+// ORDER BY clause, for rows ordered by col and then by idCol. An empty col
+// orders by idCol alone.
+func keyset(col, idCol string, desc bool, c *listCursor) (string, []any, string) {
+	cmp, dir := ">", "ASC"
+	if desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	order := ` ORDER BY ` + idCol + ` ` + dir
+	if col != "" {
+		order = ` ORDER BY ` + col + ` ` + dir + `, ` + idCol + ` ` + dir
+	}
+
+	if c == nil {
+		return "", nil, order
+	}
+	if col == "" {
+		return idCol + ` ` + cmp + ` ?`, []any{c.ID}, order
+	}
+	return `(` + col + ` ` + cmp + ` ? OR (` + col + ` = ? AND ` + idCol + ` ` + cmp + ` ?))`,
+		[]any{c.Key, c.Key, c.ID}, order
+}
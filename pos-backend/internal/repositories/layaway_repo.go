@@ -0,0 +1,574 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"pos-backend/internal/models"
+)
+
+const (
+	LayawayStatusOpen      = "open"
+	LayawayStatusCompleted = "completed"
+	LayawayStatusCancelled = "cancelled"
+
+	reservationSourceLayaway = "layaway"
+
+	// paymentMethodLayaway is the tender on the sale a layaway turns into;
+	// the money itself was already taken as layaway payments.
+	paymentMethodLayaway = "layaway"
+)
+
+var (
+	ErrLayawayNotOpen     = errors.New("layaway is not open")
+	ErrDepositTooSmall    = errors.New("deposit is below the minimum")
+	ErrLayawayOverpayment = errors.New("payment exceeds the balance due")
+)
+
+// LayawayPolicy holds the store rules for deposits and cancellations.
+type LayawayPolicy struct {
+	MinDepositPercent float64       // share of the total required up front, e.g. 0.2
+	DefaultTerm       time.Duration // due date when none is given
+	ForfeitPercent    float64       // share of the amount paid kept on cancellation
+	ForfeitFlatFee    float64       // kept on cancellation on top of ForfeitPercent
+}
+
+// forfeit returns how much of paid the store keeps when a layaway is
+// cancelled. It never exceeds what the customer has paid.
+func (p LayawayPolicy) forfeit(paid float64) float64 {
+	return roundMoney(math.Min(paid, p.ForfeitFlatFee+paid*p.ForfeitPercent))
+}
+
+type LayawayRepository struct {
+	db       *sql.DB
+	pricing  PricingConfig
+	receipts ReceiptConfig
+	policy   LayawayPolicy
+}
+
+func NewLayawayRepository(db *sql.DB, pricing PricingConfig, receipts ReceiptConfig, policy LayawayPolicy) *LayawayRepository {
+	return &LayawayRepository{db: db, pricing: pricing, receipts: receipts, policy: policy}
+}
+
+type CreateLayawayParams struct {
+	CustomerName  string
+	CustomerPhone string
+	Items         []CreateSaleItemParam
+	DueDate       time.Time // zero = policy default
+	Deposit       TenderParam
+	UserID        int64
+	TerminalID    string
+}
+
+type LayawayPaymentParams struct {
+	Method     string
+	Amount     float64
+	UserID     int64
+	TerminalID string
+}
+
+type LayawayFilter struct {
+	Status  string
+	Overdue bool
+}
+
+// Create prices the cart, reserves its stock and records the deposit. The
+// line prices are locked in and reused when the layaway becomes a sale.
+func (r *LayawayRepository) Create(ctx context.Context, params *CreateLayawayParams) (*models.Layaway, error) {
+	id, err := retryOnBusy(ctx, func() (int64, error) {
+		return r.create(ctx, params)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// read back outside the retry so a busy read cannot repeat the write
+	return r.GetByID(ctx, id)
+}
+
+func (r *LayawayRepository) create(ctx context.Context, params *CreateLayawayParams) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UTC()
+
+	quote, err := priceSale(ctx, tx, r.pricing, &CreateSaleParams{Items: params.Items, UserID: params.UserID}, now)
+	if err != nil {
+		return 0, err
+	}
+
+	if params.Deposit.Amount < roundMoney(quote.TotalAmount*r.policy.MinDepositPercent) {
+		err = ErrDepositTooSmall
+		return 0, err
+	}
+	if params.Deposit.Amount > quote.TotalAmount {
+		err = ErrLayawayOverpayment
+		return 0, err
+	}
+
+	dueDate := params.DueDate
+	if dueDate.IsZero() {
+		dueDate = now.Add(r.policy.DefaultTerm)
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO layaways (customer_name, customer_phone, status, subtotal, discount_amount, tax_amount, total_amount,
+                               due_date, user_id, terminal_id, created_at)
+         VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		params.CustomerName, params.CustomerPhone, LayawayStatusOpen, quote.Subtotal, quote.DiscountAmount,
+		quote.TaxAmount, quote.TotalAmount, dueDate, params.UserID, params.TerminalID, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range quote.Items {
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO layaway_items (layaway_id, product_id, quantity, list_price, unit_price, discount_amount, tax_amount, line_total)
+             VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			id, item.ProductID, item.Quantity, item.ListPrice, item.UnitPrice, item.Discount, item.TaxAmount, item.LineTotal,
+		)
+		if err != nil {
+			return 0, err
+		}
+
+		// held until the layaway is completed or cancelled; a kit holds
+		// its components
+		held := []models.SaleItemComponent{{ProductID: item.ProductID, Quantity: item.Quantity}}
+		if len(item.Components) > 0 {
+			held = item.Components
+		}
+		for _, h := range held {
+			_, err = tx.ExecContext(ctx,
+				`INSERT INTO stock_reservations (source, source_id, product_id, quantity, created_at)
+                 VALUES (?, ?, ?, ?, ?)`,
+				reservationSourceLayaway, id, h.ProductID, h.Quantity, now,
+			)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if params.Deposit.Amount > 0 {
+		err = r.recordPayment(ctx, tx, id, &LayawayPaymentParams{
+			Method:     params.Deposit.Method,
+			Amount:     params.Deposit.Amount,
+			UserID:     params.UserID,
+			TerminalID: params.TerminalID,
+		}, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	l, err := getLayaway(ctx, tx, id, now)
+	if err != nil {
+		return 0, err
+	}
+
+	if l.BalanceDue <= 0 {
+		if err = r.complete(ctx, tx, l, params.UserID, params.TerminalID, now); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// AddPayment records an installment. The payment that clears the balance
+// converts the layaway into a completed sale in the same transaction.
+func (r *LayawayRepository) AddPayment(ctx context.Context, id int64, params *LayawayPaymentParams) (*models.Layaway, error) {
+	_, err := retryOnBusy(ctx, func() (int64, error) {
+		return r.addPayment(ctx, id, params)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// read back outside the retry so a busy read cannot repeat the write
+	return r.GetByID(ctx, id)
+}
+
+func (r *LayawayRepository) addPayment(ctx context.Context, id int64, params *LayawayPaymentParams) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UTC()
+
+	l, err := getLayaway(ctx, tx, id, now)
+	if err != nil {
+		return 0, err
+	}
+	if l.Status != LayawayStatusOpen {
+		err = ErrLayawayNotOpen
+		return 0, err
+	}
+	if params.Amount > l.BalanceDue {
+		err = ErrLayawayOverpayment
+		return 0, err
+	}
+
+	if err = r.recordPayment(ctx, tx, id, params, now); err != nil {
+		return 0, err
+	}
+
+	l, err = getLayaway(ctx, tx, id, now)
+	if err != nil {
+		return 0, err
+	}
+
+	if l.BalanceDue <= 0 {
+		if err = r.complete(ctx, tx, l, params.UserID, params.TerminalID, now); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// Cancel releases the reserved stock and refunds what was paid minus the
+// forfeit set by the store policy.
+func (r *LayawayRepository) Cancel(ctx context.Context, id int64, refundMethod string, userID int64, terminalID string) (*models.Layaway, error) {
+	_, err := retryOnBusy(ctx, func() (int64, error) {
+		return r.cancel(ctx, id, refundMethod, userID, terminalID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// read back outside the retry so a busy read cannot repeat the write
+	return r.GetByID(ctx, id)
+}
+
+func (r *LayawayRepository) cancel(ctx context.Context, id int64, refundMethod string, userID int64, terminalID string) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UTC()
+
+	l, err := getLayaway(ctx, tx, id, now)
+	if err != nil {
+		return 0, err
+	}
+	if l.Status != LayawayStatusOpen {
+		err = ErrLayawayNotOpen
+		return 0, err
+	}
+
+	forfeited := r.policy.forfeit(l.PaidAmount)
+	refund := roundMoney(l.PaidAmount - forfeited)
+
+	if refund > 0 {
+		err = r.recordPayment(ctx, tx, id, &LayawayPaymentParams{
+			Method:     refundMethod,
+			Amount:     -refund,
+			UserID:     userID,
+			TerminalID: terminalID,
+		}, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE layaways SET status = ?, forfeited_amount = ?, refunded_amount = ?, closed_at = ? WHERE id = ?`,
+		LayawayStatusCancelled, forfeited, refund, now, id,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	if err = releaseReservations(ctx, tx, reservationSourceLayaway, id); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+
+	return id, nil
+}
+
+func (r *LayawayRepository) GetAll(ctx context.Context, filter LayawayFilter) ([]models.Layaway, error) {
+	now := time.Now().UTC()
+
+	var conds []string
+	var args []any
+	if filter.Status != "" {
+		conds = append(conds, `l.status = ?`)
+		args = append(args, filter.Status)
+	}
+	if filter.Overdue {
+		conds = append(conds, `l.status = ? AND l.due_date < ?`)
+		args = append(args, LayawayStatusOpen, now)
+	}
+
+	query := layawaySelect
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	query += ` ORDER BY l.id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.Layaway
+	for rows.Next() {
+		var l models.Layaway
+		if err := scanLayaway(rows, &l, now); err != nil {
+			return nil, err
+		}
+		list = append(list, l)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+func (r *LayawayRepository) GetByID(ctx context.Context, id int64) (*models.Layaway, error) {
+	l, err := getLayaway(ctx, r.db, id, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	itemRows, err := r.db.QueryContext(ctx,
+		`SELECT li.id, li.layaway_id, li.product_id, p.name, li.quantity, li.list_price, li.unit_price,
+                li.discount_amount, li.tax_amount, li.line_total
+         FROM layaway_items li
+         JOIN products p ON li.product_id = p.id
+         WHERE li.layaway_id = ?
+         ORDER BY li.id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var item models.LayawayItem
+		if err := itemRows.Scan(
+			&item.ID,
+			&item.LayawayID,
+			&item.ProductID,
+			&item.ProductName,
+			&item.Quantity,
+			&item.ListPrice,
+			&item.UnitPrice,
+			&item.DiscountAmount,
+			&item.TaxAmount,
+			&item.LineTotal,
+		); err != nil {
+			return nil, err
+		}
+		l.Items = append(l.Items, item)
+	}
+
+	if err := itemRows.Err(); err != nil {
+		return nil, err
+	}
+
+	paymentRows, err := r.db.QueryContext(ctx,
+		`SELECT id, layaway_id, method, amount, user_id, terminal_id, COALESCE(shift_id, 0), created_at
+         FROM layaway_payments
+         WHERE layaway_id = ?
+         ORDER BY id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer paymentRows.Close()
+
+	for paymentRows.Next() {
+		var p models.LayawayPayment
+		if err := paymentRows.Scan(
+			&p.ID,
+			&p.LayawayID,
+			&p.Method,
+			&p.Amount,
+			&p.UserID,
+			&p.TerminalID,
+			&p.ShiftID,
+			&p.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		l.Payments = append(l.Payments, p)
+	}
+
+	if err := paymentRows.Err(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// recordPayment stores a payment (or a negative refund) against the open
+// shift of the terminal, so deposits show up in the drawer count.
+func (r *LayawayRepository) recordPayment(ctx context.Context, tx dbtx, id int64, p *LayawayPaymentParams, now time.Time) error {
+	shiftID, err := openShiftID(ctx, tx, p.TerminalID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO layaway_payments (layaway_id, method, amount, user_id, terminal_id, shift_id, created_at)
+         VALUES (?, ?, ?, ?, ?, NULLIF(?, 0), ?)`,
+		id, p.Method, p.Amount, p.UserID, p.TerminalID, shiftID, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE layaways SET paid_amount = ROUND(paid_amount + ?, 2) WHERE id = ?`,
+		p.Amount, id,
+	)
+	return err
+}
+
+// complete turns a fully paid layaway into a sale at the locked-in prices
+// and tax, so the sale total is the total the customer paid off.
+// The reservation is released first so the sale can take the stock.
+func (r *LayawayRepository) complete(ctx context.Context, tx dbtx, l *models.Layaway, userID int64, terminalID string, now time.Time) error {
+	if err := releaseReservations(ctx, tx, reservationSourceLayaway, l.ID); err != nil {
+		return err
+	}
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT product_id, quantity, list_price, unit_price, discount_amount, tax_amount, line_total
+         FROM layaway_items WHERE layaway_id = ? ORDER BY id`,
+		l.ID,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var items []CreateSaleItemParam
+	var locked []lockedLine
+	for rows.Next() {
+		var it CreateSaleItemParam
+		var lk lockedLine
+		var unitPrice float64
+		if err := rows.Scan(&it.ProductID, &it.Quantity, &lk.ListPrice, &unitPrice, &lk.Discount, &lk.TaxAmount, &lk.LineTotal); err != nil {
+			return err
+		}
+		it.UnitPriceOverride = &unitPrice
+		items = append(items, it)
+		locked = append(locked, lk)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	sale, err := createSale(ctx, tx, r.pricing, r.receipts, &CreateSaleParams{
+		Items:         items,
+		Tenders:       []TenderParam{{Method: paymentMethodLayaway, Amount: l.TotalAmount}},
+		UserID:        userID,
+		TerminalID:    terminalID,
+		allowArchived: true,
+		locked:        locked,
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE layaways SET status = ?, sale_id = ?, closed_at = ? WHERE id = ?`,
+		LayawayStatusCompleted, sale.ID, now, l.ID,
+	)
+	return err
+}
+
+const layawaySelect = `SELECT l.id, l.customer_name, l.customer_phone, l.status, l.subtotal, l.discount_amount,
+                l.tax_amount, l.total_amount, l.paid_amount, l.forfeited_amount, l.refunded_amount, l.due_date,
+                l.user_id, l.terminal_id, COALESCE(l.sale_id, 0), l.created_at, l.closed_at
+         FROM layaways l`
+
+func scanLayaway(row rowScanner, l *models.Layaway, now time.Time) error {
+	if err := row.Scan(
+		&l.ID,
+		&l.CustomerName,
+		&l.CustomerPhone,
+		&l.Status,
+		&l.Subtotal,
+		&l.DiscountAmount,
+		&l.TaxAmount,
+		&l.TotalAmount,
+		&l.PaidAmount,
+		&l.ForfeitedAmount,
+		&l.RefundedAmount,
+		&l.DueDate,
+		&l.UserID,
+		&l.TerminalID,
+		&l.SaleID,
+		&l.CreatedAt,
+		&l.ClosedAt,
+	); err != nil {
+		return err
+	}
+
+	if l.Status == LayawayStatusOpen {
+		l.BalanceDue = roundMoney(l.TotalAmount - l.PaidAmount)
+		l.Overdue = l.DueDate.Before(now)
+	}
+
+	return nil
+}
+
+func getLayaway(ctx context.Context, q dbtx, id int64, now time.Time) (*models.Layaway, error) {
+	var l models.Layaway
+	row := q.QueryRowContext(ctx, layawaySelect+` WHERE l.id = ?`, id)
+	if err := scanLayaway(row, &l, now); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
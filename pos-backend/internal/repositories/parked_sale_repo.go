@@ -0,0 +1,417 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pos-backend/internal/models"
+)
+
+var (
+	ErrParkedSaleNotFound   = errors.New("parked sale not found")
+	ErrParkedSaleResumed    = errors.New("parked sale has already been resumed")
+	ErrParkedSaleNotResumed = errors.New("parked sale has not been resumed")
+)
+
+type ParkedSaleRepository struct {
+	db *sql.DB
+}
+
+func NewParkedSaleRepository(db *sql.DB) *ParkedSaleRepository {
+	return &ParkedSaleRepository{db: db}
+}
+
+type ParkSaleParams struct {
+	Label        string
+	TerminalID   string
+	ReserveStock bool
+	TTL          time.Duration
+	Items        []CreateSaleItemParam
+}
+
+func (r *ParkedSaleRepository) Park(ctx context.Context, params *ParkSaleParams) (*models.ParkedSale, error) {
+	return retryOnBusy(ctx, func() (*models.ParkedSale, error) {
+		return r.park(ctx, params)
+	})
+}
+
+func (r *ParkedSaleRepository) park(ctx context.Context, params *ParkSaleParams) (*models.ParkedSale, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UTC()
+	if err = purgeExpiredParkedSales(ctx, tx, now); err != nil {
+		return nil, err
+	}
+
+	ps := &models.ParkedSale{
+		Label:        params.Label,
+		TerminalID:   params.TerminalID,
+		ReserveStock: params.ReserveStock,
+		ExpiresAt:    now.Add(params.TTL),
+		CreatedAt:    now,
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO parked_sales (label, terminal_id, reserve_stock, expires_at, created_at)
+         VALUES (?, ?, ?, ?, ?)`,
+		ps.Label, ps.TerminalID, ps.ReserveStock, ps.ExpiresAt, ps.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	ps.ID, err = res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	// a cart takes only what a sale could: lines are checked and resolved
+	// to product quantities (packs, label weights) the way priceSale does,
+	// and a cart that holds no stock leaves availability to the sale
+	quote, err := priceSale(ctx, tx, PricingConfig{}, &CreateSaleParams{Items: params.Items, ignoreStock: !ps.ReserveStock}, now)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, line := range quote.Items {
+		if ps.ReserveStock {
+			// a kit reserves its components rather than itself
+			held := []models.SaleItemComponent{{ProductID: line.ProductID, Quantity: line.Quantity}}
+			if len(line.Components) > 0 {
+				held = line.Components
+			}
+
+			for _, h := range held {
+				var stock, reserved float64
+				if err = tx.QueryRowContext(ctx, `SELECT stock FROM products WHERE id = ?`, h.ProductID).Scan(&stock); err != nil {
+					return nil, err
+				}
+				reserved, err = reservedStock(ctx, tx, h.ProductID, 0, now)
+				if err != nil {
+					return nil, err
+				}
+				if roundQuantity(stock-reserved) < h.Quantity {
+					err = ErrInsufficientStock
+					return nil, err
+				}
+
+				_, err = tx.ExecContext(ctx,
+					`INSERT INTO stock_reservations (source, source_id, product_id, quantity, expires_at, created_at)
+                     VALUES (?, ?, ?, ?, ?, ?)`,
+					reservationSourceParkedSale, ps.ID, h.ProductID, h.Quantity, ps.ExpiresAt, now,
+				)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		// scanned lines are parked with their barcode so the sale prices
+		// them from the label when resumed
+		it := params.Items[i]
+		res, err = tx.ExecContext(ctx,
+			`INSERT INTO parked_sale_items (parked_sale_id, product_id, barcode, quantity, unit_price)
+             VALUES (?, ?, NULLIF(?, ''), ?, ?)`,
+			ps.ID, line.ProductID, line.Barcode, it.Quantity, it.UnitPriceOverride,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		var itemID int64
+		itemID, err = res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		ps.Items = append(ps.Items, models.ParkedSaleItem{
+			ID:           itemID,
+			ParkedSaleID: ps.ID,
+			ProductID:    line.ProductID,
+			ProductName:  line.ProductName,
+			Barcode:      line.Barcode,
+			Quantity:     it.Quantity,
+			UnitPrice:    it.UnitPriceOverride,
+		})
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+// GetAll lists parked carts that have not expired or been resumed, newest
+// first. Items are included so any terminal can show what is in each cart.
+func (r *ParkedSaleRepository) GetAll(ctx context.Context) ([]models.ParkedSale, error) {
+	now := time.Now().UTC()
+	if err := purgeExpiredParkedSales(ctx, r.db, now); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, label, terminal_id, reserve_stock, expires_at, created_at
+         FROM parked_sales
+         WHERE expires_at > ? AND resumed_at IS NULL
+         ORDER BY id DESC`,
+		now,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []models.ParkedSale
+	for rows.Next() {
+		var ps models.ParkedSale
+		if err := rows.Scan(
+			&ps.ID,
+			&ps.Label,
+			&ps.TerminalID,
+			&ps.ReserveStock,
+			&ps.ExpiresAt,
+			&ps.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, ps)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range list {
+		items, err := getParkedSaleItems(ctx, r.db, list[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		list[i].Items = items
+	}
+
+	return list, nil
+}
+
+func (r *ParkedSaleRepository) GetByID(ctx context.Context, id int64) (*models.ParkedSale, error) {
+	return getParkedSale(ctx, r.db, id, time.Now().UTC())
+}
+
+// Resume hands the parked cart back to the caller and marks it resumed. Its
+// stock stays reserved until the sale is rung up with the cart's id as
+// ParkedSaleID, the cart is deleted or it expires. The update is guarded so
+// two terminals cannot resume the same cart.
+func (r *ParkedSaleRepository) Resume(ctx context.Context, id int64) (*models.ParkedSale, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := time.Now().UTC()
+	ps, err := getParkedSale(ctx, tx, id, now)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE parked_sales SET resumed_at = ? WHERE id = ? AND resumed_at IS NULL`, now, id)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		err = ErrParkedSaleResumed
+		return nil, err
+	}
+	ps.ResumedAt = &now
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ps, nil
+}
+
+func (r *ParkedSaleRepository) Delete(ctx context.Context, id int64) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var exists int
+	err = tx.QueryRowContext(ctx, `SELECT 1 FROM parked_sales WHERE id = ?`, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+
+	if err = deleteParkedSale(ctx, tx, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func getParkedSale(ctx context.Context, q dbtx, id int64, now time.Time) (*models.ParkedSale, error) {
+	var ps models.ParkedSale
+	var resumedAt sql.NullTime
+
+	row := q.QueryRowContext(ctx,
+		`SELECT id, label, terminal_id, reserve_stock, expires_at, resumed_at, created_at
+         FROM parked_sales WHERE id = ? AND expires_at > ?`,
+		id, now,
+	)
+
+	if err := row.Scan(
+		&ps.ID,
+		&ps.Label,
+		&ps.TerminalID,
+		&ps.ReserveStock,
+		&ps.ExpiresAt,
+		&resumedAt,
+		&ps.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	if resumedAt.Valid {
+		ps.ResumedAt = &resumedAt.Time
+	}
+
+	items, err := getParkedSaleItems(ctx, q, id)
+	if err != nil {
+		return nil, err
+	}
+	ps.Items = items
+
+	return &ps, nil
+}
+
+func getParkedSaleItems(ctx context.Context, q dbtx, parkedSaleID int64) ([]models.ParkedSaleItem, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT pi.id, pi.parked_sale_id, pi.product_id, p.name, COALESCE(pi.barcode, ''), pi.quantity, pi.unit_price
+         FROM parked_sale_items pi
+         JOIN products p ON pi.product_id = p.id
+         WHERE pi.parked_sale_id = ?
+         ORDER BY pi.id`,
+		parkedSaleID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.ParkedSaleItem
+	for rows.Next() {
+		var item models.ParkedSaleItem
+		if err := rows.Scan(
+			&item.ID,
+			&item.ParkedSaleID,
+			&item.ProductID,
+			&item.ProductName,
+			&item.Barcode,
+			&item.Quantity,
+			&item.UnitPrice,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// takeParkedSale removes the resumed cart a sale rings up, handing its
+// stock hold over to the sale. Only a live cart that was resumed can be
+// taken, so a sale cannot drop a cart another till is still holding.
+func takeParkedSale(ctx context.Context, q dbtx, id int64, now time.Time) error {
+	ps, err := getParkedSale(ctx, q, id, now)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %d", ErrParkedSaleNotFound, id)
+	}
+	if err != nil {
+		return err
+	}
+	if ps.ResumedAt == nil {
+		return fmt.Errorf("%w: %d", ErrParkedSaleNotResumed, id)
+	}
+
+	err = deleteParkedSale(ctx, q, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %d", ErrParkedSaleNotFound, id)
+	}
+	return err
+}
+
+// deleteParkedSale removes cart id and releases its stock, returning
+// sql.ErrNoRows when there is no such cart.
+func deleteParkedSale(ctx context.Context, q dbtx, id int64) error {
+	if err := releaseReservations(ctx, q, reservationSourceParkedSale, id); err != nil {
+		return err
+	}
+	if _, err := q.ExecContext(ctx, `DELETE FROM parked_sale_items WHERE parked_sale_id = ?`, id); err != nil {
+		return err
+	}
+	res, err := q.ExecContext(ctx, `DELETE FROM parked_sales WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// purgeExpiredParkedSales drops carts past their expiry together with their
+// reservations. It is called opportunistically before parking and listing.
+func purgeExpiredParkedSales(ctx context.Context, q dbtx, now time.Time) error {
+	_, err := q.ExecContext(ctx,
+		`DELETE FROM stock_reservations
+         WHERE source = ? AND source_id IN (SELECT id FROM parked_sales WHERE expires_at <= ?)`,
+		reservationSourceParkedSale, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx,
+		`DELETE FROM parked_sale_items
+         WHERE parked_sale_id IN (SELECT id FROM parked_sales WHERE expires_at <= ?)`,
+		now,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx, `DELETE FROM parked_sales WHERE expires_at <= ?`, now)
+	return err
+}
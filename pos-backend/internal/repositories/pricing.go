@@ -0,0 +1,609 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"pos-backend/internal/barcode"
+	"pos-backend/internal/models"
+)
+
+// PricingConfig holds the store-wide settings that affect how a cart is
+// priced and validated. The same values are used for quotes and committed
+// sales.
+type PricingConfig struct {
+	TaxRate            float64 // e.g. 0.15 for 15%, applied on top of the discounted line total
+	CashRounding       CashRounding
+	AllowNegativeStock bool // default for products without their own policy
+}
+
+const (
+	CashRoundingNearest = "nearest"
+	CashRoundingUp      = "up"
+	CashRoundingDown    = "down"
+)
+
+// CashRounding rounds the amount due on cash sales to the smallest coin in
+// circulation. Card and other tenders are always charged to the cent.
+type CashRounding struct {
+	Increment float64 // e.g. 0.05 or 0.10; 0 disables rounding
+	Mode      string  // CashRoundingNearest, CashRoundingUp or CashRoundingDown
+}
+
+// apply returns amount rounded to the configured increment.
+func (c CashRounding) apply(amount float64) float64 {
+	if c.Increment <= 0 {
+		return amount
+	}
+
+	// the epsilon keeps exact multiples like 12.35 / 0.05 from drifting
+	// into the next step because of float representation
+	steps := amount / c.Increment
+	switch c.Mode {
+	case CashRoundingUp:
+		steps = math.Ceil(steps - 1e-9)
+	case CashRoundingDown:
+		steps = math.Floor(steps + 1e-9)
+	default:
+		steps = math.Round(steps)
+	}
+
+	return roundMoney(steps * c.Increment)
+}
+
+type PricedLine struct {
+	ProductID   int64    `json:"product_id"`
+	ProductName string   `json:"product_name"`
+	Quantity    float64  `json:"quantity"`
+	ListPrice   float64  `json:"list_price"`
+	UnitPrice   float64  `json:"unit_price"`
+	Discount    float64  `json:"discount_amount"`
+	LineTotal   float64  `json:"line_total"` // after discount, before tax
+	TaxAmount   float64  `json:"tax_amount"`
+	UnitCost    *float64 `json:"unit_cost"` // per unit of Quantity, as of the sale; nil when unknown
+
+	ReturnedItemID int64 `json:"returned_item_id,omitempty"` // return lines only; amounts are negative
+
+	Barcode    string   `json:"barcode,omitempty"`     // scanned lines only
+	Weight     *float64 `json:"weight,omitempty"`      // kg, from a variable-weight label
+	Lot        string   `json:"lot,omitempty"`         // from a GS1 code
+	ExpiryDate string   `json:"expiry_date,omitempty"` // from a GS1 code, YYYY-MM-DD
+
+	// kit lines only: what each component gives and earns
+	Components []models.SaleItemComponent `json:"components,omitempty"`
+}
+
+// PricedTender is one payment towards the sale. Amount is the part applied
+// to the sale total; anything tendered beyond that is change. Tips ride on
+// the tender but are never part of the sale total.
+type PricedTender struct {
+	Method    string  `json:"method"`
+	Tendered  float64 `json:"tendered"`
+	Amount    float64 `json:"amount"`
+	TipAmount float64 `json:"tip_amount"`
+	TipUserID int64   `json:"tip_user_id,omitempty"`
+	TipPool   string  `json:"tip_pool,omitempty"`
+}
+
+type SaleQuote struct {
+	Items          []PricedLine   `json:"items"`
+	Subtotal       float64        `json:"subtotal"` // at list price
+	DiscountAmount float64        `json:"discount_amount"`
+	TaxAmount      float64        `json:"tax_amount"`
+	RoundingAmount float64        `json:"rounding_amount"` // cash rounding adjustment, may be negative
+	TotalAmount    float64        `json:"total_amount"`
+	PaymentMethod  string         `json:"payment_method"`
+	PaidAmount     float64        `json:"paid_amount"`
+	ChangeDue      float64        `json:"change_due"`
+	TipAmount      float64        `json:"tip_amount"`
+	Tenders        []PricedTender `json:"tenders"`
+}
+
+// priceSale is the single pricing code path for carts. It is used by Quote
+// on a read-only transaction and by Create inside the sale transaction, so
+// the totals shown on screen are the totals written to the receipt.
+func priceSale(ctx context.Context, q dbtx, cfg PricingConfig, params *CreateSaleParams, now time.Time) (*SaleQuote, error) {
+	quote := &SaleQuote{PaymentMethod: salePaymentMethod(params.Tenders)}
+
+	// every line is checked before giving up; inCart counts what earlier
+	// lines already take from the same product
+	var lineErrs []LineError
+	inCart := make(map[int64]float64)
+
+	for i, it := range params.Items {
+		// scanned lines resolve to a product here, on the same transaction,
+		// so label prices cannot be altered by the client
+		var scan *BarcodeScan
+		if it.Barcode != "" {
+			var err error
+			scan, err = resolveBarcode(ctx, q, it.Barcode)
+			if errors.Is(err, sql.ErrNoRows) || errors.Is(err, barcode.ErrInvalid) {
+				lineErrs = append(lineErrs, LineError{
+					Line:      i,
+					Barcode:   it.Barcode,
+					Code:      LineErrorBarcodeNotFound,
+					Requested: it.Quantity,
+				})
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			it.ProductID = scan.Product.ID
+			it.Quantity *= scan.PackQuantity
+
+			if scan.expiredOn(now) {
+				lineErrs = append(lineErrs, LineError{
+					Line:       i,
+					ProductID:  it.ProductID,
+					Barcode:    it.Barcode,
+					Code:       LineErrorExpired,
+					Requested:  it.Quantity,
+					ExpiryDate: scan.ExpiryDate,
+				})
+				continue
+			}
+		}
+
+		var productName string
+		var productPrice float64
+		var productCost *float64
+		var stock float64
+		var allowNegative, hasVariants, archived bool
+		var unit string
+		var decimals int
+
+		row := q.QueryRowContext(ctx,
+			`SELECT p.name, p.price, p.cost, p.stock, COALESCE(p.allow_negative_stock, ?),
+                    EXISTS (SELECT 1 FROM products v WHERE v.parent_id = p.id),
+                    p.unit, COALESCE(u.decimals, 0), p.archived_at IS NOT NULL
+             FROM products p
+             LEFT JOIN units u ON u.code = p.unit
+             WHERE p.id = ?`,
+			cfg.AllowNegativeStock, it.ProductID,
+		)
+
+		if err := row.Scan(&productName, &productPrice, &productCost, &stock, &allowNegative, &hasVariants, &unit, &decimals, &archived); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				lineErrs = append(lineErrs, LineError{
+					Line:      i,
+					ProductID: it.ProductID,
+					Code:      LineErrorProductNotFound,
+					Requested: it.Quantity,
+				})
+				continue
+			}
+			return nil, err
+		}
+
+		// archived products are kept for history but no longer sold
+		if archived && !params.allowArchived {
+			lineErrs = append(lineErrs, LineError{
+				Line:      i,
+				ProductID: it.ProductID,
+				Barcode:   it.Barcode,
+				Code:      LineErrorArchived,
+				Requested: it.Quantity,
+			})
+			continue
+		}
+
+		// a parent with variants only describes them; the cashier picks one
+		if hasVariants {
+			lineErrs = append(lineErrs, LineError{
+				Line:      i,
+				ProductID: it.ProductID,
+				Code:      LineErrorVariantRequired,
+				Requested: it.Quantity,
+			})
+			continue
+		}
+
+		if it.Quantity <= 0 {
+			lineErrs = append(lineErrs, LineError{
+				Line:      i,
+				ProductID: it.ProductID,
+				Barcode:   it.Barcode,
+				Code:      LineErrorInvalidQuantity,
+				Requested: it.Quantity,
+			})
+			continue
+		}
+
+		// goods stocked by weight sell the weight on their label, priced
+		// per unit, rather than one labelled pack
+		soldByWeight := false
+		var labelQuantity float64 // units of the product on one label
+		if scan != nil && scan.Weight != nil {
+			if perKg, ok := weightUnits[unit]; ok {
+				soldByWeight = true
+				labelQuantity = roundQuantity(*scan.Weight * perKg)
+				it.Quantity = roundQuantity(it.Quantity * *scan.Weight * perKg)
+			}
+		}
+
+		if !fitsPrecision(it.Quantity, decimals) {
+			lineErrs = append(lineErrs, LineError{
+				Line:      i,
+				ProductID: it.ProductID,
+				Barcode:   it.Barcode,
+				Code:      LineErrorInvalidQuantity,
+				Requested: it.Quantity,
+				Unit:      unit,
+				Decimals:  &decimals,
+			})
+			continue
+		}
+
+		// a kit holds no stock of its own; it sells what its components have
+		parts, err := kitParts(ctx, q, it.ProductID, cfg.AllowNegativeStock)
+		if err != nil {
+			return nil, err
+		}
+
+		// stock held by parked carts is not available to other tills
+		short := false
+		if len(parts) > 0 {
+			for _, part := range parts {
+				reserved, err := reservedStock(ctx, q, part.ProductID, params.ParkedSaleID, now)
+				if err != nil {
+					return nil, err
+				}
+
+				needed := roundQuantity(it.Quantity * part.Quantity)
+				available := max(roundQuantity(part.Stock-reserved-inCart[part.ProductID]), 0)
+				inCart[part.ProductID] += needed
+				if available < needed && !part.AllowNegative && !params.ignoreStock && !short {
+					short = true
+					lineErrs = append(lineErrs, LineError{
+						Line:        i,
+						ProductID:   it.ProductID,
+						ComponentID: part.ProductID,
+						Code:        LineErrorInsufficientStock,
+						Requested:   needed,
+						Available:   &available,
+					})
+				}
+			}
+		} else {
+			reserved, err := reservedStock(ctx, q, it.ProductID, params.ParkedSaleID, now)
+			if err != nil {
+				return nil, err
+			}
+
+			available := max(roundQuantity(stock-reserved-inCart[it.ProductID]), 0)
+			inCart[it.ProductID] += it.Quantity
+			if available < it.Quantity && !allowNegative && !params.ignoreStock {
+				short = true
+				lineErrs = append(lineErrs, LineError{
+					Line:      i,
+					ProductID: it.ProductID,
+					Code:      LineErrorInsufficientStock,
+					Requested: it.Quantity,
+					Available: &available,
+				})
+			}
+		}
+		if short {
+			continue
+		}
+
+		// a scale label fixes the price of one labelled pack; the net
+		// weight of a GS1 code only describes the pack of anything not
+		// sold by weight
+		listPrice, unitCost := productPrice, productCost
+		var barcodeCode, lot, expiryDate string
+		var weight *float64
+		if scan != nil {
+			barcodeCode, weight = scan.Code, scan.Weight
+			lot, expiryDate = scan.Lot, scan.ExpiryDate
+			perKgLabel := scan.Weight != nil && !soldByWeight && scan.Rule != nil
+			switch {
+			case scan.Price != nil && soldByWeight && labelQuantity > 0:
+				// the printed price is for the whole label
+				listPrice = *scan.Price / labelQuantity
+			case scan.Price != nil:
+				listPrice = *scan.Price
+			case perKgLabel:
+				listPrice = roundMoney(productPrice * *scan.Weight)
+			}
+			if perKgLabel && productCost != nil {
+				cost := *productCost * *scan.Weight
+				unitCost = &cost
+			}
+		}
+
+		unitPrice := listPrice
+		if it.UnitPriceOverride != nil {
+			unitPrice = *it.UnitPriceOverride
+			// charging more than the list price is a price change, not a
+			// negative discount
+			listPrice = max(listPrice, unitPrice)
+		}
+
+		gross := roundMoney(listPrice * it.Quantity)
+		lineTotal := roundMoney(unitPrice * it.Quantity)
+		tax := roundMoney(lineTotal * cfg.TaxRate)
+
+		quote.Items = append(quote.Items, PricedLine{
+			ProductID:   it.ProductID,
+			ProductName: productName,
+			Quantity:    it.Quantity,
+			ListPrice:   listPrice,
+			UnitPrice:   unitPrice,
+			Discount:    roundMoney(gross - lineTotal),
+			LineTotal:   lineTotal,
+			TaxAmount:   tax,
+			UnitCost:    unitCost,
+			Barcode:     barcodeCode,
+			Weight:      weight,
+			Lot:         lot,
+			ExpiryDate:  expiryDate,
+		})
+		if len(parts) > 0 {
+			line := &quote.Items[len(quote.Items)-1]
+			line.Components = kitLineComponents(parts, it.Quantity, lineTotal)
+			line.UnitCost = kitCost(parts)
+		}
+
+		quote.Subtotal += gross
+		quote.DiscountAmount += gross - lineTotal
+		quote.TaxAmount += tax
+	}
+
+	if len(lineErrs) > 0 {
+		return nil, &SaleLinesError{Lines: lineErrs}
+	}
+
+	if params.locked != nil {
+		quote.Subtotal, quote.DiscountAmount, quote.TaxAmount = 0, 0, 0
+		for i, l := range params.locked {
+			line := &quote.Items[i]
+			line.ListPrice, line.Discount, line.TaxAmount, line.LineTotal = l.ListPrice, l.Discount, l.TaxAmount, l.LineTotal
+			quote.Subtotal += l.LineTotal + l.Discount
+			quote.DiscountAmount += l.Discount
+			quote.TaxAmount += l.TaxAmount
+		}
+	}
+
+	if params.OriginalSaleID != 0 {
+		returns, err := priceReturns(ctx, q, params.OriginalSaleID, params.Returns)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range returns {
+			quote.Items = append(quote.Items, line)
+			quote.Subtotal += roundMoney(line.ListPrice * line.Quantity)
+			quote.DiscountAmount += line.Discount
+			quote.TaxAmount += line.TaxAmount
+		}
+	}
+
+	quote.Subtotal = roundMoney(quote.Subtotal)
+	quote.DiscountAmount = roundMoney(quote.DiscountAmount)
+	quote.TaxAmount = roundMoney(quote.TaxAmount)
+	quote.TotalAmount = roundMoney(quote.Subtotal - quote.DiscountAmount + quote.TaxAmount)
+
+	if params.OriginalSaleID != 0 && quote.TotalAmount < 0 {
+		return priceRefund(quote, cfg, params)
+	}
+
+	// Cash rounding applies only to the part of the total settled in cash.
+	var nonCash float64
+	hasCash := false
+	for _, t := range params.Tenders {
+		if t.Method == paymentMethodCash {
+			hasCash = true
+		} else {
+			nonCash += t.Amount
+		}
+	}
+	if due := roundMoney(quote.TotalAmount - nonCash); hasCash && due > 0 {
+		rounded := cfg.CashRounding.apply(due)
+		quote.RoundingAmount = roundMoney(rounded - due)
+		quote.TotalAmount = roundMoney(quote.TotalAmount + quote.RoundingAmount)
+	}
+
+	quote.Tenders = make([]PricedTender, len(params.Tenders))
+	remaining := quote.TotalAmount
+
+	// Non-cash tenders are applied first because only cash can give change.
+	for _, cashPass := range []bool{false, true} {
+		for i, t := range params.Tenders {
+			if (t.Method == paymentMethodCash) != cashPass {
+				continue
+			}
+
+			applied := math.Max(0, math.Min(t.Amount, remaining))
+			remaining = roundMoney(remaining - applied)
+
+			tipUserID := t.TipUserID
+			if t.TipAmount > 0 && tipUserID == 0 && t.TipPool == "" {
+				tipUserID = params.UserID
+			}
+			if t.TipUserID != 0 {
+				var exists bool
+				err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM users WHERE id = ?)`, t.TipUserID).Scan(&exists)
+				if err != nil {
+					return nil, err
+				}
+				if !exists {
+					return nil, fmt.Errorf("%w: %d", ErrTipUserNotFound, t.TipUserID)
+				}
+			}
+
+			quote.Tenders[i] = PricedTender{
+				Method:    t.Method,
+				Tendered:  t.Amount,
+				Amount:    roundMoney(applied),
+				TipAmount: t.TipAmount,
+				TipUserID: tipUserID,
+				TipPool:   t.TipPool,
+			}
+		}
+	}
+
+	var applied float64
+	for _, t := range quote.Tenders {
+		quote.PaidAmount += t.Tendered
+		quote.TipAmount += t.TipAmount
+		applied += t.Amount
+	}
+	quote.PaidAmount = roundMoney(quote.PaidAmount)
+	quote.TipAmount = roundMoney(quote.TipAmount)
+
+	if quote.PaidAmount > applied {
+		quote.ChangeDue = roundMoney(quote.PaidAmount - applied)
+	}
+
+	return quote, nil
+}
+
+// priceReturns values the lines brought back in an exchange at what the
+// customer originally paid for them, not at today's price. Quantities and
+// amounts on the returned lines are negative.
+func priceReturns(ctx context.Context, q dbtx, originalSaleID int64, returns []ReturnItemParam) ([]PricedLine, error) {
+	var exists int
+	err := q.QueryRowContext(ctx, `SELECT 1 FROM sales WHERE id = ?`, originalSaleID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+
+	// quantity taken back per original line so far in this request
+	pending := make(map[int64]float64)
+
+	var lines []PricedLine
+	for _, rt := range returns {
+		if rt.Quantity <= 0 {
+			return nil, errors.New("return quantity must be greater than zero")
+		}
+
+		query := `SELECT si.id, si.product_id, p.name, si.quantity, si.list_price, si.unit_price,
+                         si.tax_amount, si.line_total, si.unit_cost,
+                         COALESCE((SELECT -SUM(r.quantity) FROM sale_items r WHERE r.returned_item_id = si.id), 0)
+                  FROM sale_items si
+                  JOIN products p ON si.product_id = p.id
+                  WHERE si.sale_id = ? AND si.quantity > 0`
+		args := []any{originalSaleID}
+		if rt.SaleItemID != 0 {
+			query += ` AND si.id = ?`
+			args = append(args, rt.SaleItemID)
+		} else {
+			query += ` AND si.product_id = ? ORDER BY si.id`
+			args = append(args, rt.ProductID)
+		}
+
+		rows, err := q.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			line                 PricedLine
+			soldQty              float64
+			tax, total           float64
+			matched, hasQuantity bool
+		)
+		for rows.Next() {
+			var returned float64
+			if err := rows.Scan(&line.ReturnedItemID, &line.ProductID, &line.ProductName, &soldQty,
+				&line.ListPrice, &line.UnitPrice, &tax, &total, &line.UnitCost, &returned); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			matched = true
+			// by product, take the first line that still has enough left
+			if roundQuantity(soldQty-returned-pending[line.ReturnedItemID]) >= rt.Quantity {
+				hasQuantity = true
+				break
+			}
+		}
+		if err := rows.Err(); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rows.Close()
+
+		if !matched {
+			return nil, ErrReturnNotFound
+		}
+		if !hasQuantity {
+			return nil, ErrReturnExceedsSold
+		}
+		pending[line.ReturnedItemID] += rt.Quantity
+
+		share := rt.Quantity / soldQty
+		gross := negateMoney(roundMoney(line.ListPrice * rt.Quantity))
+		line.Quantity = -rt.Quantity
+		line.LineTotal = negateMoney(roundMoney(total * share))
+		line.Discount = roundMoney(gross - line.LineTotal)
+		line.TaxAmount = negateMoney(roundMoney(tax * share))
+
+		// a returned kit goes back as the components it was sold as
+		line.Components, err = returnedComponents(ctx, q, line.ReturnedItemID, share, line.LineTotal)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return lines, nil
+}
+
+// priceRefund settles an exchange in the customer's favour. The whole
+// difference goes back on one refund tender; cash refunds are rounded on
+// their magnitude like any other cash amount.
+func priceRefund(quote *SaleQuote, cfg PricingConfig, params *CreateSaleParams) (*SaleQuote, error) {
+	if len(params.Tenders) > 0 {
+		return nil, ErrNoPaymentDue
+	}
+
+	method := params.RefundMethod
+	if method == "" {
+		method = paymentMethodCash
+	}
+
+	if method == paymentMethodCash {
+		rounded := -cfg.CashRounding.apply(-quote.TotalAmount)
+		quote.RoundingAmount = roundMoney(rounded - quote.TotalAmount)
+		quote.TotalAmount = rounded
+	}
+
+	quote.PaymentMethod = method
+	quote.PaidAmount = quote.TotalAmount
+	quote.Tenders = []PricedTender{{
+		Method:   method,
+		Tendered: quote.TotalAmount,
+		Amount:   quote.TotalAmount,
+	}}
+
+	return quote, nil
+}
+
+// salePaymentMethod summarises the tenders for the sales.payment_method
+// column: the method itself when there is only one, otherwise "split".
+func salePaymentMethod(tenders []TenderParam) string {
+	if len(tenders) == 0 {
+		return ""
+	}
+	for _, t := range tenders[1:] {
+		if t.Method != tenders[0].Method {
+			return paymentMethodSplit
+		}
+	}
+	return tenders[0].Method
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+// negateMoney flips the sign without producing -0, which would otherwise
+// show up as "-0" in JSON for untaxed return lines.
+func negateMoney(v float64) float64 {
+	return 0 - v
+}
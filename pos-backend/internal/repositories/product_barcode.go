@@ -0,0 +1,342 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pos-backend/internal/barcode"
+	"pos-backend/internal/models"
+)
+
+const dateLayout = "2006-01-02"
+
+var (
+	ErrBarcodeTaken      = errors.New("barcode is already assigned to a product")
+	ErrPLUTaken          = errors.New("PLU is already assigned to a product")
+	ErrBarcodeRuleExists = errors.New("a barcode rule for this prefix already exists")
+)
+
+// AddBarcode validates b and attaches it to its product. A missing
+// symbology is detected from the code. It returns sql.ErrNoRows when the
+// product does not exist.
+func (r *ProductRepository) AddBarcode(ctx context.Context, b *models.Barcode) error {
+	b.Code = barcode.Normalize(b.Code)
+	if b.Symbology == "" {
+		b.Symbology = barcode.Detect(b.Code)
+	}
+	if barcode.IsGS1(b.Code) {
+		return fmt.Errorf("%w: store the GTIN, lot and expiry are read at scan time", barcode.ErrInvalid)
+	}
+	if err := barcode.Validate(b.Code, b.Symbology); err != nil {
+		return err
+	}
+	if b.PackQuantity == 0 {
+		b.PackQuantity = 1
+	}
+
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO product_barcodes (product_id, code, symbology, lookup_key, pack_quantity, created_at)
+         SELECT ?, ?, ?, ?, ?, ? WHERE EXISTS (SELECT 1 FROM products WHERE id = ?)`,
+		b.ProductID, b.Code, b.Symbology, barcode.LookupKey(b.Code, b.Symbology), b.PackQuantity, now, b.ProductID,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrBarcodeTaken
+		}
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	b.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	b.CreatedAt = now
+
+	return nil
+}
+
+// DeleteBarcode removes one of a product's barcodes. It returns
+// sql.ErrNoRows when the product has no such barcode.
+func (r *ProductRepository) DeleteBarcode(ctx context.Context, productID, barcodeID int64) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM product_barcodes WHERE id = ? AND product_id = ?`, barcodeID, productID)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *ProductRepository) GetBarcodes(ctx context.Context, productID int64) ([]models.Barcode, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, product_id, code, symbology, pack_quantity, created_at
+         FROM product_barcodes
+         WHERE product_id = ?
+         ORDER BY pack_quantity, id`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	barcodes := []models.Barcode{}
+	for rows.Next() {
+		var b models.Barcode
+		if err := rows.Scan(&b.ID, &b.ProductID, &b.Code, &b.Symbology, &b.PackQuantity, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		barcodes = append(barcodes, b)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return barcodes, nil
+}
+
+// BarcodeScan is what a scanned code stands for: the product, and either
+// the stored barcode that matched or the rule that read a scale label.
+type BarcodeScan struct {
+	Product      *models.Product     `json:"product"`
+	Barcode      *models.Barcode     `json:"barcode,omitempty"`
+	Rule         *models.BarcodeRule `json:"rule,omitempty"`
+	Code         string              `json:"code"`                  // as normalized from the scan
+	PackQuantity float64             `json:"pack_quantity"`         // units per scan
+	Weight       *float64            `json:"weight,omitempty"`      // kg, from a variable-weight label
+	Price        *float64            `json:"price,omitempty"`       // line price printed on the label
+	Lot          string              `json:"lot,omitempty"`         // GS1 AI 10
+	Serial       string              `json:"serial,omitempty"`      // GS1 AI 21
+	ExpiryDate   string              `json:"expiry_date,omitempty"` // GS1 AI 17, YYYY-MM-DD
+	Expired      bool                `json:"expired,omitempty"`
+}
+
+// expiredOn reports whether the scanned item is past its expiry date on
+// the day of now. It may still be sold on the expiry date itself.
+func (s *BarcodeScan) expiredOn(now time.Time) bool {
+	return s.ExpiryDate != "" && s.ExpiryDate < now.Format(dateLayout)
+}
+
+// GetByBarcode resolves a scanned code to its product, see resolveBarcode.
+func (r *ProductRepository) GetByBarcode(ctx context.Context, code string) (*BarcodeScan, error) {
+	scan, err := resolveBarcode(ctx, r.db, code)
+	if err != nil {
+		return nil, err
+	}
+	scan.Expired = scan.expiredOn(time.Now().UTC())
+	return scan, nil
+}
+
+// resolveBarcode matches a scanned code against the stored barcodes with a
+// single indexed lookup, then against the in-store rules for scale labels.
+// GS1 element strings are decoded and matched by their GTIN. It returns
+// sql.ErrNoRows when nothing matches.
+func resolveBarcode(ctx context.Context, q dbtx, code string) (*BarcodeScan, error) {
+	if barcode.IsGS1(code) {
+		return resolveGS1(ctx, q, code)
+	}
+
+	code = barcode.Normalize(code)
+	if code == "" {
+		return nil, sql.ErrNoRows
+	}
+	keys := barcode.LookupKeys(code)
+
+	row := q.QueryRowContext(ctx,
+		`SELECT p.id, p.name, p.sku, p.price, p.cost, p.stock, p.allow_negative_stock, p.plu, p.category_id, p.parent_id, p.own_price, p.unit, COALESCE((SELECT u.decimals FROM units u WHERE u.code = p.unit), 0) AS unit_decimals, p.archived_at, p.version, p.created_at, p.updated_at,
+                b.id, b.product_id, b.code, b.symbology, b.pack_quantity, b.created_at
+         FROM product_barcodes b
+         JOIN products p ON p.id = b.product_id
+         WHERE b.lookup_key IN (?, ?)
+         ORDER BY b.id
+         LIMIT 1`,
+		keys[0], keys[len(keys)-1],
+	)
+
+	var p models.Product
+	var b models.Barcode
+	err := scanProduct(row, &p, &b.ID, &b.ProductID, &b.Code, &b.Symbology, &b.PackQuantity, &b.CreatedAt)
+	if err == nil {
+		return &BarcodeScan{Product: &p, Barcode: &b, Code: code, PackQuantity: b.PackQuantity}, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	return resolveEmbeddedBarcode(ctx, q, code)
+}
+
+// resolveGS1 decodes a GS1 element string, finds the product by its GTIN
+// and carries over the lot, serial, expiry and any weight or price.
+func resolveGS1(ctx context.Context, q dbtx, raw string) (*BarcodeScan, error) {
+	g, err := barcode.ParseGS1(raw)
+	if err != nil {
+		return nil, err
+	}
+	if g.GTIN == "" {
+		return nil, fmt.Errorf("%w: GS1 code has no GTIN (AI 01)", barcode.ErrInvalid)
+	}
+
+	scan, err := resolveBarcode(ctx, q, g.GTIN)
+	if err != nil {
+		return nil, err
+	}
+
+	scan.Code = g.String()
+	scan.Lot = g.Lot
+	scan.Serial = g.Serial
+	if g.Expiry != nil {
+		scan.ExpiryDate = g.Expiry.Format(dateLayout)
+	}
+	if g.NetWeight != nil {
+		scan.Weight = g.NetWeight
+	}
+	if g.Price != nil {
+		scan.Price = g.Price
+	}
+	return scan, nil
+}
+
+// resolveEmbeddedBarcode reads code with the first rule whose prefix it
+// carries, longest prefix first, and finds the product by PLU.
+func resolveEmbeddedBarcode(ctx context.Context, q dbtx, code string) (*BarcodeScan, error) {
+	rules, err := getBarcodeRules(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rule := range rules {
+		plu, value, ok := barcodeLayout(rule).Parse(code)
+		if !ok {
+			continue
+		}
+
+		row := q.QueryRowContext(ctx,
+			`SELECT id, name, sku, price, cost, stock, allow_negative_stock, plu, category_id, parent_id, own_price, unit, COALESCE((SELECT u.decimals FROM units u WHERE u.code = products.unit), 0), archived_at, version, created_at, updated_at
+             FROM products WHERE plu = ?`,
+			plu,
+		)
+
+		var p models.Product
+		if err := scanProduct(row, &p); err != nil {
+			return nil, err
+		}
+
+		scan := &BarcodeScan{Product: &p, Rule: &rule, Code: code, PackQuantity: 1}
+		if rule.ValueKind == barcode.ValueWeight {
+			scan.Weight = &value
+		} else {
+			scan.Price = &value
+		}
+		return scan, nil
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+func barcodeLayout(rule models.BarcodeRule) barcode.EmbeddedLayout {
+	return barcode.EmbeddedLayout{
+		Prefix:        rule.Prefix,
+		PLULength:     rule.PLULength,
+		ValueKind:     rule.ValueKind,
+		ValueLength:   rule.ValueLength,
+		ValueDecimals: rule.ValueDecimals,
+	}
+}
+
+func getBarcodeRules(ctx context.Context, q dbtx) ([]models.BarcodeRule, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT id, prefix, plu_length, value_kind, value_length, value_decimals, created_at
+         FROM barcode_rules
+         ORDER BY length(prefix) DESC, prefix`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.BarcodeRule{}
+	for rows.Next() {
+		var rule models.BarcodeRule
+		if err := rows.Scan(&rule.ID, &rule.Prefix, &rule.PLULength, &rule.ValueKind,
+			&rule.ValueLength, &rule.ValueDecimals, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return rules, nil
+}
+
+func (r *ProductRepository) GetBarcodeRules(ctx context.Context) ([]models.BarcodeRule, error) {
+	return getBarcodeRules(ctx, r.db)
+}
+
+// CreateBarcodeRule validates and stores a scale label layout. Each prefix
+// has one layout.
+func (r *ProductRepository) CreateBarcodeRule(ctx context.Context, rule *models.BarcodeRule) error {
+	if err := barcodeLayout(*rule).Validate(); err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO barcode_rules (prefix, plu_length, value_kind, value_length, value_decimals, created_at)
+         VALUES (?, ?, ?, ?, ?, ?)`,
+		rule.Prefix, rule.PLULength, rule.ValueKind, rule.ValueLength, rule.ValueDecimals, now,
+	)
+	if err != nil {
+		if isUniqueViolation(err) {
+			return ErrBarcodeRuleExists
+		}
+		return err
+	}
+
+	rule.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	rule.CreatedAt = now
+
+	return nil
+}
+
+func (r *ProductRepository) DeleteBarcodeRule(ctx context.Context, id int64) error {
+	res, err := r.db.ExecContext(ctx, `DELETE FROM barcode_rules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,464 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"pos-backend/internal/barcode"
+	"pos-backend/internal/models"
+)
+
+// maxImportRows caps one import so a wrong file cannot hold the write lock
+// for long.
+const maxImportRows = 10000
+
+var ErrInvalidCSV = errors.New("invalid CSV")
+
+// productCSVColumns is the column order of an export. Imports take the
+// columns in any order and only sku is required; columns left out keep
+// their current value, or the default for new products.
+var productCSVColumns = []string{"sku", "name", "price", "cost", "stock", "unit", "category_id", "plu", "allow_negative_stock"}
+
+const (
+	ImportActionCreate    = "create"
+	ImportActionUpdate    = "update"
+	ImportActionUnchanged = "unchanged"
+)
+
+// ProductImportResult reports what an import did, or would do on a dry
+// run. Nothing is written unless every row is valid.
+type ProductImportResult struct {
+	DryRun    bool                     `json:"dry_run"`
+	Applied   bool                     `json:"applied"`
+	Created   int                      `json:"created"`
+	Updated   int                      `json:"updated"`
+	Unchanged int                      `json:"unchanged"`
+	Invalid   int                      `json:"invalid"`
+	Rows      []ProductImportRowResult `json:"rows"`
+}
+
+type ProductImportRowResult struct {
+	Line      int                  `json:"line"` // line in the file; the header is line 1
+	SKU       string               `json:"sku"`
+	Action    string               `json:"action,omitempty"` // empty when the row has errors
+	ProductID int64                `json:"product_id,omitempty"`
+	Changes   []ProductFieldChange `json:"changes,omitempty"`
+	Errors    []string             `json:"errors,omitempty"`
+}
+
+// ProductFieldChange is one column an import changes; From is nil for new
+// products.
+type ProductFieldChange struct {
+	Field string `json:"field"`
+	From  any    `json:"from"`
+	To    any    `json:"to"`
+}
+
+// ExportCSV writes the catalog, variants included, in productCSVColumns
+// order. The file can be edited and imported again.
+func (r *ProductRepository) ExportCSV(ctx context.Context, w io.Writer) error {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT sku, name, price, cost, stock, unit, category_id, plu, allow_negative_stock
+         FROM products
+         ORDER BY COALESCE(parent_id, id), id`,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(productCSVColumns); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var p models.Product
+		var categoryID *int64
+		var plu *string
+		if err := rows.Scan(&p.SKU, &p.Name, &p.Price, &p.Cost, &p.Stock, &p.Unit, &categoryID, &plu, &p.AllowNegativeStock); err != nil {
+			return err
+		}
+		p.CategoryID = categoryID
+		if plu != nil {
+			p.PLU = *plu
+		}
+
+		if err := cw.Write(productCSVRecord(&p)); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func productCSVRecord(p *models.Product) []string {
+	record := make([]string, len(productCSVColumns))
+	for i, col := range productCSVColumns {
+		record[i] = productCSVValue(p, col)
+	}
+	return record
+}
+
+// productCSVValue formats one column of p as it appears in a file.
+func productCSVValue(p *models.Product, col string) string {
+	switch col {
+	case "sku":
+		return p.SKU
+	case "name":
+		return p.Name
+	case "price":
+		return strconv.FormatFloat(p.Price, 'f', -1, 64)
+	case "cost":
+		if p.Cost == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*p.Cost, 'f', -1, 64)
+	case "stock":
+		return strconv.FormatFloat(p.Stock, 'f', -1, 64)
+	case "unit":
+		return p.Unit
+	case "category_id":
+		if p.CategoryID == nil {
+			return ""
+		}
+		return strconv.FormatInt(*p.CategoryID, 10)
+	case "plu":
+		return p.PLU
+	case "allow_negative_stock":
+		if p.AllowNegativeStock == nil {
+			return ""
+		}
+		return strconv.FormatBool(*p.AllowNegativeStock)
+	}
+	return ""
+}
+
+// ImportCSV creates or updates products by SKU from a CSV file with a
+// header row. Every row is validated and the whole file is applied in one
+// transaction, or not at all when any row has errors or dryRun is set. The
+// result lists each row with its changes or errors either way.
+//
+// A blank name, price, cost, stock or unit keeps the current value; a blank
+// category_id, plu or allow_negative_stock clears it.
+func (r *ProductRepository) ImportCSV(ctx context.Context, file io.Reader, dryRun bool) (*ProductImportResult, error) {
+	cr := csv.NewReader(file)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: the file is empty", ErrInvalidCSV)
+	}
+	if err != nil {
+		return nil, csvReadError(err)
+	}
+	columns, err := productCSVHeader(header)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	// committed only once every row has gone through
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	result := &ProductImportResult{DryRun: dryRun, Rows: []ProductImportRowResult{}}
+	seen := make(map[string]int)
+
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, csvReadError(err)
+		}
+		if len(result.Rows) == maxImportRows {
+			return nil, fmt.Errorf("%w: at most %d rows per import", ErrInvalidCSV, maxImportRows)
+		}
+
+		line, _ := cr.FieldPos(0)
+		row := ProductImportRowResult{Line: line}
+
+		cells := make(map[string]string, len(columns))
+		for i, col := range columns {
+			cells[col] = strings.TrimSpace(record[i])
+		}
+		row.SKU = cells["sku"]
+
+		switch {
+		case row.SKU == "":
+			row.Errors = append(row.Errors, "sku is required")
+		// SKUs match exactly, as the lookup by SKU and its unique index do
+		case seen[row.SKU] != 0:
+			row.Errors = append(row.Errors, fmt.Sprintf("sku is already on line %d", seen[row.SKU]))
+		default:
+			seen[row.SKU] = line
+			if err := r.importRow(ctx, tx, &row, cells, now); err != nil {
+				return nil, err
+			}
+		}
+
+		switch {
+		case len(row.Errors) > 0:
+			result.Invalid++
+		case row.Action == ImportActionCreate:
+			result.Created++
+		case row.Action == ImportActionUpdate:
+			result.Updated++
+		default:
+			result.Unchanged++
+		}
+		result.Rows = append(result.Rows, row)
+	}
+
+	if dryRun || result.Invalid > 0 {
+		// products that would be created have no id yet
+		for i := range result.Rows {
+			if result.Rows[i].Action == ImportActionCreate {
+				result.Rows[i].ProductID = 0
+			}
+		}
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	result.Applied = true
+	return result, nil
+}
+
+// csvReadError reports malformed CSV as ErrInvalidCSV; failures to read
+// the file itself are passed on.
+func csvReadError(err error) error {
+	var parseErr *csv.ParseError
+	if errors.As(err, &parseErr) {
+		return fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+	}
+	return err
+}
+
+// productCSVHeader checks the header row and returns the column names.
+func productCSVHeader(header []string) ([]string, error) {
+	known := make(map[string]bool, len(productCSVColumns))
+	for _, col := range productCSVColumns {
+		known[col] = true
+	}
+
+	columns := make([]string, len(header))
+	seen := make(map[string]bool)
+	for i, h := range header {
+		// spreadsheet programs like to start UTF-8 files with a BOM
+		col := strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		if !known[col] {
+			return nil, fmt.Errorf("%w: unknown column %q; columns are %s", ErrInvalidCSV, h, strings.Join(productCSVColumns, ", "))
+		}
+		if seen[col] {
+			return nil, fmt.Errorf("%w: column %q appears twice", ErrInvalidCSV, col)
+		}
+		seen[col] = true
+		columns[i] = col
+	}
+	if !seen["sku"] {
+		return nil, fmt.Errorf("%w: the sku column is required", ErrInvalidCSV)
+	}
+	return columns, nil
+}
+
+// importRow applies one row on tx, recording what changed or what is wrong
+// with it. Only unexpected failures are returned.
+func (r *ProductRepository) importRow(ctx context.Context, tx dbtx, row *ProductImportRowResult, cells map[string]string, now time.Time) error {
+	var current *models.Product
+	existing := &models.Product{}
+	err := scanProduct(tx.QueryRowContext(ctx,
+		`SELECT id, name, sku, price, cost, stock, allow_negative_stock, plu, category_id, parent_id, own_price, unit, COALESCE((SELECT u.decimals FROM units u WHERE u.code = products.unit), 0), archived_at, version, created_at, updated_at
+         FROM products WHERE sku = ?`,
+		row.SKU,
+	), existing)
+	switch {
+	case err == nil:
+		current = existing
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	p := models.Product{SKU: row.SKU, Unit: UnitPieces}
+	if current != nil {
+		p = *current
+	}
+
+	for _, col := range productCSVColumns {
+		v, ok := cells[col]
+		if !ok {
+			continue
+		}
+		if msg := setProductCSVValue(&p, col, v, current == nil); msg != "" {
+			row.Errors = append(row.Errors, col+": "+msg)
+		}
+	}
+	if current == nil {
+		if _, ok := cells["name"]; !ok || p.Name == "" {
+			row.Errors = append(row.Errors, "name is required for a new product")
+		}
+		if _, ok := cells["price"]; !ok {
+			row.Errors = append(row.Errors, "price is required for a new product")
+		}
+	}
+	if len(row.Errors) > 0 {
+		return nil
+	}
+
+	if p.PLU != "" {
+		p.PLU = barcode.NormalizePLU(p.PLU)
+	}
+	if err := r.checkUnit(ctx, tx, &p); err != nil {
+		return importRowError(row, err)
+	}
+
+	for _, col := range productCSVColumns {
+		var from any
+		if current != nil {
+			from = productCSVValue(current, col)
+		}
+		to := productCSVValue(&p, col)
+		if from == nil || from != to {
+			if current == nil && to == "" {
+				continue
+			}
+			row.Changes = append(row.Changes, ProductFieldChange{Field: col, From: from, To: to})
+		}
+	}
+
+	switch {
+	case current == nil:
+		row.Action = ImportActionCreate
+		err = insertProduct(ctx, tx, &p, now)
+	case len(row.Changes) > 0:
+		row.Action = ImportActionUpdate
+		err = updateProduct(ctx, tx, &p, now)
+	default:
+		row.Action = ImportActionUnchanged
+	}
+	if err != nil {
+		row.Action = ""
+		row.Changes = nil
+		return importRowError(row, err)
+	}
+
+	row.ProductID = p.ID
+	return nil
+}
+
+// importRowError records the validation errors a write can run into on the
+// row and passes anything else on.
+func importRowError(row *ProductImportRowResult, err error) error {
+	switch {
+	case errors.Is(err, ErrUnitNotFound):
+		row.Errors = append(row.Errors, "unit: no such unit")
+	case errors.Is(err, ErrInvalidQuantity):
+		row.Errors = append(row.Errors, "stock: "+err.Error())
+	case errors.Is(err, ErrCategoryNotFound):
+		row.Errors = append(row.Errors, "category_id: no such category")
+	case errors.Is(err, ErrPLUTaken):
+		row.Errors = append(row.Errors, "plu: already used by another product")
+	default:
+		return err
+	}
+	return nil
+}
+
+// setProductCSVValue parses one cell into p and returns what is wrong with
+// it, if anything.
+func setProductCSVValue(p *models.Product, col, v string, isNew bool) string {
+	switch col {
+	case "name":
+		if v != "" {
+			p.Name = v
+		}
+	case "price":
+		if v == "" {
+			if isNew {
+				return "required for a new product"
+			}
+			return ""
+		}
+		price, ok := parseCSVNumber(v)
+		if !ok || price < 0 {
+			return "must be a number of at least 0"
+		}
+		p.Price = price
+	case "cost":
+		if v == "" {
+			return ""
+		}
+		cost, ok := parseCSVNumber(v)
+		if !ok || cost < 0 {
+			return "must be a number of at least 0"
+		}
+		p.Cost = &cost
+	case "stock":
+		if v == "" {
+			return ""
+		}
+		stock, ok := parseCSVNumber(v)
+		if !ok {
+			return "must be a number"
+		}
+		p.Stock = stock
+	case "unit":
+		if v != "" {
+			p.Unit = strings.ToLower(v)
+		}
+	case "category_id":
+		if v == "" {
+			p.CategoryID = nil
+			return ""
+		}
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id <= 0 {
+			return "must be a category id"
+		}
+		p.CategoryID = &id
+	case "plu":
+		if v != "" && strings.Trim(v, "0123456789") != "" {
+			return "must be digits"
+		}
+		p.PLU = v
+	case "allow_negative_stock":
+		if v == "" {
+			p.AllowNegativeStock = nil
+			return ""
+		}
+		allow, err := strconv.ParseBool(v)
+		if err != nil {
+			return "must be true, false or blank"
+		}
+		p.AllowNegativeStock = &allow
+	}
+	return ""
+}
+
+// parseCSVNumber reads a plain decimal number; NaN and infinities are not
+// numbers a catalog can hold.
+func parseCSVNumber(v string) (float64, bool) {
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, false
+	}
+	return f, true
+}
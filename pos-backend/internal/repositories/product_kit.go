@@ -0,0 +1,333 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"pos-backend/internal/models"
+)
+
+var (
+	ErrInvalidKit           = errors.New("invalid kit")
+	ErrKitNesting           = errors.New("kits cannot contain kits or be part of one")
+	ErrKitComponentNotFound = errors.New("kit component not found")
+)
+
+// kitStock is the stock shown for a product aliased p: for a kit, how many
+// complete kits its components make up once the stock other tills hold is
+// set aside, as priceSale counts it; otherwise the product's own stock.
+// Reservation expiry is compared in SQL since the constant takes no
+// arguments; stored times start with the same YYYY-MM-DD HH:MM:SS.
+const kitStock = `COALESCE((SELECT MIN(MAX(CAST((c.stock - COALESCE((SELECT SUM(r.quantity) FROM stock_reservations r
+                                                                 WHERE r.product_id = c.id
+                                                                   AND (r.expires_at IS NULL OR r.expires_at > DATETIME('now'))), 0))
+                                         / kc.quantity AS INTEGER), 0))
+                            FROM kit_components kc
+                            JOIN products c ON c.id = kc.component_id
+                            WHERE kc.kit_id = p.id), p.stock)`
+
+// kitPart is a component of a kit as the sale flow needs it.
+type kitPart struct {
+	ProductID     int64
+	Name          string
+	Quantity      float64 // per kit
+	Price         float64
+	Cost          *float64 // nil when unknown
+	Stock         float64
+	AllowNegative bool
+}
+
+// kitParts returns the components of productID, or nothing when it is not
+// a kit. allowNegative is the store-wide default for components without
+// their own setting.
+func kitParts(ctx context.Context, q dbtx, productID int64, allowNegative bool) ([]kitPart, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT c.id, c.name, kc.quantity, c.price, c.cost, c.stock, COALESCE(c.allow_negative_stock, ?)
+         FROM kit_components kc
+         JOIN products c ON c.id = kc.component_id
+         WHERE kc.kit_id = ?
+         ORDER BY c.id`,
+		allowNegative, productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var parts []kitPart
+	for rows.Next() {
+		var p kitPart
+		if err := rows.Scan(&p.ProductID, &p.Name, &p.Quantity, &p.Price, &p.Cost, &p.Stock, &p.AllowNegative); err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+
+	return parts, rows.Err()
+}
+
+// allocateRevenue splits total across weights in proportion, in cents, the
+// last share taking the rounding remainder so the parts add up exactly.
+// Without any weight the total is split evenly.
+func allocateRevenue(total float64, weights []float64) []float64 {
+	shares := make([]float64, len(weights))
+	if len(weights) == 0 {
+		return shares
+	}
+
+	var sum float64
+	for _, w := range weights {
+		sum += w
+	}
+
+	allocated := 0.0
+	for i, w := range weights {
+		if i == len(weights)-1 {
+			shares[i] = roundMoney(total - allocated)
+			break
+		}
+		share := 1 / float64(len(weights))
+		if sum != 0 {
+			share = w / sum
+		}
+		shares[i] = roundMoney(total * share)
+		allocated += shares[i]
+	}
+	return shares
+}
+
+// kitLineComponents works out what a kit line takes from each component
+// and allocates its total by what the components sell for on their own.
+func kitLineComponents(parts []kitPart, quantity, lineTotal float64) []models.SaleItemComponent {
+	weights := make([]float64, len(parts))
+	for i, p := range parts {
+		weights[i] = p.Price * p.Quantity
+	}
+	revenue := allocateRevenue(lineTotal, weights)
+
+	components := make([]models.SaleItemComponent, len(parts))
+	for i, p := range parts {
+		components[i] = models.SaleItemComponent{
+			ProductID:   p.ProductID,
+			ProductName: p.Name,
+			Quantity:    roundQuantity(quantity * p.Quantity),
+			Revenue:     revenue[i],
+			UnitCost:    p.Cost,
+		}
+	}
+	return components
+}
+
+// kitCost is what the components of one kit cost the store, nil when the
+// cost of any of them is unknown.
+func kitCost(parts []kitPart) *float64 {
+	var cost float64
+	for _, p := range parts {
+		if p.Cost == nil {
+			return nil
+		}
+		cost += *p.Cost * p.Quantity
+	}
+	return &cost
+}
+
+// recordKitLine stores what a sold or returned kit line moved for each
+// component and adjusts the components' stock; the kit itself has none.
+func recordKitLine(ctx context.Context, q dbtx, saleItemID int64, components []models.SaleItemComponent, allowNegative bool, now time.Time) error {
+	for _, c := range components {
+		_, err := q.ExecContext(ctx,
+			`INSERT INTO sale_item_components (sale_item_id, component_id, quantity, revenue, unit_cost) VALUES (?, ?, ?, ?, ?)`,
+			saleItemID, c.ProductID, c.Quantity, c.Revenue, c.UnitCost,
+		)
+		if err != nil {
+			return err
+		}
+		if err := deductStock(ctx, q, c.ProductID, c.Quantity, allowNegative, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saleItemComponents returns the components recorded for kit lines of a
+// sale, by sale item id.
+func saleItemComponents(ctx context.Context, q dbtx, saleID int64) (map[int64][]models.SaleItemComponent, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT sic.sale_item_id, sic.component_id, p.name, sic.quantity, sic.revenue, sic.unit_cost
+         FROM sale_item_components sic
+         JOIN sale_items si ON si.id = sic.sale_item_id
+         JOIN products p ON p.id = sic.component_id
+         WHERE si.sale_id = ?
+         ORDER BY sic.id`,
+		saleID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	components := make(map[int64][]models.SaleItemComponent)
+	for rows.Next() {
+		var itemID int64
+		var c models.SaleItemComponent
+		if err := rows.Scan(&itemID, &c.ProductID, &c.ProductName, &c.Quantity, &c.Revenue, &c.UnitCost); err != nil {
+			return nil, err
+		}
+		components[itemID] = append(components[itemID], c)
+	}
+
+	return components, rows.Err()
+}
+
+// GetComponents returns the components of a kit; empty when the product is
+// not a kit.
+func (r *ProductRepository) GetComponents(ctx context.Context, kitID int64) ([]models.KitComponent, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT kc.component_id, p.name, kc.quantity
+         FROM kit_components kc
+         JOIN products p ON p.id = kc.component_id
+         WHERE kc.kit_id = ?
+         ORDER BY kc.component_id`,
+		kitID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var components []models.KitComponent
+	for rows.Next() {
+		var c models.KitComponent
+		if err := rows.Scan(&c.ProductID, &c.ProductName, &c.Quantity); err != nil {
+			return nil, err
+		}
+		components = append(components, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return components, nil
+}
+
+// SetComponents replaces the components of a kit. An empty list turns the
+// kit back into an ordinary product. Kits are one level deep: a kit cannot
+// contain another kit, a product with variants, or be a component itself.
+func (r *ProductRepository) SetComponents(ctx context.Context, kitID int64, components []models.KitComponent) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var isComponent, hasVariants bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM kit_components WHERE component_id = p.id),
+                EXISTS (SELECT 1 FROM products v WHERE v.parent_id = p.id)
+         FROM products p WHERE p.id = ?`,
+		kitID,
+	).Scan(&isComponent, &hasVariants)
+	if err != nil {
+		return err
+	}
+	if len(components) > 0 {
+		if isComponent {
+			return ErrKitNesting
+		}
+		if hasVariants {
+			return fmt.Errorf("%w: a product with variants cannot be a kit", ErrInvalidKit)
+		}
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM kit_components WHERE kit_id = ?`, kitID); err != nil {
+		return err
+	}
+
+	seen := make(map[int64]bool)
+	for _, c := range components {
+		if c.ProductID == kitID || seen[c.ProductID] {
+			return fmt.Errorf("%w: a component may appear once and cannot be the kit itself", ErrInvalidKit)
+		}
+		seen[c.ProductID] = true
+
+		var isKit, hasVariants bool
+		var decimals int
+		err = tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM kit_components WHERE kit_id = p.id),
+                    EXISTS (SELECT 1 FROM products v WHERE v.parent_id = p.id),
+                    COALESCE((SELECT u.decimals FROM units u WHERE u.code = p.unit), 0)
+             FROM products p WHERE p.id = ?`,
+			c.ProductID,
+		).Scan(&isKit, &hasVariants, &decimals)
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrKitComponentNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if isKit {
+			return ErrKitNesting
+		}
+		if hasVariants {
+			return fmt.Errorf("%w: product %d has variants; add a variant instead", ErrInvalidKit, c.ProductID)
+		}
+		if c.Quantity <= 0 || !fitsPrecision(c.Quantity, decimals) {
+			return fmt.Errorf("%w: quantity of product %d must be above zero with at most %d decimals", ErrInvalidKit, c.ProductID, decimals)
+		}
+
+		if _, err = tx.ExecContext(ctx,
+			`INSERT INTO kit_components (kit_id, component_id, quantity) VALUES (?, ?, ?)`,
+			kitID, c.ProductID, c.Quantity,
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// returnedComponents scales the components recorded on a sold kit line to
+// the share of it being returned. Quantities and revenue come out negative,
+// the revenue adding up to lineTotal.
+func returnedComponents(ctx context.Context, q dbtx, saleItemID int64, share, lineTotal float64) ([]models.SaleItemComponent, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT sic.component_id, p.name, sic.quantity, sic.revenue, sic.unit_cost
+         FROM sale_item_components sic
+         JOIN products p ON p.id = sic.component_id
+         WHERE sic.sale_item_id = ?
+         ORDER BY sic.id`,
+		saleItemID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var components []models.SaleItemComponent
+	var weights []float64
+	for rows.Next() {
+		var c models.SaleItemComponent
+		if err := rows.Scan(&c.ProductID, &c.ProductName, &c.Quantity, &c.Revenue, &c.UnitCost); err != nil {
+			return nil, err
+		}
+		c.Quantity = -roundQuantity(c.Quantity * share)
+		weights = append(weights, c.Revenue)
+		components = append(components, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, revenue := range allocateRevenue(lineTotal, weights) {
+		components[i].Revenue = revenue
+	}
+	return components, nil
+}
@@ -0,0 +1,293 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"pos-backend/internal/models"
+)
+
+const (
+	PriceChangeScheduled = "scheduled"
+	PriceChangeApplied   = "applied"
+	PriceChangeCancelled = "cancelled"
+)
+
+var (
+	ErrInvalidPriceChange      = errors.New("invalid price change")
+	ErrPriceChangeNotScheduled = errors.New("price change is no longer scheduled")
+)
+
+// SchedulePriceChanges sets prices in advance. The changes are saved
+// together or not at all; each must be for an existing product and take
+// effect in the future.
+func (r *ProductRepository) SchedulePriceChanges(ctx context.Context, changes []models.PriceChange) (_ []models.PriceChange, err error) {
+	if len(changes) == 0 {
+		return nil, fmt.Errorf("%w: no price changes given", ErrInvalidPriceChange)
+	}
+	now := time.Now().UTC()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	scheduled := make([]models.PriceChange, len(changes))
+	for i, c := range changes {
+		if c.Price < 0 || math.IsNaN(c.Price) || math.IsInf(c.Price, 0) {
+			return nil, fmt.Errorf("%w: change %d: price cannot be negative", ErrInvalidPriceChange, i+1)
+		}
+		if !c.EffectiveAt.After(now) {
+			return nil, fmt.Errorf("%w: change %d: effective_at must be in the future", ErrInvalidPriceChange, i+1)
+		}
+		c.EffectiveAt = c.EffectiveAt.UTC()
+
+		err = tx.QueryRowContext(ctx, `SELECT name FROM products WHERE id = ?`, c.ProductID).Scan(&c.ProductName)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %d", ErrProductNotFound, c.ProductID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var taken bool
+		err = tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM price_changes WHERE product_id = ? AND effective_at = ? AND status = ?)`,
+			c.ProductID, c.EffectiveAt, PriceChangeScheduled,
+		).Scan(&taken)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			return nil, fmt.Errorf("%w: change %d: product %d already has a price change at that time", ErrInvalidPriceChange, i+1, c.ProductID)
+		}
+
+		err = tx.QueryRowContext(ctx,
+			`INSERT INTO price_changes (product_id, price, effective_at, status, created_at) VALUES (?, ?, ?, ?, ?) RETURNING id`,
+			c.ProductID, roundMoney(c.Price), c.EffectiveAt, PriceChangeScheduled, now,
+		).Scan(&c.ID)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Price = roundMoney(c.Price)
+		c.Status = PriceChangeScheduled
+		c.CreatedAt = now
+		c.AppliedAt = nil
+		scheduled[i] = c
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return scheduled, nil
+}
+
+// GetPriceChanges lists price changes with the given status, soonest
+// first, for one product when productID is set.
+func (r *ProductRepository) GetPriceChanges(ctx context.Context, status string, productID int64) ([]models.PriceChange, error) {
+	return getPriceChanges(ctx, r.db, status, productID)
+}
+
+func getPriceChanges(ctx context.Context, q dbtx, status string, productID int64) ([]models.PriceChange, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT c.id, c.product_id, p.name, c.price, c.effective_at, c.status, c.created_at, c.applied_at
+         FROM price_changes c
+         JOIN products p ON p.id = c.product_id
+         WHERE c.status = ? AND (? = 0 OR c.product_id = ?)
+         ORDER BY c.effective_at, c.id`,
+		status, productID, productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []models.PriceChange{}
+	for rows.Next() {
+		var c models.PriceChange
+		if err := scanPriceChange(rows, &c); err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+	return changes, rows.Err()
+}
+
+func scanPriceChange(row rowScanner, c *models.PriceChange) error {
+	var appliedAt sql.NullTime
+	if err := row.Scan(&c.ID, &c.ProductID, &c.ProductName, &c.Price, &c.EffectiveAt, &c.Status, &c.CreatedAt, &appliedAt); err != nil {
+		return err
+	}
+	if appliedAt.Valid {
+		c.AppliedAt = &appliedAt.Time
+	}
+	return nil
+}
+
+// CancelPriceChange withdraws a change that has not been applied yet.
+func (r *ProductRepository) CancelPriceChange(ctx context.Context, id int64) (*models.PriceChange, error) {
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE price_changes SET status = ? WHERE id = ? AND status = ?`,
+		PriceChangeCancelled, id, PriceChangeScheduled,
+	)
+	if err != nil {
+		return nil, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+
+	var c models.PriceChange
+	err = scanPriceChange(r.db.QueryRowContext(ctx,
+		`SELECT c.id, c.product_id, p.name, c.price, c.effective_at, c.status, c.created_at, c.applied_at
+         FROM price_changes c
+         JOIN products p ON p.id = c.product_id
+         WHERE c.id = ?`,
+		id,
+	), &c)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("%w: it is %s", ErrPriceChangeNotScheduled, c.Status)
+	}
+	return &c, nil
+}
+
+// PriceHistory returns the prices product id has had, whichever way they
+// were set, and the changes still scheduled for it.
+func (r *ProductRepository) PriceHistory(ctx context.Context, id int64) (*models.PriceHistory, error) {
+	h := models.PriceHistory{ProductID: id, History: []models.ProductPrice{}}
+	if err := r.db.QueryRowContext(ctx, `SELECT price FROM products WHERE id = ?`, id).Scan(&h.Price); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT price, effective_at FROM product_prices WHERE product_id = ? ORDER BY effective_at DESC, id DESC`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p models.ProductPrice
+		if err := rows.Scan(&p.Price, &p.EffectiveAt); err != nil {
+			return nil, err
+		}
+		h.History = append(h.History, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if h.Scheduled, err = getPriceChanges(ctx, r.db, PriceChangeScheduled, id); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// ApplyDuePriceChanges applies the scheduled changes that have taken
+// effect by now, oldest first, and reports how many it applied. A price
+// set on a parent carries over to the variants that follow its price.
+func (r *ProductRepository) ApplyDuePriceChanges(ctx context.Context, now time.Time) (_ int, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, product_id, price, effective_at FROM price_changes WHERE status = ? AND effective_at <= ? ORDER BY effective_at, id`,
+		PriceChangeScheduled, now,
+	)
+	if err != nil {
+		return 0, err
+	}
+	var due []models.PriceChange
+	for rows.Next() {
+		var c models.PriceChange
+		if err = rows.Scan(&c.ID, &c.ProductID, &c.Price, &c.EffectiveAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(due) == 0 {
+		return 0, tx.Rollback()
+	}
+
+	for _, c := range due {
+		var lastID int64
+		if err = tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM product_prices`).Scan(&lastID); err != nil {
+			return 0, err
+		}
+		if err = applyPrice(ctx, tx, c.ProductID, c.Price, now); err != nil {
+			return 0, err
+		}
+		// the trigger dates the history rows by updated_at; they record
+		// when the price took effect, not when this tick came round to it
+		_, err = tx.ExecContext(ctx,
+			`UPDATE product_prices SET effective_at = ? WHERE id > ?`,
+			c.EffectiveAt, lastID,
+		)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.ExecContext(ctx,
+			`UPDATE price_changes SET status = ?, applied_at = ? WHERE id = ?`,
+			PriceChangeApplied, now, c.ID,
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(due), nil
+}
+
+// applyPrice sets the price of product id the way updateProduct does: a
+// variant keeps its own price when it differs from its parent's, and the
+// variants following a parent take its new price.
+func applyPrice(ctx context.Context, q dbtx, id int64, price float64, now time.Time) error {
+	_, err := q.ExecContext(ctx,
+		`UPDATE products SET price = ?,
+                own_price = COALESCE((SELECT pp.price <> ? FROM products pp WHERE pp.id = products.parent_id), 0),
+                version = version + 1, updated_at = ?
+         WHERE id = ? AND price <> ?`,
+		price, price, now, id, price,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx,
+		`UPDATE products SET price = ?, version = version + 1, updated_at = ?
+         WHERE parent_id = ? AND NOT own_price AND price <> ?`,
+		price, now, id, price,
+	)
+	return err
+}
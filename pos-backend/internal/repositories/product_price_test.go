@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pos-backend/internal/database"
+	"pos-backend/internal/models"
+)
+
+func TestApplyDuePriceChanges(t *testing.T) {
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "pos.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	res, err := db.Exec(`INSERT INTO products (name, sku, price, stock) VALUES ('Tea', 'TEA', 10, 5)`)
+	if err != nil {
+		t.Fatalf("insert product: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	res, err = db.Exec(`INSERT INTO products (name, sku, price, stock, parent_id) VALUES ('Tea 500g', 'TEA-500', 10, 5, ?)`, id)
+	if err != nil {
+		t.Fatalf("insert variant: %v", err)
+	}
+	variantID, _ := res.LastInsertId()
+
+	ctx := context.Background()
+	repo := NewProductRepository(db)
+
+	effective := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	if _, err := repo.SchedulePriceChanges(ctx, []models.PriceChange{{ProductID: id, Price: 12, EffectiveAt: effective}}); err != nil {
+		t.Fatalf("schedule: %v", err)
+	}
+
+	if n, err := repo.ApplyDuePriceChanges(ctx, effective.Add(-time.Minute)); err != nil || n != 0 {
+		t.Fatalf("apply before it is due = %d, %v; want 0, nil", n, err)
+	}
+
+	// the scheduler comes round well after the change took effect
+	tick := effective.Add(90 * time.Minute)
+	if n, err := repo.ApplyDuePriceChanges(ctx, tick); err != nil || n != 1 {
+		t.Fatalf("apply = %d, %v; want 1, nil", n, err)
+	}
+
+	var updatedAt time.Time
+	if err := db.QueryRow(`SELECT updated_at FROM products WHERE id = ?`, id).Scan(&updatedAt); err != nil {
+		t.Fatalf("read updated_at: %v", err)
+	}
+	if !updatedAt.Equal(tick) {
+		t.Errorf("updated_at = %v, want the tick %v", updatedAt, tick)
+	}
+
+	h, err := repo.PriceHistory(ctx, id)
+	if err != nil {
+		t.Fatalf("price history: %v", err)
+	}
+	if h.Price != 12 || len(h.Scheduled) != 0 {
+		t.Errorf("price = %v with %d scheduled; want 12 with none", h.Price, len(h.Scheduled))
+	}
+	if len(h.History) != 2 {
+		t.Fatalf("history has %d prices, want 2", len(h.History))
+	}
+	if got := h.History[0]; got.Price != 12 || !got.EffectiveAt.Equal(effective) {
+		t.Errorf("latest price = %v from %v, want 12 from %v", got.Price, got.EffectiveAt, effective)
+	}
+
+	vh, err := repo.PriceHistory(ctx, variantID)
+	if err != nil {
+		t.Fatalf("variant price history: %v", err)
+	}
+	if len(vh.History) != 2 {
+		t.Fatalf("variant history has %d prices, want 2", len(vh.History))
+	}
+	if got := vh.History[0]; got.Price != 12 || !got.EffectiveAt.Equal(effective) {
+		t.Errorf("variant latest price = %v from %v, want 12 from %v", got.Price, got.EffectiveAt, effective)
+	}
+}
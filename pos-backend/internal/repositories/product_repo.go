@@ -4,11 +4,20 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
+	"pos-backend/internal/barcode"
 	"pos-backend/internal/models"
 )
 
+var (
+	ErrProductInUse    = errors.New("product has sales or other records referring to it")
+	ErrParentArchived  = errors.New("the parent product is archived")
+	ErrVersionConflict = errors.New("product was changed since it was read")
+)
+
 type ProductRepository struct {
 	db *sql.DB
 }
@@ -17,68 +26,330 @@ func NewProductRepository(db *sql.DB) *ProductRepository {
 	return &ProductRepository{db: db}
 }
 
-func (r *ProductRepository) GetAll(ctx context.Context) ([]models.Product, error) {
-	query := `SELECT id, name, sku, price, stock, created_at, updated_at FROM products ORDER BY id DESC`
-	rows, err := r.db.QueryContext(ctx, query)
+// scanProduct reads the product columns in table order, followed by any
+// extra columns the query selected.
+func scanProduct(row rowScanner, p *models.Product, extra ...any) error {
+	var allowNegative sql.NullBool
+	var plu sql.NullString
+	var categoryID, parentID sql.NullInt64
+	var archivedAt sql.NullTime
+	dest := []any{
+		&p.ID,
+		&p.Name,
+		&p.SKU,
+		&p.Price,
+		&p.Cost,
+		&p.Stock,
+		&allowNegative,
+		&plu,
+		&categoryID,
+		&parentID,
+		&p.OwnPrice,
+		&p.Unit,
+		&p.QuantityDecimals,
+		&archivedAt,
+		&p.Version,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return err
+	}
+	if allowNegative.Valid {
+		p.AllowNegativeStock = &allowNegative.Bool
+	}
+	p.PLU = plu.String
+	if categoryID.Valid {
+		p.CategoryID = &categoryID.Int64
+	}
+	if parentID.Valid {
+		p.ParentID = &parentID.Int64
+	}
+	if archivedAt.Valid {
+		p.ArchivedAt = &archivedAt.Time
+	}
+	return nil
+}
+
+const (
+	ProductSortRelevance = "relevance"
+	ProductSortName      = "name"
+	ProductSortPrice     = "price"
+	ProductSortStock     = "stock"
+	ProductSortCreatedAt = "created_at"
+)
+
+// Product levels for listings and reports: parents leaves out variants,
+// variants leaves out products that have variants, i.e. only what can be
+// sold.
+const (
+	ProductLevelParent  = "parent"
+	ProductLevelVariant = "variant"
+)
+
+// Product statuses for listings: archived products are left out unless
+// asked for.
+const (
+	ProductStatusActive   = "active"
+	ProductStatusArchived = "archived"
+	ProductStatusAll      = "all"
+)
+
+// ProductFilter narrows and orders the catalog listing. Query is matched
+// against name and SKU; zero values mean "no filter".
+type ProductFilter struct {
+	Query      string
+	CategoryID int64 // includes every subcategory
+	MinPrice   *float64
+	MaxPrice   *float64
+	InStock    bool
+	Level      string // ProductLevelParent or ProductLevelVariant; "" lists everything
+	Status     string // ProductStatusArchived or ProductStatusAll; "" lists active products
+
+	Sort   string // defaults to relevance with a query, newest first without
+	Desc   bool
+	Limit  int    // 0 = default page size
+	Cursor string // next_cursor from the previous page
+
+	SkipCount bool // leave TotalCount 0, for callers reading every page
+}
+
+type ProductPage struct {
+	Items      []models.Product `json:"items"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+	TotalCount int64            `json:"total_count"`
+}
+
+// productSortColumns maps sort names to columns of the search subquery.
+// Created-at ordering uses the id alone.
+var productSortColumns = map[string]string{
+	ProductSortRelevance: "rank",
+	ProductSortName:      "name COLLATE NOCASE",
+	ProductSortPrice:     "price",
+	ProductSortStock:     "stock",
+	ProductSortCreatedAt: "",
+}
+
+// GetAll returns one page of the catalog. A query first matches whole
+// words and prefixes; if nothing matches it retries allowing typos.
+func (r *ProductRepository) GetAll(ctx context.Context, filter ProductFilter) (*ProductPage, error) {
+	terms := searchTerms(filter.Query)
+	if filter.Sort == "" {
+		filter.Sort, filter.Desc = ProductSortCreatedAt, true
+		if len(terms) > 0 {
+			filter.Sort, filter.Desc = ProductSortRelevance, false
+		}
+	}
+	sortCol, ok := productSortColumns[filter.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown product sort %q", filter.Sort)
+	}
+	filter.Limit = pageLimit(filter.Limit)
+
+	var cursor *listCursor
+	if filter.Cursor != "" {
+		c, err := decodeListCursor(filter.Cursor, filter.Sort, filter.Desc)
+		if err != nil {
+			return nil, err
+		}
+		cursor = &c
+	}
+
+	search := noProductSearch
+	if len(terms) > 0 {
+		search = ftsProductSearch(terms)
+	}
+
+	page := &ProductPage{Items: []models.Product{}}
+
+	// without the count, a search still has to know whether it matched
+	inner, args := filter.searchQuery(search)
+	matched := false
+	if !filter.SkipCount {
+		if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+inner+`)`, args...).Scan(&page.TotalCount); err != nil {
+			return nil, err
+		}
+		matched = page.TotalCount > 0
+	} else if len(terms) > 0 {
+		if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (`+inner+`)`, args...).Scan(&matched); err != nil {
+			return nil, err
+		}
+	}
+
+	if !matched && len(terms) > 0 {
+		fuzzy, found, err := r.fuzzyProductSearch(ctx, terms)
+		if err != nil || !found {
+			return page, err
+		}
+		search = fuzzy
+		inner, args = filter.searchQuery(search)
+		if !filter.SkipCount {
+			if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM (`+inner+`)`, args...).Scan(&page.TotalCount); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	cond, cursorArgs, order := keyset(sortCol, "id", filter.Desc, cursor)
+	query := `SELECT id, name, sku, price, cost, stock, allow_negative_stock, plu, category_id, parent_id, own_price, unit, unit_decimals, archived_at, version, created_at, updated_at, rank FROM (` + inner + `)`
+	if cond != "" {
+		query += ` WHERE ` + cond
+		args = append(args, cursorArgs...)
+	}
+	query += order + ` LIMIT ?`
+	args = append(args, filter.Limit+1)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var products []models.Product
+	var ranks []float64
 	for rows.Next() {
 		var p models.Product
-		if err := rows.Scan(
-			&p.ID,
-			&p.Name,
-			&p.SKU,
-			&p.Price,
-			&p.Stock,
-			&p.CreatedAt,
-			&p.UpdatedAt,
-		); err != nil {
+		var rank float64
+		if err := scanProduct(rows, &p, &rank); err != nil {
 			return nil, err
 		}
-		products = append(products, p)
+		page.Items = append(page.Items, p)
+		ranks = append(ranks, rank)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return products, nil
+	if len(page.Items) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		last := page.Items[len(page.Items)-1]
+
+		c := listCursor{Sort: filter.Sort, Desc: filter.Desc, ID: last.ID}
+		switch filter.Sort {
+		case ProductSortRelevance:
+			c.Key = ranks[filter.Limit-1]
+		case ProductSortName:
+			c.Key = last.Name
+		case ProductSortPrice:
+			c.Key = last.Price
+		case ProductSortStock:
+			c.Key = last.Stock
+		}
+		page.NextCursor = c.encode()
+	}
+
+	return page, nil
+}
+
+// searchQuery builds the filtered product subquery, with the search rank
+// as an extra column for relevance ordering.
+func (f ProductFilter) searchQuery(search productSearch) (string, []any) {
+	var conds []string
+	args := append([]any{}, search.rankArgs...)
+
+	if search.cond != "" {
+		conds = append(conds, search.cond)
+		args = append(args, search.args...)
+	}
+	if f.CategoryID > 0 {
+		conds = append(conds, `p.category_id IN (`+categorySubtree+`)`)
+		args = append(args, f.CategoryID)
+	}
+	if f.MinPrice != nil {
+		conds = append(conds, `p.price >= ?`)
+		args = append(args, *f.MinPrice)
+	}
+	if f.MaxPrice != nil {
+		conds = append(conds, `p.price <= ?`)
+		args = append(args, *f.MaxPrice)
+	}
+	if f.InStock {
+		conds = append(conds, kitStock+` > 0`)
+	}
+	switch f.Status {
+	case ProductStatusAll:
+	case ProductStatusArchived:
+		conds = append(conds, `p.archived_at IS NOT NULL`)
+	default:
+		conds = append(conds, `p.archived_at IS NULL`)
+	}
+	switch f.Level {
+	case ProductLevelParent:
+		conds = append(conds, `p.parent_id IS NULL`)
+	case ProductLevelVariant:
+		conds = append(conds, `NOT EXISTS (SELECT 1 FROM products v WHERE v.parent_id = p.id)`)
+	}
+
+	query := `SELECT p.id, p.name, p.sku, p.price, p.cost, ` + kitStock + ` AS stock, p.allow_negative_stock, p.plu, p.category_id, p.parent_id, p.own_price, p.unit, COALESCE((SELECT u.decimals FROM units u WHERE u.code = p.unit), 0) AS unit_decimals, p.archived_at, p.version, p.created_at, p.updated_at,
+                     ` + search.rank + ` AS rank
+              FROM products p` + search.join
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	return query, args
 }
 
 func (r *ProductRepository) GetByID(ctx context.Context, id int64) (*models.Product, error) {
-	query := `SELECT id, name, sku, price, stock, created_at, updated_at FROM products WHERE id = ?`
+	query := `SELECT p.id, p.name, p.sku, p.price, p.cost, ` + kitStock + `, p.allow_negative_stock, p.plu, p.category_id, p.parent_id, p.own_price, p.unit, COALESCE((SELECT u.decimals FROM units u WHERE u.code = p.unit), 0), p.archived_at, p.version, p.created_at, p.updated_at FROM products p WHERE p.id = ?`
 	row := r.db.QueryRowContext(ctx, query, id)
 
 	var p models.Product
-	err := row.Scan(
-		&p.ID,
-		&p.Name,
-		&p.SKU,
-		&p.Price,
-		&p.Stock,
-		&p.CreatedAt,
-		&p.UpdatedAt,
-	)
-	if err != nil {
+	if err := scanProduct(row, &p); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, sql.ErrNoRows
 		}
 		return nil, err
 	}
 
+	barcodes, err := r.GetBarcodes(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	p.Barcodes = barcodes
+
+	if p.Units, err = r.GetUnits(ctx, id); err != nil {
+		return nil, err
+	}
+
+	if p.Components, err = r.GetComponents(ctx, id); err != nil {
+		return nil, err
+	}
+
+	if p.ParentID != nil {
+		options, err := r.variantOptions(ctx, *p.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		p.Options = options[p.ID]
+		return &p, nil
+	}
+
+	if p.OptionTypes, err = r.GetOptions(ctx, id); err != nil {
+		return nil, err
+	}
+	if p.Variants, err = r.GetVariants(ctx, id); err != nil {
+		return nil, err
+	}
+
 	return &p, nil
 }
 
 func (r *ProductRepository) Create(ctx context.Context, p *models.Product) error {
-	now := time.Now().UTC()
+	if p.PLU != "" {
+		p.PLU = barcode.NormalizePLU(p.PLU)
+	}
+	if err := r.checkUnit(ctx, r.db, p); err != nil {
+		return err
+	}
+	return insertProduct(ctx, r.db, p, time.Now().UTC())
+}
 
-	query := `INSERT INTO products (name, sku, price, stock, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
-	res, err := r.db.ExecContext(ctx, query, p.Name, p.SKU, p.Price, p.Stock, now, now)
-	if err != nil {
+// insertProduct adds p; its unit has been checked by checkUnit.
+func insertProduct(ctx context.Context, q dbtx, p *models.Product, now time.Time) error {
+	query := `INSERT INTO products (name, sku, price, cost, stock, allow_negative_stock, plu, category_id, unit, created_at, updated_at)
+	          VALUES (?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, ?, ?, ?)`
+	res, err := q.ExecContext(ctx, query, p.Name, p.SKU, p.Price, p.Cost, p.Stock, p.AllowNegativeStock, p.PLU, p.CategoryID, p.Unit, now, now)
+	if err := productWriteError(err); err != nil {
 		return err
 	}
 
@@ -88,17 +359,95 @@ func (r *ProductRepository) Create(ctx context.Context, p *models.Product) error
 	}
 
 	p.ID = id
+	p.Version = 1
 	p.CreatedAt = now
 	p.UpdatedAt = now
 
 	return nil
 }
 
-func (r *ProductRepository) Update(ctx context.Context, p *models.Product) error {
+// checkUnit defaults p.Unit to pieces, makes sure the unit exists and that
+// the stock count fits its precision.
+func (r *ProductRepository) checkUnit(ctx context.Context, q dbtx, p *models.Product) error {
+	if p.Unit == "" {
+		p.Unit = UnitPieces
+	}
+	err := q.QueryRowContext(ctx, `SELECT decimals FROM units WHERE code = ?`, p.Unit).Scan(&p.QuantityDecimals)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrUnitNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !fitsPrecision(p.Stock, p.QuantityDecimals) {
+		return fmt.Errorf("%w: stock takes at most %d decimals in %s", ErrInvalidQuantity, p.QuantityDecimals, p.Unit)
+	}
+	return nil
+}
+
+// Update saves p. A variant priced differently from its parent keeps its
+// own price from then on; setting it back to the parent's price makes it
+// follow the parent again. Price and category changes on a parent carry
+// over to its variants.
+func (r *ProductRepository) Update(ctx context.Context, p *models.Product) (err error) {
+	if p.PLU != "" {
+		p.PLU = barcode.NormalizePLU(p.PLU)
+	}
 	now := time.Now().UTC()
 
-	query := `UPDATE products SET name = ?, sku = ?, price = ?, stock = ?, updated_at = ? WHERE id = ?`
-	_, err := r.db.ExecContext(ctx, query, p.Name, p.SKU, p.Price, p.Stock, now, p.ID)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = r.checkUnit(ctx, tx, p); err != nil {
+		return err
+	}
+	if err = updateProduct(ctx, tx, p, now); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateProduct saves p, whose unit has been checked by checkUnit, and
+// carries its price, category and unit over to its variants. When
+// p.Version is set the row must still be at that version, otherwise
+// ErrVersionConflict; p.Version is the new version afterwards. A missing
+// product is sql.ErrNoRows.
+func updateProduct(ctx context.Context, q dbtx, p *models.Product, now time.Time) error {
+	query := `UPDATE products SET name = ?, sku = ?, price = ?, cost = ?, stock = ?, allow_negative_stock = ?, plu = NULLIF(?, ''), category_id = ?,
+	          own_price = COALESCE((SELECT pp.price <> ? FROM products pp WHERE pp.id = products.parent_id), 0),
+	          unit = ?, version = version + 1, updated_at = ?
+	          WHERE id = ? AND (? = 0 OR version = ?)
+	          RETURNING version`
+	err := q.QueryRowContext(ctx, query, p.Name, p.SKU, p.Price, p.Cost, p.Stock, p.AllowNegativeStock, p.PLU, p.CategoryID, p.Price, p.Unit, now,
+		p.ID, p.Version, p.Version).Scan(&p.Version)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err := q.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM products WHERE id = ?)`, p.ID).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrVersionConflict
+		}
+		return sql.ErrNoRows
+	}
+	if err := productWriteError(err); err != nil {
+		return err
+	}
+
+	_, err = q.ExecContext(ctx,
+		`UPDATE products SET price = CASE WHEN own_price THEN price ELSE ? END, category_id = ?, unit = ?,
+                version = version + 1, updated_at = ?
+         WHERE parent_id = ?`,
+		p.Price, p.CategoryID, p.Unit, now, p.ID,
+	)
 	if err != nil {
 		return err
 	}
@@ -107,16 +456,188 @@ func (r *ProductRepository) Update(ctx context.Context, p *models.Product) error
 	return nil
 }
 
+// ProductPatch is a partial update; nil fields keep their value.
+type ProductPatch struct {
+	Name  *string
+	SKU   *string
+	Price *float64
+	Cost  *float64
+	Stock *float64
+	Unit  *string
+	PLU   *string // "" clears it
+
+	// the Set flags tell a value cleared to nil from one left out
+	SetCategoryID         bool
+	CategoryID            *int64
+	SetAllowNegativeStock bool
+	AllowNegativeStock    *bool
+}
+
+// Patch changes only the fields set in patch, on the product as it is in
+// the database at the time. With version > 0 the product must still be at
+// that version, otherwise ErrVersionConflict.
+func (r *ProductRepository) Patch(ctx context.Context, id int64, patch ProductPatch, version int64) (_ *models.Product, err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var p models.Product
+	err = scanProduct(tx.QueryRowContext(ctx,
+		`SELECT id, name, sku, price, cost, stock, allow_negative_stock, plu, category_id, parent_id, own_price, unit, COALESCE((SELECT u.decimals FROM units u WHERE u.code = products.unit), 0), archived_at, version, created_at, updated_at
+         FROM products WHERE id = ?`,
+		id,
+	), &p)
+	if err != nil {
+		return nil, err
+	}
+	if version > 0 && p.Version != version {
+		err = ErrVersionConflict
+		return nil, err
+	}
+
+	if patch.Name != nil {
+		p.Name = *patch.Name
+	}
+	if patch.SKU != nil {
+		p.SKU = *patch.SKU
+	}
+	if patch.Price != nil {
+		p.Price = *patch.Price
+	}
+	if patch.Cost != nil {
+		p.Cost = patch.Cost
+	}
+	if patch.Stock != nil {
+		p.Stock = *patch.Stock
+	}
+	if patch.Unit != nil {
+		p.Unit = *patch.Unit
+	}
+	if patch.PLU != nil {
+		p.PLU = *patch.PLU
+		if p.PLU != "" {
+			p.PLU = barcode.NormalizePLU(p.PLU)
+		}
+	}
+	if patch.SetCategoryID {
+		p.CategoryID = patch.CategoryID
+	}
+	if patch.SetAllowNegativeStock {
+		p.AllowNegativeStock = patch.AllowNegativeStock
+	}
+
+	if err = r.checkUnit(ctx, tx, &p); err != nil {
+		return nil, err
+	}
+	if err = updateProduct(ctx, tx, &p, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(ctx, id)
+}
+
+// productWriteError translates constraint failures of a product insert or
+// update.
+func productWriteError(err error) error {
+	if isForeignKeyViolation(err) {
+		return ErrCategoryNotFound
+	}
+	if isUniqueViolation(err) && strings.Contains(err.Error(), "products.plu") {
+		return ErrPLUTaken
+	}
+	if isUniqueViolation(err) && strings.Contains(err.Error(), "products.sku") {
+		return ErrSKUTaken
+	}
+	return err
+}
+
+// Delete removes a product for good. It returns ErrProductInUse when sales,
+// layaways, parked carts or kits still refer to it; such products can be
+// archived instead.
 func (r *ProductRepository) Delete(ctx context.Context, id int64) error {
 	query := `DELETE FROM products WHERE id = ?`
-	_, err := r.db.ExecContext(ctx, query, id)
-	return err
+	res, err := r.db.ExecContext(ctx, query, id)
+	if isForeignKeyViolation(err) {
+		return ErrProductInUse
+	}
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Archive takes a product off the POS, keeping it in sale history and
+// reports. A parent takes its variants along.
+func (r *ProductRepository) Archive(ctx context.Context, id int64) (*models.Product, error) {
+	now := time.Now().UTC()
+	res, err := r.db.ExecContext(ctx,
+		`UPDATE products SET archived_at = COALESCE(archived_at, ?), version = version + 1, updated_at = ?
+         WHERE id = ? OR parent_id = ?`,
+		now, now, id, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return nil, err
+	} else if n == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	return r.GetByID(ctx, id)
+}
+
+// Unarchive puts an archived product back on sale, with its variants. A
+// variant cannot come back while its parent is archived.
+func (r *ProductRepository) Unarchive(ctx context.Context, id int64) (*models.Product, error) {
+	var parentArchived bool
+	err := r.db.QueryRowContext(ctx,
+		`SELECT COALESCE((SELECT pp.archived_at IS NOT NULL FROM products pp WHERE pp.id = p.parent_id), 0)
+         FROM products p WHERE p.id = ?`,
+		id,
+	).Scan(&parentArchived)
+	if err != nil {
+		return nil, err
+	}
+	if parentArchived {
+		return nil, ErrParentArchived
+	}
+
+	now := time.Now().UTC()
+	_, err = r.db.ExecContext(ctx,
+		`UPDATE products SET archived_at = NULL, version = version + 1, updated_at = ?
+         WHERE (id = ? OR parent_id = ?) AND archived_at IS NOT NULL`,
+		now, id, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(ctx, id)
 }
 
-func (r *ProductRepository) GetLowStock(ctx context.Context, threshold int64) ([]models.Product, error) {
-	query := `SELECT id, name, sku, price, stock, created_at, updated_at
+func (r *ProductRepository) GetLowStock(ctx context.Context, threshold float64) ([]models.Product, error) {
+	query := `SELECT id, name, sku, price, cost, stock, allow_negative_stock, plu, category_id, parent_id, own_price, unit, COALESCE((SELECT u.decimals FROM units u WHERE u.code = products.unit), 0), archived_at, version, created_at, updated_at
 	          FROM products
-	          WHERE stock <= ?
+	          WHERE stock <= ? AND archived_at IS NULL
+	            AND NOT EXISTS (SELECT 1 FROM kit_components kc WHERE kc.kit_id = products.id)
 	          ORDER BY stock ASC, id ASC`
 
 	rows, err := r.db.QueryContext(ctx, query, threshold)
@@ -128,15 +649,7 @@ func (r *ProductRepository) GetLowStock(ctx context.Context, threshold int64) ([
 	var products []models.Product
 	for rows.Next() {
 		var p models.Product
-		if err := rows.Scan(
-			&p.ID,
-			&p.Name,
-			&p.SKU,
-			&p.Price,
-			&p.Stock,
-			&p.CreatedAt,
-			&p.UpdatedAt,
-		); err != nil {
+		if err := scanProduct(rows, &p); err != nil {
 			return nil, err
 		}
 		products = append(products, p)
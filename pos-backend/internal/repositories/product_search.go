@@ -0,0 +1,183 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// fuzzyCandidateLimit caps how many trigram hits are checked for typos.
+const fuzzyCandidateLimit = 200
+
+// productSearch narrows the catalog to a free-text query: an optional join
+// on a search index, a condition, and the expression ranking matches
+// (lower is better). rankArgs bind before args since the rank is selected.
+type productSearch struct {
+	join     string
+	cond     string
+	args     []any
+	rank     string
+	rankArgs []any
+}
+
+var noProductSearch = productSearch{rank: "0"}
+
+// searchTerms splits a query into lower-case words the same way the
+// unicode61 tokenizer splits names and SKUs, e.g. "SKU-001" -> sku, 001.
+func searchTerms(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// ftsProductSearch matches every term as a word prefix, so "red sho"
+// finds "Red Shoes".
+func ftsProductSearch(terms []string) productSearch {
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = `"` + t + `"*`
+	}
+
+	return productSearch{
+		join: ` JOIN products_fts ON products_fts.rowid = p.id`,
+		cond: `products_fts MATCH ?`,
+		args: []any{strings.Join(quoted, " ")},
+		rank: `bm25(products_fts)`,
+	}
+}
+
+// fuzzyProductSearch is the fallback when no product matches every term
+// exactly. Products sharing trigrams with the query are fetched from the
+// trigram index and kept when each term is within a small edit distance of
+// one of their words. Matches keep the trigram index's ranking.
+func (r *ProductRepository) fuzzyProductSearch(ctx context.Context, terms []string) (productSearch, bool, error) {
+	var grams []string
+	seen := make(map[string]bool)
+	for _, t := range terms {
+		runes := []rune(t)
+		for i := 0; i+3 <= len(runes); i++ {
+			g := string(runes[i : i+3])
+			if !seen[g] {
+				seen[g] = true
+				grams = append(grams, `"`+g+`"`)
+			}
+		}
+	}
+	if len(grams) == 0 {
+		return productSearch{}, false, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT rowid, name, sku FROM products_trigram
+         WHERE products_trigram MATCH ?
+         ORDER BY rank
+         LIMIT ?`,
+		strings.Join(grams, " OR "), fuzzyCandidateLimit,
+	)
+	if err != nil {
+		return productSearch{}, false, err
+	}
+	defer rows.Close()
+
+	var ids []any
+	for rows.Next() {
+		var id int64
+		var name, sku string
+		if err := rows.Scan(&id, &name, &sku); err != nil {
+			return productSearch{}, false, err
+		}
+		if fuzzyMatch(terms, searchTerms(name+" "+sku)) {
+			ids = append(ids, id)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return productSearch{}, false, err
+	}
+
+	if len(ids) == 0 {
+		return productSearch{}, false, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+
+	// rank by position in the trigram results
+	var rank strings.Builder
+	var rankArgs []any
+	rank.WriteString(`CASE p.id`)
+	for i, id := range ids {
+		rank.WriteString(` WHEN ? THEN ?`)
+		rankArgs = append(rankArgs, id, i)
+	}
+	rank.WriteString(` END`)
+
+	return productSearch{
+		cond:     `p.id IN (` + placeholders + `)`,
+		args:     ids,
+		rank:     rank.String(),
+		rankArgs: rankArgs,
+	}, true, nil
+}
+
+// fuzzyMatch reports whether every term is a prefix of one of the words or
+// close to one. Terms shorter than three letters must match exactly.
+func fuzzyMatch(terms, words []string) bool {
+	for _, t := range terms {
+		if !fuzzyTermMatch(t, words) {
+			return false
+		}
+	}
+	return true
+}
+
+func fuzzyTermMatch(term string, words []string) bool {
+	n := utf8.RuneCountInString(term)
+	maxTypos := 1
+	if n > 5 {
+		maxTypos = 2
+	}
+
+	for _, w := range words {
+		if strings.HasPrefix(w, term) {
+			return true
+		}
+		if n < 3 {
+			continue
+		}
+		// compare against the whole word and against its prefixes around
+		// the term's length, so "shoo" still finds "shoes"
+		if levenshtein(term, w) <= maxTypos {
+			return true
+		}
+		wr := []rune(w)
+		for l := n - 1; l <= n+1; l++ {
+			if l > 0 && l < len(wr) && levenshtein(term, string(wr[:l])) <= maxTypos {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	cur := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		cur[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+
+	return prev[len(br)]
+}
@@ -0,0 +1,156 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"pos-backend/internal/models"
+)
+
+// AddUnit gives a product a purchase unit, e.g. "case" holding 24 of the
+// product's own unit.
+func (r *ProductRepository) AddUnit(ctx context.Context, u *models.ProductUnit) error {
+	u.Name = strings.TrimSpace(u.Name)
+	if u.Name == "" || u.Factor <= 0 {
+		return fmt.Errorf("%w: a purchase unit needs a name and a factor above zero", ErrInvalidUnit)
+	}
+	now := time.Now().UTC()
+
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO product_units (product_id, name, factor, created_at)
+         SELECT ?, ?, ?, ? WHERE EXISTS (SELECT 1 FROM products WHERE id = ?)`,
+		u.ProductID, u.Name, u.Factor, now, u.ProductID,
+	)
+	if isUniqueViolation(err) {
+		return ErrProductUnitTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	u.ID, err = res.LastInsertId()
+	u.CreatedAt = now
+	return err
+}
+
+func (r *ProductRepository) DeleteUnit(ctx context.Context, productID, unitID int64) error {
+	res, err := r.db.ExecContext(ctx,
+		`DELETE FROM product_units WHERE id = ? AND product_id = ?`,
+		unitID, productID,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *ProductRepository) GetUnits(ctx context.Context, productID int64) ([]models.ProductUnit, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, product_id, name, factor, created_at FROM product_units WHERE product_id = ? ORDER BY factor, id`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var units []models.ProductUnit
+	for rows.Next() {
+		var u models.ProductUnit
+		if err := rows.Scan(&u.ID, &u.ProductID, &u.Name, &u.Factor, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		units = append(units, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return units, nil
+}
+
+// ReceiveStock adds delivered goods to a product's stock. unit is one of
+// the product's purchase units, or empty (or the product's own unit) for a
+// quantity already in stock units. The converted quantity must fit the
+// precision of the product's unit.
+func (r *ProductRepository) ReceiveStock(ctx context.Context, productID int64, quantity float64, unit string) (_ *models.Product, err error) {
+	if quantity <= 0 {
+		return nil, fmt.Errorf("%w: quantity must be greater than zero", ErrInvalidQuantity)
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var stockUnit string
+	var decimals int
+	err = tx.QueryRowContext(ctx,
+		`SELECT p.unit, COALESCE(u.decimals, 0) FROM products p LEFT JOIN units u ON u.code = p.unit WHERE p.id = ?`,
+		productID,
+	).Scan(&stockUnit, &decimals)
+	if err != nil {
+		return nil, err
+	}
+
+	factor := 1.0
+	unit = strings.TrimSpace(unit)
+	if unit != "" && !strings.EqualFold(unit, stockUnit) {
+		err = tx.QueryRowContext(ctx,
+			`SELECT factor FROM product_units WHERE product_id = ? AND name = ? COLLATE NOCASE`,
+			productID, unit,
+		).Scan(&factor)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrUnitNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	received := roundQuantity(quantity * factor)
+	if !fitsPrecision(received, decimals) {
+		err = fmt.Errorf("%w: %g %s has more than %d decimals", ErrInvalidQuantity, received, stockUnit, decimals)
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE products SET stock = ROUND(stock + ?, ?), version = version + 1, updated_at = ? WHERE id = ?`,
+		received, quantityScale, time.Now().UTC(), productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(ctx, productID)
+}
@@ -0,0 +1,519 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"pos-backend/internal/models"
+)
+
+// maxVariants caps the size of a generated option matrix.
+const maxVariants = 500
+
+var (
+	ErrSKUTaken          = errors.New("SKU is already assigned to a product")
+	ErrVariantOfVariant  = errors.New("a variant cannot have variants of its own")
+	ErrOptionsMismatch   = errors.New("options must name the same option types as the existing variants")
+	ErrInvalidOptions    = errors.New("invalid options")
+	ErrInvalidSKUPattern = errors.New("invalid SKU pattern")
+	ErrTooManyVariants   = fmt.Errorf("an option matrix is limited to %d variants", maxVariants)
+)
+
+// GenerateVariantsParams lists a parent's option types and the SKU pattern
+// for the variants. The pattern takes {sku} for the parent SKU and
+// {Option} for each option type, e.g. "{sku}-{Size}-{Color}"; it defaults
+// to the parent SKU followed by every option in order.
+type GenerateVariantsParams struct {
+	Options    []models.ProductOption
+	SKUPattern string
+}
+
+// VariantMatrix is the result of generating variants: the ones just
+// created and every variant of the parent.
+type VariantMatrix struct {
+	Created  []models.Product `json:"created"`
+	Variants []models.Product `json:"variants"`
+}
+
+// GenerateVariants stores the parent's option types and creates a variant
+// for every combination of their values that has none yet, so running it
+// again after adding a value only fills in the new combinations. Once
+// variants exist the option types themselves are fixed; values may only be
+// added.
+func (r *ProductRepository) GenerateVariants(ctx context.Context, parentID int64, params GenerateVariantsParams) (_ *VariantMatrix, err error) {
+	if err := normalizeOptions(params.Options); err != nil {
+		return nil, err
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var parent models.Product
+	row := tx.QueryRowContext(ctx,
+		`SELECT id, name, sku, price, cost, stock, allow_negative_stock, plu, category_id, parent_id, own_price, unit, COALESCE((SELECT u.decimals FROM units u WHERE u.code = products.unit), 0), archived_at, version, created_at, updated_at
+         FROM products WHERE id = ?`,
+		parentID,
+	)
+	if err = scanProduct(row, &parent); err != nil {
+		return nil, err
+	}
+	if parent.ParentID != nil {
+		return nil, ErrVariantOfVariant
+	}
+
+	existing, err := getOptions(ctx, tx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	var variantCount int
+	if err = tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM products WHERE parent_id = ?`, parentID).Scan(&variantCount); err != nil {
+		return nil, err
+	}
+	if variantCount > 0 && !sameOptionNames(existing, params.Options) {
+		return nil, ErrOptionsMismatch
+	}
+
+	options, err := saveOptions(ctx, tx, parentID, existing, params.Options)
+	if err != nil {
+		return nil, err
+	}
+
+	pattern := params.SKUPattern
+	if pattern == "" {
+		pattern = "{sku}"
+		for _, o := range options {
+			pattern += "-{" + o.Name + "}"
+		}
+	}
+	if err = checkSKUPattern(pattern, options); err != nil {
+		return nil, err
+	}
+
+	combos := [][]models.ProductOptionValue{nil}
+	for _, o := range options {
+		var next [][]models.ProductOptionValue
+		for _, c := range combos {
+			for _, v := range o.Values {
+				next = append(next, append(append([]models.ProductOptionValue{}, c...), v))
+			}
+		}
+		combos = next
+		if len(combos) > maxVariants {
+			return nil, ErrTooManyVariants
+		}
+	}
+
+	have, err := variantKeys(ctx, tx, parentID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	matrix := &VariantMatrix{Created: []models.Product{}}
+
+	for _, combo := range combos {
+		if have[comboKey(combo)] {
+			continue
+		}
+
+		v := models.Product{
+			Name:               parent.Name,
+			SKU:                pattern,
+			Price:              parent.Price,
+			Cost:               parent.Cost,
+			AllowNegativeStock: parent.AllowNegativeStock,
+			CategoryID:         parent.CategoryID,
+			ParentID:           &parent.ID,
+			Unit:               parent.Unit,
+			QuantityDecimals:   parent.QuantityDecimals,
+			CreatedAt:          now,
+			UpdatedAt:          now,
+			Options:            make(map[string]string, len(combo)),
+		}
+		v.SKU = strings.ReplaceAll(v.SKU, "{sku}", parent.SKU)
+		for i, val := range combo {
+			v.Name += " / " + val.Value
+			v.SKU = replaceFold(v.SKU, "{"+options[i].Name+"}", val.Code)
+			v.Options[options[i].Name] = val.Value
+		}
+
+		res, err := tx.ExecContext(ctx,
+			`INSERT INTO products (name, sku, price, cost, stock, allow_negative_stock, category_id, parent_id, unit, created_at, updated_at)
+             VALUES (?, ?, ?, ?, 0, ?, ?, ?, ?, ?, ?)`,
+			v.Name, v.SKU, v.Price, v.Cost, v.AllowNegativeStock, v.CategoryID, v.ParentID, v.Unit, now, now,
+		)
+		if err = productWriteError(err); err != nil {
+			return nil, err
+		}
+		if v.ID, err = res.LastInsertId(); err != nil {
+			return nil, err
+		}
+
+		for _, val := range combo {
+			if _, err = tx.ExecContext(ctx,
+				`INSERT INTO product_variant_values (variant_id, option_value_id) VALUES (?, ?)`,
+				v.ID, val.ID,
+			); err != nil {
+				return nil, err
+			}
+		}
+
+		matrix.Created = append(matrix.Created, v)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	if matrix.Variants, err = r.GetVariants(ctx, parentID); err != nil {
+		return nil, err
+	}
+	return matrix, nil
+}
+
+// GetOptions returns a product's option types with their values, in the
+// order they were given.
+func (r *ProductRepository) GetOptions(ctx context.Context, productID int64) ([]models.ProductOption, error) {
+	return getOptions(ctx, r.db, productID)
+}
+
+func getOptions(ctx context.Context, q dbtx, productID int64) ([]models.ProductOption, error) {
+	rows, err := q.QueryContext(ctx,
+		`SELECT o.id, o.name, v.id, v.value, v.code
+         FROM product_options o
+         JOIN product_option_values v ON v.option_id = o.id
+         WHERE o.product_id = ?
+         ORDER BY o.position, o.id, v.position, v.id`,
+		productID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var options []models.ProductOption
+	for rows.Next() {
+		var o models.ProductOption
+		var v models.ProductOptionValue
+		if err := rows.Scan(&o.ID, &o.Name, &v.ID, &v.Value, &v.Code); err != nil {
+			return nil, err
+		}
+		if n := len(options); n == 0 || options[n-1].ID != o.ID {
+			options = append(options, o)
+		}
+		last := &options[len(options)-1]
+		last.Values = append(last.Values, v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return options, nil
+}
+
+// GetVariants returns the variants of a parent with their option values.
+func (r *ProductRepository) GetVariants(ctx context.Context, parentID int64) ([]models.Product, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT id, name, sku, price, cost, stock, allow_negative_stock, plu, category_id, parent_id, own_price, unit, COALESCE((SELECT u.decimals FROM units u WHERE u.code = products.unit), 0), archived_at, version, created_at, updated_at
+         FROM products WHERE parent_id = ?
+         ORDER BY id`,
+		parentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []models.Product
+	for rows.Next() {
+		var p models.Product
+		if err := scanProduct(rows, &p); err != nil {
+			return nil, err
+		}
+		variants = append(variants, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	options, err := r.variantOptions(ctx, parentID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range variants {
+		variants[i].Options = options[variants[i].ID]
+	}
+
+	return variants, nil
+}
+
+// variantOptions maps each variant of a parent to its value per option
+// type.
+func (r *ProductRepository) variantOptions(ctx context.Context, parentID int64) (map[int64]map[string]string, error) {
+	rows, err := r.db.QueryContext(ctx,
+		`SELECT pvv.variant_id, o.name, v.value
+         FROM product_variant_values pvv
+         JOIN product_option_values v ON v.id = pvv.option_value_id
+         JOIN product_options o ON o.id = v.option_id
+         WHERE o.product_id = ?`,
+		parentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	options := make(map[int64]map[string]string)
+	for rows.Next() {
+		var variantID int64
+		var name, value string
+		if err := rows.Scan(&variantID, &name, &value); err != nil {
+			return nil, err
+		}
+		if options[variantID] == nil {
+			options[variantID] = make(map[string]string)
+		}
+		options[variantID][name] = value
+	}
+
+	return options, rows.Err()
+}
+
+// normalizeOptions trims names and values, fills in missing SKU codes and
+// rejects empty or repeated entries.
+func normalizeOptions(options []models.ProductOption) error {
+	if len(options) == 0 {
+		return fmt.Errorf("%w: at least one option type is required", ErrInvalidOptions)
+	}
+
+	names := make(map[string]bool)
+	for i := range options {
+		o := &options[i]
+		o.Name = strings.TrimSpace(o.Name)
+		if o.Name == "" || strings.ContainsAny(o.Name, "{}") {
+			return fmt.Errorf("%w: option names must be non-empty and cannot contain braces", ErrInvalidOptions)
+		}
+		if strings.EqualFold(o.Name, "sku") || names[strings.ToLower(o.Name)] {
+			return fmt.Errorf("%w: option %q is given twice or is reserved", ErrInvalidOptions, o.Name)
+		}
+		names[strings.ToLower(o.Name)] = true
+
+		if len(o.Values) == 0 {
+			return fmt.Errorf("%w: option %q has no values", ErrInvalidOptions, o.Name)
+		}
+		values := make(map[string]bool)
+		for j := range o.Values {
+			v := &o.Values[j]
+			v.Value = strings.TrimSpace(v.Value)
+			v.Code = strings.TrimSpace(v.Code)
+			if v.Code == "" {
+				v.Code = skuCode(v.Value)
+			}
+			if v.Value == "" || v.Code == "" {
+				return fmt.Errorf("%w: option %q has an empty value", ErrInvalidOptions, o.Name)
+			}
+			if values[strings.ToLower(v.Value)] {
+				return fmt.Errorf("%w: option %q lists %q twice", ErrInvalidOptions, o.Name, v.Value)
+			}
+			values[strings.ToLower(v.Value)] = true
+		}
+	}
+	return nil
+}
+
+// skuCode derives a value's SKU part: its letters and digits, upper-cased,
+// so "Navy Blue" becomes "NAVYBLUE".
+func skuCode(value string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, value)
+}
+
+func sameOptionNames(existing, requested []models.ProductOption) bool {
+	if len(existing) != len(requested) {
+		return false
+	}
+	for _, e := range existing {
+		found := false
+		for _, o := range requested {
+			if strings.EqualFold(e.Name, o.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// saveOptions merges the requested option types into the stored ones and
+// returns the result in stored order. Types and values missing from the
+// request are dropped unless a variant uses them; existing values keep
+// their SKU code unless the request gives a new one.
+func saveOptions(ctx context.Context, tx *sql.Tx, productID int64, existing, requested []models.ProductOption) ([]models.ProductOption, error) {
+	for i, o := range requested {
+		optionID := int64(0)
+		for _, e := range existing {
+			if strings.EqualFold(e.Name, o.Name) {
+				optionID = e.ID
+			}
+		}
+		if optionID == 0 {
+			res, err := tx.ExecContext(ctx,
+				`INSERT INTO product_options (product_id, name, position) VALUES (?, ?, ?)`,
+				productID, o.Name, i,
+			)
+			if err != nil {
+				return nil, err
+			}
+			if optionID, err = res.LastInsertId(); err != nil {
+				return nil, err
+			}
+		} else if _, err := tx.ExecContext(ctx,
+			`UPDATE product_options SET name = ?, position = ? WHERE id = ?`,
+			o.Name, i, optionID,
+		); err != nil {
+			return nil, err
+		}
+
+		keep := []any{optionID}
+		for j, v := range o.Values {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO product_option_values (option_id, value, code, position) VALUES (?, ?, ?, ?)
+                 ON CONFLICT (option_id, value COLLATE NOCASE) DO UPDATE SET value = excluded.value, code = excluded.code, position = excluded.position`,
+				optionID, v.Value, v.Code, j,
+			)
+			if err != nil {
+				return nil, err
+			}
+			keep = append(keep, v.Value)
+		}
+
+		// values still used by a variant stay, after the requested ones
+		_, err := tx.ExecContext(ctx,
+			`DELETE FROM product_option_values
+             WHERE option_id = ? AND value COLLATE NOCASE NOT IN (`+placeholders(len(keep)-1)+`)
+               AND id NOT IN (SELECT option_value_id FROM product_variant_values)`,
+			keep...,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// option types left out of the request only exist while no variant
+	// uses them
+	var keep []any
+	keep = append(keep, productID)
+	for _, o := range requested {
+		keep = append(keep, o.Name)
+	}
+	if _, err := tx.ExecContext(ctx,
+		`DELETE FROM product_options WHERE product_id = ? AND name COLLATE NOCASE NOT IN (`+placeholders(len(keep)-1)+`)`,
+		keep...,
+	); err != nil {
+		return nil, err
+	}
+
+	return getOptions(ctx, tx, productID)
+}
+
+// checkSKUPattern makes sure every option type appears in the pattern, so
+// no two variants share a SKU, and that it names nothing else.
+func checkSKUPattern(pattern string, options []models.ProductOption) error {
+	rest := strings.ReplaceAll(pattern, "{sku}", "")
+	for _, o := range options {
+		next := replaceFold(rest, "{"+o.Name+"}", "")
+		if next == rest {
+			return fmt.Errorf("%w: {%s} is missing", ErrInvalidSKUPattern, o.Name)
+		}
+		rest = next
+	}
+	if strings.ContainsAny(rest, "{}") {
+		return fmt.Errorf("%w: only {sku} and option names can be used", ErrInvalidSKUPattern)
+	}
+	return nil
+}
+
+// replaceFold replaces every case-insensitive match of old in s.
+func replaceFold(s, old, new string) string {
+	var b strings.Builder
+	lower, lowerOld := strings.ToLower(s), strings.ToLower(old)
+	for {
+		i := strings.Index(lower, lowerOld)
+		if i < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		b.WriteString(s[:i] + new)
+		s, lower = s[i+len(old):], lower[i+len(old):]
+	}
+}
+
+// variantKeys returns the combination key of every existing variant.
+func variantKeys(ctx context.Context, tx *sql.Tx, parentID int64) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT pvv.variant_id, pvv.option_value_id
+         FROM product_variant_values pvv
+         JOIN products p ON p.id = pvv.variant_id
+         WHERE p.parent_id = ?`,
+		parentID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make(map[int64][]models.ProductOptionValue)
+	for rows.Next() {
+		var variantID int64
+		var v models.ProductOptionValue
+		if err := rows.Scan(&variantID, &v.ID); err != nil {
+			return nil, err
+		}
+		values[variantID] = append(values[variantID], v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]bool, len(values))
+	for _, combo := range values {
+		keys[comboKey(combo)] = true
+	}
+	return keys, nil
+}
+
+// comboKey identifies a combination of option values regardless of order.
+func comboKey(combo []models.ProductOptionValue) string {
+	ids := make([]int64, len(combo))
+	for i, v := range combo {
+		ids[i] = v.ID
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return fmt.Sprint(ids)
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
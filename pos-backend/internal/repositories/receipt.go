@@ -0,0 +1,67 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	ReceiptScopeStore    = "store"
+	ReceiptScopeTerminal = "terminal"
+)
+
+var ErrTerminalRequired = errors.New("terminal is required for per-terminal receipt numbering")
+
+// ReceiptConfig controls how receipt numbers are formatted and which
+// counter a sale draws from.
+type ReceiptConfig struct {
+	Prefix      string // e.g. "R"
+	StoreCode   string // identifies the store in the number, e.g. "S1"
+	Scope       string // ReceiptScopeStore or ReceiptScopeTerminal
+	YearlyReset bool   // start again from 1 every calendar year
+}
+
+// allocateReceiptNumber takes the next number from the sale's sequence.
+// It must run on the sale transaction: the counter is only advanced if the
+// sale commits, which keeps the sequence gapless.
+func allocateReceiptNumber(ctx context.Context, q dbtx, cfg ReceiptConfig, terminalID string, now time.Time) (string, error) {
+	parts := []string{}
+	if cfg.Prefix != "" {
+		parts = append(parts, cfg.Prefix)
+	}
+	if cfg.StoreCode != "" {
+		parts = append(parts, cfg.StoreCode)
+	}
+
+	if cfg.Scope == ReceiptScopeTerminal {
+		if terminalID == "" {
+			return "", ErrTerminalRequired
+		}
+		parts = append(parts, terminalID)
+	}
+
+	scope := strings.Join(parts, "-")
+
+	var year int
+	if cfg.YearlyReset {
+		year = now.Year()
+		parts = append(parts, fmt.Sprintf("%d", year))
+	}
+
+	var next int64
+	err := q.QueryRowContext(ctx,
+		`INSERT INTO receipt_sequences (scope, year, last_number) VALUES (?, ?, 1)
+         ON CONFLICT (scope, year) DO UPDATE SET last_number = last_number + 1
+         RETURNING last_number`,
+		scope, year,
+	).Scan(&next)
+	if err != nil {
+		return "", err
+	}
+
+	parts = append(parts, fmt.Sprintf("%06d", next))
+	return strings.Join(parts, "-"), nil
+}
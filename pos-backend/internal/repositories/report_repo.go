@@ -3,6 +3,7 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"math"
 	"time"
 )
 
@@ -14,10 +15,36 @@ func NewReportRepository(db *sql.DB) *ReportRepository {
 	return &ReportRepository{db: db}
 }
 
+// ReportFilter narrows every report to a date range and optionally to the
+// sales rung up by one cashier.
+type ReportFilter struct {
+	From    time.Time
+	To      time.Time // exclusive
+	UserID  int64     // 0 = all cashiers
+	ShiftID int64     // 0 = all shifts
+}
+
+// where returns the sales conditions for f, assuming sales is aliased as s.
+func (f ReportFilter) where() (string, []any) {
+	cond := `s.created_at >= ? AND s.created_at < ?`
+	args := []any{f.From, f.To}
+	if f.UserID > 0 {
+		cond += ` AND s.user_id = ?`
+		args = append(args, f.UserID)
+	}
+	if f.ShiftID > 0 {
+		cond += ` AND s.shift_id = ?`
+		args = append(args, f.ShiftID)
+	}
+	return cond, args
+}
+
 type SalesSummary struct {
-	TotalSales   int64   `json:"total_sales"`
-	TotalRevenue float64 `json:"total_revenue"`
-	TotalItems   int64   `json:"total_items"`
+	TotalSales    int64   `json:"total_sales"`
+	TotalRevenue  float64 `json:"total_revenue"`
+	TotalItems    float64 `json:"total_items"`
+	TotalRounding float64 `json:"total_rounding"` // cash rounding included in revenue
+	TotalTips     float64 `json:"total_tips"`     // excluded from revenue
 }
 
 type DailySalesRow struct {
@@ -26,45 +53,84 @@ type DailySalesRow struct {
 	TotalRevenue float64 `json:"total_revenue"`
 }
 
+// TipsPayoutRow is what one employee or tip pool is owed for a shift.
+type TipsPayoutRow struct {
+	ShiftID      int64   `json:"shift_id,omitempty"`
+	UserID       int64   `json:"user_id,omitempty"`
+	EmployeeName string  `json:"employee_name,omitempty"`
+	TipPool      string  `json:"tip_pool,omitempty"`
+	TenderCount  int64   `json:"tender_count"`
+	CashTips     float64 `json:"cash_tips"`
+	NonCashTips  float64 `json:"non_cash_tips"`
+	TotalTips    float64 `json:"total_tips"`
+}
+
+// CategorySalesRow rolls sales up a category tree: Revenue and Quantity
+// include every subcategory, OwnRevenue only products assigned directly.
+// Products without a category are reported under CategoryID 0.
+type CategorySalesRow struct {
+	CategoryID   int64   `json:"category_id"`
+	CategoryName string  `json:"category_name"`
+	ParentID     *int64  `json:"parent_id"`
+	Depth        int     `json:"depth"` // 0 for top-level categories
+	Quantity     float64 `json:"quantity"`
+	Revenue      float64 `json:"revenue"`
+	OwnRevenue   float64 `json:"own_revenue"`
+}
+
 type TopProductRow struct {
 	ProductID   int64   `json:"product_id"`
 	ProductName string  `json:"product_name"`
-	Quantity    int64   `json:"quantity"`
+	ParentID    *int64  `json:"parent_id,omitempty"` // variant level only
+	Quantity    float64 `json:"quantity"`
 	Revenue     float64 `json:"revenue"`
 }
 
-func (r *ReportRepository) SalesSummary(ctx context.Context, from, to time.Time) (*SalesSummary, error) {
+func (r *ReportRepository) SalesSummary(ctx context.Context, f ReportFilter) (*SalesSummary, error) {
+	where, args := f.where()
+
+	// item counts are pre-aggregated per sale so multi-line sales are not
+	// counted more than once in the revenue sum
 	query := `
 SELECT
-    COUNT(DISTINCT s.id) AS total_sales,
+    COUNT(s.id) AS total_sales,
     COALESCE(SUM(s.total_amount), 0) AS total_revenue,
-    COALESCE(SUM(si.quantity), 0) AS total_items
+    COALESCE(SUM(si.quantity), 0) AS total_items,
+    COALESCE(SUM(s.rounding_amount), 0) AS total_rounding,
+    COALESCE(SUM(t.tips), 0) AS total_tips
 FROM sales s
-LEFT JOIN sale_items si ON s.id = si.sale_id
-WHERE s.created_at >= ? AND s.created_at < ?;
+LEFT JOIN (
+    SELECT sale_id, SUM(quantity) AS quantity FROM sale_items GROUP BY sale_id
+) si ON s.id = si.sale_id
+LEFT JOIN (
+    SELECT sale_id, SUM(tip_amount) AS tips FROM sale_tenders GROUP BY sale_id
+) t ON s.id = t.sale_id
+WHERE ` + where + `;
 `
-	row := r.db.QueryRowContext(ctx, query, from, to)
+	row := r.db.QueryRowContext(ctx, query, args...)
 
 	var summary SalesSummary
-	if err := row.Scan(&summary.TotalSales, &summary.TotalRevenue, &summary.TotalItems); err != nil {
+	if err := row.Scan(&summary.TotalSales, &summary.TotalRevenue, &summary.TotalItems, &summary.TotalRounding, &summary.TotalTips); err != nil {
 		return nil, err
 	}
 
 	return &summary, nil
 }
 
-func (r *ReportRepository) DailySales(ctx context.Context, from, to time.Time) ([]DailySalesRow, error) {
+func (r *ReportRepository) DailySales(ctx context.Context, f ReportFilter) ([]DailySalesRow, error) {
+	where, args := f.where()
+
 	query := `
 SELECT
     DATE(s.created_at) AS day,
     COUNT(DISTINCT s.id) AS total_sales,
     COALESCE(SUM(s.total_amount), 0) AS total_revenue
 FROM sales s
-WHERE s.created_at >= ? AND s.created_at < ?
+WHERE ` + where + `
 GROUP BY day
 ORDER BY day;
 `
-	rows, err := r.db.QueryContext(ctx, query, from, to)
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -86,27 +152,59 @@ ORDER BY day;
 	return list, nil
 }
 
-func (r *ReportRepository) TopProducts(ctx context.Context, from, to time.Time, limit int) ([]TopProductRow, error) {
+// ProductLevelComponent reports kits as the components they were sold as.
+const ProductLevelComponent = "component"
+
+// componentLines lists sale lines with each kit line replaced by what it
+// moved and earned per component.
+const componentLines = `
+    SELECT si.sale_id, si.product_id, si.quantity, si.line_total
+    FROM sale_items si
+    WHERE NOT EXISTS (SELECT 1 FROM sale_item_components sic WHERE sic.sale_item_id = si.id)
+    UNION ALL
+    SELECT si.sale_id, sic.component_id, sic.quantity, sic.revenue
+    FROM sale_item_components sic
+    JOIN sale_items si ON si.id = sic.sale_item_id`
+
+// TopProducts ranks products by revenue. At ProductLevelParent the sales
+// of variants count towards their parent; otherwise each variant is
+// ranked on its own. At ProductLevelComponent kit revenue is credited to
+// the kit's components by its allocation.
+func (r *ReportRepository) TopProducts(ctx context.Context, f ReportFilter, level string, limit int) ([]TopProductRow, error) {
 	if limit <= 0 {
 		limit = 5
 	}
 
+	where, args := f.where()
+
+	// join the row a line is reported under
+	lines := `sale_items`
+	join := `JOIN products p ON si.product_id = p.id`
+	switch level {
+	case ProductLevelParent:
+		join = `JOIN products sold ON si.product_id = sold.id
+JOIN products p ON p.id = COALESCE(sold.parent_id, sold.id)`
+	case ProductLevelComponent:
+		lines = `(` + componentLines + `)`
+	}
+
 	query := `
 SELECT
     p.id AS product_id,
     p.name AS product_name,
+    p.parent_id,
     COALESCE(SUM(si.quantity), 0) AS quantity,
     COALESCE(SUM(si.line_total), 0) AS revenue
-FROM sale_items si
+FROM ` + lines + ` si
 JOIN sales s ON si.sale_id = s.id
-JOIN products p ON si.product_id = p.id
-WHERE s.created_at >= ? AND s.created_at < ?
-GROUP BY p.id, p.name
+` + join + `
+WHERE ` + where + `
+GROUP BY p.id, p.name, p.parent_id
 ORDER BY revenue DESC
 LIMIT ?;
 `
 
-	rows, err := r.db.QueryContext(ctx, query, from, to, limit)
+	rows, err := r.db.QueryContext(ctx, query, append(args, limit)...)
 	if err != nil {
 		return nil, err
 	}
@@ -115,7 +213,161 @@ LIMIT ?;
 	var list []TopProductRow
 	for rows.Next() {
 		var row TopProductRow
-		if err := rows.Scan(&row.ProductID, &row.ProductName, &row.Quantity, &row.Revenue); err != nil {
+		var parentID sql.NullInt64
+		if err := rows.Scan(&row.ProductID, &row.ProductName, &parentID, &row.Quantity, &row.Revenue); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			row.ParentID = &parentID.Int64
+		}
+		list = append(list, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// CategorySales reports revenue per category with subcategories rolled
+// into their ancestors. parentID > 0 limits the rows to the direct
+// subcategories of that category, for drilling down the tree.
+func (r *ReportRepository) CategorySales(ctx context.Context, f ReportFilter, parentID int64) ([]CategorySalesRow, error) {
+	where, args := f.where()
+
+	query := `
+WITH RECURSIVE ancestry(category_id, ancestor_id) AS (
+    SELECT id, id FROM categories
+    UNION ALL
+    SELECT a.category_id, c.parent_id
+    FROM ancestry a
+    JOIN categories c ON c.id = a.ancestor_id
+    WHERE c.parent_id IS NOT NULL
+),
+depths(id, depth) AS (
+    SELECT id, 0 FROM categories WHERE parent_id IS NULL
+    UNION ALL
+    SELECT c.id, d.depth + 1 FROM categories c JOIN depths d ON c.parent_id = d.id
+),
+lines AS (
+    SELECT p.category_id, si.quantity, si.line_total
+    FROM sale_items si
+    JOIN sales s ON si.sale_id = s.id
+    JOIN products p ON si.product_id = p.id
+    WHERE ` + where + `
+)
+SELECT
+    c.id,
+    c.name,
+    c.parent_id,
+    d.depth,
+    COALESCE(SUM(l.quantity), 0) AS quantity,
+    COALESCE(SUM(l.line_total), 0) AS revenue,
+    COALESCE(SUM(CASE WHEN l.category_id = c.id THEN l.line_total END), 0) AS own_revenue
+FROM lines l
+JOIN ancestry a ON a.category_id = l.category_id
+JOIN categories c ON c.id = a.ancestor_id
+JOIN depths d ON d.id = c.id`
+
+	if parentID > 0 {
+		query += `
+WHERE c.parent_id = ?
+GROUP BY c.id, c.name, c.parent_id, d.depth`
+		args = append(args, parentID)
+	} else {
+		query += `
+GROUP BY c.id, c.name, c.parent_id, d.depth
+UNION ALL
+SELECT 0, 'Uncategorized', NULL, 0, SUM(quantity), SUM(line_total), SUM(line_total)
+FROM lines
+WHERE category_id IS NULL
+HAVING COUNT(*) > 0`
+	}
+	query += `
+ORDER BY revenue DESC;
+`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []CategorySalesRow
+	for rows.Next() {
+		var row CategorySalesRow
+		var parent sql.NullInt64
+		if err := rows.Scan(
+			&row.CategoryID,
+			&row.CategoryName,
+			&parent,
+			&row.Depth,
+			&row.Quantity,
+			&row.Revenue,
+			&row.OwnRevenue,
+		); err != nil {
+			return nil, err
+		}
+		if parent.Valid {
+			row.ParentID = &parent.Int64
+		}
+		list = append(list, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
+
+// TipsPayout groups tips by shift and recipient. recipientID narrows the
+// report to one employee; 0 includes everyone and every pool.
+func (r *ReportRepository) TipsPayout(ctx context.Context, f ReportFilter, recipientID int64) ([]TipsPayoutRow, error) {
+	where, args := f.where()
+	if recipientID > 0 {
+		where += ` AND t.tip_user_id = ?`
+		args = append(args, recipientID)
+	}
+
+	query := `
+SELECT
+    COALESCE(s.shift_id, 0) AS shift_id,
+    COALESCE(t.tip_user_id, 0) AS user_id,
+    COALESCE(u.name, '') AS employee_name,
+    t.tip_pool,
+    COUNT(*) AS tender_count,
+    COALESCE(SUM(CASE WHEN t.method = 'cash' THEN t.tip_amount ELSE 0 END), 0) AS cash_tips,
+    COALESCE(SUM(CASE WHEN t.method <> 'cash' THEN t.tip_amount ELSE 0 END), 0) AS non_cash_tips,
+    COALESCE(SUM(t.tip_amount), 0) AS total_tips
+FROM sale_tenders t
+JOIN sales s ON t.sale_id = s.id
+LEFT JOIN users u ON t.tip_user_id = u.id
+WHERE t.tip_amount > 0 AND ` + where + `
+GROUP BY s.shift_id, t.tip_user_id, u.name, t.tip_pool
+ORDER BY s.shift_id, employee_name, t.tip_pool;
+`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []TipsPayoutRow
+	for rows.Next() {
+		var row TipsPayoutRow
+		if err := rows.Scan(
+			&row.ShiftID,
+			&row.UserID,
+			&row.EmployeeName,
+			&row.TipPool,
+			&row.TenderCount,
+			&row.CashTips,
+			&row.NonCashTips,
+			&row.TotalTips,
+		); err != nil {
 			return nil, err
 		}
 		list = append(list, row)
@@ -127,3 +379,104 @@ LIMIT ?;
 
 	return list, nil
 }
+
+// Gross profit groupings.
+const (
+	GroupByProduct  = "product"
+	GroupByCategory = "category"
+	GroupByDay      = "day"
+	GroupByCashier  = "cashier"
+)
+
+// GrossProfitRow sets revenue against the cost of the goods sold, at the
+// unit cost recorded on each line when it was sold. Revenue is before
+// tax; returns count against both. Lines sold without a known cost are
+// left out of Cost and GrossProfit and counted in UncostedRevenue, so
+// they do not pass for pure profit. MarginPercent is gross profit as a
+// share of the revenue that has a cost, nil when there was none.
+type GrossProfitRow struct {
+	ID              int64    `json:"id,omitempty"`   // product, category or cashier; 0 for none
+	Name            string   `json:"name,omitempty"` // product, category or cashier name
+	Date            string   `json:"date,omitempty"` // day grouping only
+	Quantity        float64  `json:"quantity"`
+	Revenue         float64  `json:"revenue"`
+	Cost            float64  `json:"cost"`
+	GrossProfit     float64  `json:"gross_profit"`
+	MarginPercent   *float64 `json:"margin_percent"`
+	UncostedRevenue float64  `json:"uncosted_revenue"` // part of Revenue from lines without a cost
+}
+
+// GrossProfit reports gross profit and margin grouped by product (each
+// variant and kit on its own), by the category products are assigned to,
+// by day or by cashier. Days and cashiers are in date order and by name;
+// products and categories by gross profit, highest first.
+func (r *ReportRepository) GrossProfit(ctx context.Context, f ReportFilter, groupBy string) ([]GrossProfitRow, error) {
+	where, args := f.where()
+
+	var key, join, order string
+	switch groupBy {
+	case GroupByCategory:
+		key = `COALESCE(c.id, 0), COALESCE(c.name, 'Uncategorized'), ''`
+		join = `JOIN products p ON si.product_id = p.id
+LEFT JOIN categories c ON p.category_id = c.id`
+		order = `gross_profit DESC`
+	case GroupByDay:
+		// the date part of the stored timestamp; DATE() cannot parse the
+		// zone suffix Go writes
+		key = `0, '', SUBSTR(s.created_at, 1, 10)`
+		order = `3`
+	case GroupByCashier:
+		key = `COALESCE(u.id, 0), COALESCE(u.name, ''), ''`
+		join = `LEFT JOIN users u ON s.user_id = u.id`
+		order = `2`
+	default:
+		key = `p.id, p.name, ''`
+		join = `JOIN products p ON si.product_id = p.id`
+		order = `gross_profit DESC`
+	}
+
+	query := `
+SELECT
+    ` + key + `,
+    COALESCE(SUM(si.quantity), 0) AS quantity,
+    COALESCE(SUM(si.line_total), 0) AS revenue,
+    COALESCE(SUM(si.quantity * si.unit_cost), 0) AS cost,
+    COALESCE(SUM(si.line_total - si.quantity * si.unit_cost), 0) AS gross_profit,
+    COALESCE(SUM(CASE WHEN si.unit_cost IS NULL THEN si.line_total END), 0) AS uncosted_revenue
+FROM sale_items si
+JOIN sales s ON si.sale_id = s.id
+` + join + `
+WHERE ` + where + `
+GROUP BY 1, 2, 3
+ORDER BY ` + order + `;
+`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []GrossProfitRow{}
+	for rows.Next() {
+		var row GrossProfitRow
+		if err := rows.Scan(&row.ID, &row.Name, &row.Date, &row.Quantity, &row.Revenue, &row.Cost, &row.GrossProfit, &row.UncostedRevenue); err != nil {
+			return nil, err
+		}
+		row.Revenue = roundMoney(row.Revenue)
+		row.Cost = roundMoney(row.Cost)
+		row.GrossProfit = roundMoney(row.GrossProfit)
+		row.UncostedRevenue = roundMoney(row.UncostedRevenue)
+		if costed := row.Revenue - row.UncostedRevenue; costed != 0 {
+			margin := math.Round(row.GrossProfit/costed*10000) / 100
+			row.MarginPercent = &margin
+		}
+		list = append(list, row)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return list, nil
+}
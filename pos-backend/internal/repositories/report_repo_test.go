@@ -0,0 +1,87 @@
+package repositories
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"pos-backend/internal/database"
+)
+
+func TestGrossProfitUnknownCost(t *testing.T) {
+	db, err := database.NewSQLiteDB(filepath.Join(t.TempDir(), "pos.db"))
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	res, err := db.Exec(`INSERT INTO users (name, email, password_hash, role) VALUES ('Till', 'till@example.com', 'x', 'cashier')`)
+	if err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	userID, _ := res.LastInsertId()
+
+	// a product with a cost and one whose cost was never entered
+	res, err = db.Exec(`INSERT INTO products (name, sku, price, cost, stock) VALUES ('Tea', 'TEA', 10, 4, 10)`)
+	if err != nil {
+		t.Fatalf("insert product: %v", err)
+	}
+	tea, _ := res.LastInsertId()
+	res, err = db.Exec(`INSERT INTO products (name, sku, price, stock) VALUES ('Cake', 'CAKE', 10, 10)`)
+	if err != nil {
+		t.Fatalf("insert product: %v", err)
+	}
+	cake, _ := res.LastInsertId()
+
+	ctx := context.Background()
+	sales := NewSaleRepository(db, PricingConfig{}, ReceiptConfig{Prefix: "R", StoreCode: "T", Scope: ReceiptScopeStore})
+	sale, err := sales.Create(ctx, &CreateSaleParams{
+		Items:   []CreateSaleItemParam{{ProductID: tea, Quantity: 2}, {ProductID: cake, Quantity: 1}},
+		Tenders: []TenderParam{{Method: "cash", Amount: 30}},
+		UserID:  userID,
+	})
+	if err != nil {
+		t.Fatalf("create sale: %v", err)
+	}
+	for _, item := range sale.Items {
+		if item.ProductID == cake && item.UnitCost != nil {
+			t.Errorf("cake line unit cost = %v, want unknown", *item.UnitCost)
+		}
+	}
+
+	f := ReportFilter{From: time.Now().Add(-time.Hour), To: time.Now().Add(time.Hour)}
+	reports := NewReportRepository(db)
+
+	byProduct, err := reports.GrossProfit(ctx, f, GroupByProduct)
+	if err != nil {
+		t.Fatalf("gross profit by product: %v", err)
+	}
+	if len(byProduct) != 2 {
+		t.Fatalf("%d products, want 2", len(byProduct))
+	}
+	for _, row := range byProduct {
+		switch row.ID {
+		case tea:
+			if row.Cost != 8 || row.GrossProfit != 12 || row.UncostedRevenue != 0 || row.MarginPercent == nil || *row.MarginPercent != 60 {
+				t.Errorf("tea = %+v, want cost 8, profit 12, margin 60", row)
+			}
+		case cake:
+			if row.Cost != 0 || row.GrossProfit != 0 || row.UncostedRevenue != 10 || row.MarginPercent != nil {
+				t.Errorf("cake = %+v, want no profit or margin and 10 uncosted", row)
+			}
+		}
+	}
+
+	byDay, err := reports.GrossProfit(ctx, f, GroupByDay)
+	if err != nil {
+		t.Fatalf("gross profit by day: %v", err)
+	}
+	if len(byDay) != 1 {
+		t.Fatalf("%d days, want 1", len(byDay))
+	}
+	// the cake is not counted as pure profit
+	if day := byDay[0]; day.Revenue != 30 || day.GrossProfit != 12 || day.UncostedRevenue != 10 || *day.MarginPercent != 60 {
+		t.Errorf("day = %+v, want revenue 30, profit 12, 10 uncosted, margin 60", day)
+	}
+}
@@ -0,0 +1,76 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	busyRetries     = 5
+	busyBackoffBase = 20 * time.Millisecond
+)
+
+// retryOnBusy runs fn again when SQLite reports the database as busy or
+// locked. busy_timeout already makes a connection wait for the lock; this
+// covers the waits that still time out under heavy contention. fn must
+// roll back its own transaction before returning an error.
+func retryOnBusy[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		v, err := fn()
+		if err == nil || !isBusy(err) || attempt == busyRetries {
+			return v, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return v, ctx.Err()
+		case <-time.After(busyBackoffBase << attempt):
+		}
+	}
+}
+
+func isBusy(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	// extended result codes keep the primary code in the low byte
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	}
+	return false
+}
+
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+		return true
+	}
+	return false
+}
+
+// isForeignKeyViolation also matches ON DELETE RESTRICT, which SQLite
+// raises with the trigger code rather than the foreign key one.
+func isForeignKeyViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	switch sqliteErr.Code() {
+	case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+		return true
+	case sqlite3.SQLITE_CONSTRAINT_TRIGGER:
+		return strings.Contains(sqliteErr.Error(), "FOREIGN KEY constraint failed")
+	}
+	return false
+}
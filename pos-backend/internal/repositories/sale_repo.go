@@ -4,37 +4,220 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"pos-backend/internal/models"
 )
 
+const (
+	SaleKindSale     = "sale"
+	SaleKindExchange = "exchange"
+)
+
 var (
 	ErrInsufficientStock = errors.New("insufficient stock for product")
 	ErrProductNotFound   = errors.New("product not found")
+	ErrReturnNotFound    = errors.New("returned item is not on the original sale")
+	ErrReturnExceedsSold = errors.New("return quantity exceeds the quantity sold")
+	ErrPaymentRequired   = errors.New("payment is required for the amount due")
+	ErrUnderpaid         = errors.New("tenders do not cover the amount due")
+	ErrTipUserNotFound   = errors.New("tip user not found")
+	ErrNoPaymentDue      = errors.New("no payment is due when the customer is refunded")
+	ErrItemExpired       = errors.New("item is past its expiry date")
+	ErrVariantRequired   = errors.New("product is sold by variant")
+	ErrProductArchived   = errors.New("product is archived")
+)
+
+const (
+	LineErrorProductNotFound   = "product_not_found"
+	LineErrorBarcodeNotFound   = "barcode_not_found"
+	LineErrorInsufficientStock = "insufficient_stock"
+	LineErrorExpired           = "expired"
+	LineErrorVariantRequired   = "variant_required"
+	LineErrorInvalidQuantity   = "invalid_quantity"
+	LineErrorArchived          = "archived"
 )
 
+// LineError explains why one cart line cannot be sold. Line is the
+// zero-based position of the line in the request.
+type LineError struct {
+	Line        int      `json:"line"`
+	ProductID   int64    `json:"product_id"`
+	ComponentID int64    `json:"component_id,omitempty"` // the kit component that ran short
+	Barcode     string   `json:"barcode,omitempty"`
+	Code        string   `json:"code"`
+	Requested   float64  `json:"requested"`
+	Available   *float64 `json:"available,omitempty"` // nil when the product does not exist
+
+	ExpiryDate string `json:"expiry_date,omitempty"` // expired lines only
+	Unit       string `json:"unit,omitempty"`        // invalid quantities only
+	Decimals   *int   `json:"decimals,omitempty"`    // precision the quantity must have
+}
+
+// SaleLinesError reports every line of a cart that failed, so the cashier
+// can fix them all at once. errors.Is matches ErrProductNotFound (also for
+// unknown barcodes), ErrInsufficientStock, ErrItemExpired,
+// ErrVariantRequired, ErrInvalidQuantity and ErrProductArchived when at
+// least one line has that problem.
+type SaleLinesError struct {
+	Lines []LineError
+}
+
+func (e *SaleLinesError) Error() string {
+	return fmt.Sprintf("%d sale line(s) cannot be sold", len(e.Lines))
+}
+
+func (e *SaleLinesError) Is(target error) bool {
+	for _, l := range e.Lines {
+		if target == ErrProductNotFound && (l.Code == LineErrorProductNotFound || l.Code == LineErrorBarcodeNotFound) {
+			return true
+		}
+		if target == ErrInsufficientStock && l.Code == LineErrorInsufficientStock {
+			return true
+		}
+		if target == ErrItemExpired && l.Code == LineErrorExpired {
+			return true
+		}
+		if target == ErrVariantRequired && l.Code == LineErrorVariantRequired {
+			return true
+		}
+		if target == ErrInvalidQuantity && l.Code == LineErrorInvalidQuantity {
+			return true
+		}
+		if target == ErrProductArchived && l.Code == LineErrorArchived {
+			return true
+		}
+	}
+	return false
+}
+
 type SaleRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	pricing  PricingConfig
+	receipts ReceiptConfig
 }
 
-func NewSaleRepository(db *sql.DB) *SaleRepository {
-	return &SaleRepository{db: db}
+func NewSaleRepository(db *sql.DB, pricing PricingConfig, receipts ReceiptConfig) *SaleRepository {
+	return &SaleRepository{db: db, pricing: pricing, receipts: receipts}
 }
 
+// CreateSaleItemParam is one cart line. A line sold by scanning sets
+// Barcode instead of ProductID; Quantity then counts scans, which a case
+// pack barcode multiplies.
 type CreateSaleItemParam struct {
 	ProductID         int64
-	Quantity          int64
+	Barcode           string
+	Quantity          float64
 	UnitPriceOverride *float64 // nil = use product price
 }
 
+type TenderParam struct {
+	Method    string
+	Amount    float64 // amount handed over for this tender, tip excluded
+	TipAmount float64
+	TipUserID int64  // 0 = the cashier, unless TipPool is set
+	TipPool   string // shared tip jar name, e.g. "kitchen"
+}
+
+// ReturnItemParam identifies a line of the original sale being brought
+// back in an exchange, either by sale item id or by product.
+type ReturnItemParam struct {
+	SaleItemID int64 // 0 = first line of ProductID with quantity left to return
+	ProductID  int64
+	Quantity   float64
+}
+
 type CreateSaleParams struct {
-	Items         []CreateSaleItemParam
-	PaymentMethod string
-	PaidAmount    float64
+	Items      []CreateSaleItemParam
+	Tenders    []TenderParam
+	UserID     int64 // cashier from the JWT
+	TerminalID string
+
+	// ParkedSaleID is the resumed cart this sale rings up. Its stock hold
+	// is handed over to the sale and the cart is removed with it.
+	ParkedSaleID int64
+
+	// Exchanges only. When the returned lines are worth more than the new
+	// ones the difference is paid back with RefundMethod instead of Tenders.
+	OriginalSaleID int64
+	Returns        []ReturnItemParam
+	RefundMethod   string
+
+	// set when completing a layaway, whose lines were sold before any of
+	// its products could be archived, at the list price, discount and tax
+	// locked in when it was opened (one entry per item)
+	allowArchived bool
+	locked        []lockedLine
+
+	// set when parking a cart that holds no stock: its lines are checked
+	// for everything but availability, which is the sale's to check
+	ignoreStock bool
+}
+
+// lockedLine holds the amounts of a line priced earlier, which a later sale
+// of it must keep even if prices or the tax rate have changed since.
+type lockedLine struct {
+	ListPrice float64
+	Discount  float64
+	TaxAmount float64
+	LineTotal float64
+}
+
+const (
+	SaleSortCreatedAt   = "created_at"
+	SaleSortTotalAmount = "total_amount"
+)
+
+// SaleFilter narrows and orders the sales listing. Zero values mean "no
+// filter" so handlers only set what the caller asked for.
+type SaleFilter struct {
+	ReceiptNumber string    // prefix match
+	UserID        int64     // 0 = any cashier
+	From          time.Time // inclusive
+	To            time.Time // exclusive
+	PaymentMethod string    // matches any tender of the sale; "split" matches sales paid several ways
+	MinTotal      *float64
+	MaxTotal      *float64
+	ProductID     int64 // sales with at least one line of this product
+
+	Sort   string // SaleSortCreatedAt (default) or SaleSortTotalAmount
+	Desc   bool
+	Limit  int    // 0 = default page size
+	Cursor string // next_cursor from the previous page
+
+	SkipCount bool // leave TotalCount 0, for callers reading every page
+}
+
+// SalePage is one page of the sales listing. NextCursor is empty on the
+// last page; TotalCount covers every page of the filtered listing.
+type SalePage struct {
+	Items      []models.Sale `json:"items"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	TotalCount int64         `json:"total_count"`
 }
 
+// Quote prices a cart exactly as Create would, without writing anything.
+func (r *SaleRepository) Quote(ctx context.Context, params *CreateSaleParams) (*SaleQuote, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	return priceSale(ctx, tx, r.pricing, params, time.Now().UTC())
+}
+
+// Create records a sale in one write transaction, retried when another
+// till holds the database lock for too long.
 func (r *SaleRepository) Create(ctx context.Context, params *CreateSaleParams) (*models.Sale, error) {
+	return retryOnBusy(ctx, func() (*models.Sale, error) {
+		return r.create(ctx, params)
+	})
+}
+
+func (r *SaleRepository) create(ctx context.Context, params *CreateSaleParams) (*models.Sale, error) {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, err
@@ -45,67 +228,72 @@ func (r *SaleRepository) Create(ctx context.Context, params *CreateSaleParams) (
 		}
 	}()
 
-	type itemPrepared struct {
-		ProductID   int64
-		ProductName string
-		Quantity    int64
-		UnitPrice   float64
-		LineTotal   float64
+	sale, err := createSale(ctx, tx, r.pricing, r.receipts, params)
+	if err != nil {
+		return nil, err
 	}
 
-	var preparedItems []itemPrepared
-	var total float64
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
 
-	for _, it := range params.Items {
-		var productName string
-		var productPrice float64
-		var stock int64
+	return sale, nil
+}
 
-		row := tx.QueryRowContext(ctx,
-			`SELECT name, price, stock FROM products WHERE id = ?`,
-			it.ProductID,
-		)
+// createSale prices and records a sale on an existing transaction. Other
+// flows that end in a sale, such as completing a layaway, reuse it so every
+// sale gets the same pricing, receipt number and stock handling.
+func createSale(ctx context.Context, tx dbtx, pricing PricingConfig, receipts ReceiptConfig, params *CreateSaleParams) (*models.Sale, error) {
+	createdAt := time.Now().UTC()
 
-		if err = row.Scan(&productName, &productPrice, &stock); err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				err = ErrProductNotFound
-				return nil, err
-			}
+	// the cart goes with the sale; if the sale fails it is rolled back and
+	// keeps holding its stock
+	if params.ParkedSaleID != 0 {
+		if err := takeParkedSale(ctx, tx, params.ParkedSaleID, createdAt); err != nil {
 			return nil, err
 		}
+	}
 
-		if it.Quantity <= 0 {
-			err = errors.New("quantity must be greater than zero")
-			return nil, err
+	quote, err := priceSale(ctx, tx, pricing, params, createdAt)
+	if err != nil {
+		return nil, err
+	}
+	// a quote may leave the difference open, a sale may not
+	if quote.TotalAmount > 0 {
+		if len(quote.Tenders) == 0 {
+			return nil, ErrPaymentRequired
 		}
-
-		if stock < it.Quantity {
-			err = ErrInsufficientStock
-			return nil, err
+		var applied float64
+		for _, t := range quote.Tenders {
+			applied += t.Amount
 		}
-
-		unitPrice := productPrice
-		if it.UnitPriceOverride != nil {
-			unitPrice = *it.UnitPriceOverride
+		if applied = roundMoney(applied); applied < quote.TotalAmount {
+			return nil, fmt.Errorf("%w: %.2f of %.2f paid", ErrUnderpaid, applied, quote.TotalAmount)
 		}
+	}
 
-		lineTotal := unitPrice * float64(it.Quantity)
-		total += lineTotal
+	receiptNumber, err := allocateReceiptNumber(ctx, tx, receipts, params.TerminalID, createdAt)
+	if err != nil {
+		return nil, err
+	}
 
-		preparedItems = append(preparedItems, itemPrepared{
-			ProductID:   it.ProductID,
-			ProductName: productName,
-			Quantity:    it.Quantity,
-			UnitPrice:   unitPrice,
-			LineTotal:   lineTotal,
-		})
+	// sales rung up while the till has an open shift count towards its drawer
+	shiftID, err := openShiftID(ctx, tx, params.TerminalID)
+	if err != nil {
+		return nil, err
 	}
 
-	createdAt := time.Now().UTC()
+	kind := SaleKindSale
+	if params.OriginalSaleID != 0 {
+		kind = SaleKindExchange
+	}
 
 	res, err := tx.ExecContext(ctx,
-		`INSERT INTO sales (total_amount, paid_amount, payment_method, created_at) VALUES (?, ?, ?, ?)`,
-		total, params.PaidAmount, params.PaymentMethod, createdAt,
+		`INSERT INTO sales (receipt_number, kind, original_sale_id, subtotal, discount_amount, tax_amount, rounding_amount,
+                            total_amount, paid_amount, payment_method, user_id, terminal_id, shift_id, created_at)
+         VALUES (?, ?, NULLIF(?, 0), ?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), ?)`,
+		receiptNumber, kind, params.OriginalSaleID, quote.Subtotal, quote.DiscountAmount, quote.TaxAmount, quote.RoundingAmount,
+		quote.TotalAmount, quote.PaidAmount, quote.PaymentMethod, params.UserID, params.TerminalID, shiftID, createdAt,
 	)
 	if err != nil {
 		return nil, err
@@ -116,100 +304,276 @@ func (r *SaleRepository) Create(ctx context.Context, params *CreateSaleParams) (
 		return nil, err
 	}
 
-	for _, item := range preparedItems {
-		_, err = tx.ExecContext(ctx,
-			`INSERT INTO sale_items (sale_id, product_id, quantity, unit_price, line_total, created_at)
-             VALUES (?, ?, ?, ?, ?, ?)`,
-			saleID, item.ProductID, item.Quantity, item.UnitPrice, item.LineTotal, createdAt,
+	sale := &models.Sale{
+		ID:             saleID,
+		ReceiptNumber:  receiptNumber,
+		Kind:           kind,
+		OriginalSaleID: params.OriginalSaleID,
+		Subtotal:       quote.Subtotal,
+		DiscountAmount: quote.DiscountAmount,
+		TaxAmount:      quote.TaxAmount,
+		RoundingAmount: quote.RoundingAmount,
+		TotalAmount:    quote.TotalAmount,
+		PaidAmount:     quote.PaidAmount,
+		PaymentMethod:  quote.PaymentMethod,
+		TipAmount:      quote.TipAmount,
+		UserID:         params.UserID,
+		TerminalID:     params.TerminalID,
+		ShiftID:        shiftID,
+		CreatedAt:      createdAt,
+	}
+
+	// return lines have a negative quantity, so the same stock update
+	// puts them back on the shelf
+	for _, item := range quote.Items {
+		res, err = tx.ExecContext(ctx,
+			`INSERT INTO sale_items (sale_id, product_id, quantity, list_price, unit_price, discount_amount, tax_amount, line_total, unit_cost,
+                                     returned_item_id, barcode, weight, lot, expiry_date, created_at)
+             VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, NULLIF(?, 0), NULLIF(?, ''), ?, NULLIF(?, ''), NULLIF(?, ''), ?)`,
+			saleID, item.ProductID, item.Quantity, item.ListPrice, item.UnitPrice,
+			item.Discount, item.TaxAmount, item.LineTotal, item.UnitCost, item.ReturnedItemID, item.Barcode, item.Weight,
+			item.Lot, item.ExpiryDate, createdAt,
 		)
 		if err != nil {
 			return nil, err
 		}
 
-		_, err = tx.ExecContext(ctx,
-			`UPDATE products SET stock = stock - ? WHERE id = ?`,
-			item.Quantity, item.ProductID,
-		)
+		var itemID int64
+		itemID, err = res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(item.Components) > 0 {
+			err = recordKitLine(ctx, tx, itemID, item.Components, pricing.AllowNegativeStock, createdAt)
+		} else {
+			err = deductStock(ctx, tx, item.ProductID, item.Quantity, pricing.AllowNegativeStock, createdAt)
+		}
 		if err != nil {
 			return nil, err
 		}
+
+		sale.Items = append(sale.Items, models.SaleItem{
+			ID:             itemID,
+			SaleID:         saleID,
+			ProductID:      item.ProductID,
+			ProductName:    item.ProductName,
+			Quantity:       item.Quantity,
+			ListPrice:      item.ListPrice,
+			UnitPrice:      item.UnitPrice,
+			DiscountAmount: item.Discount,
+			TaxAmount:      item.TaxAmount,
+			LineTotal:      item.LineTotal,
+			UnitCost:       item.UnitCost,
+			ReturnedItemID: item.ReturnedItemID,
+			Barcode:        item.Barcode,
+			Weight:         item.Weight,
+			Lot:            item.Lot,
+			ExpiryDate:     item.ExpiryDate,
+			Components:     item.Components,
+			CreatedAt:      createdAt,
+		})
 	}
 
-	if err = tx.Commit(); err != nil {
-		return nil, err
+	for _, t := range quote.Tenders {
+		var tender *models.SaleTender
+		tender, err = insertSaleTender(ctx, tx, saleID, t, createdAt)
+		if err != nil {
+			return nil, err
+		}
+		sale.Tenders = append(sale.Tenders, *tender)
 	}
 
-	sale := &models.Sale{
-		ID:            saleID,
-		TotalAmount:   total,
-		PaidAmount:    params.PaidAmount,
-		PaymentMethod: params.PaymentMethod,
-		CreatedAt:     createdAt,
+	return sale, nil
+}
+
+func insertSaleTender(ctx context.Context, q dbtx, saleID int64, t PricedTender, createdAt time.Time) (*models.SaleTender, error) {
+	res, err := q.ExecContext(ctx,
+		`INSERT INTO sale_tenders (sale_id, method, amount, tip_amount, tip_user_id, tip_pool, created_at)
+         VALUES (?, ?, ?, ?, NULLIF(?, 0), ?, ?)`,
+		saleID, t.Method, t.Amount, t.TipAmount, t.TipUserID, t.TipPool, createdAt,
+	)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, item := range preparedItems {
-		sale.Items = append(sale.Items, models.SaleItem{
-			SaleID:      saleID,
-			ProductID:   item.ProductID,
-			ProductName: item.ProductName,
-			Quantity:    item.Quantity,
-			UnitPrice:   item.UnitPrice,
-			LineTotal:   item.LineTotal,
-			CreatedAt:   createdAt,
-		})
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
 	}
 
-	return sale, nil
+	return &models.SaleTender{
+		ID:        id,
+		SaleID:    saleID,
+		Method:    t.Method,
+		Amount:    t.Amount,
+		TipAmount: t.TipAmount,
+		TipUserID: t.TipUserID,
+		TipPool:   t.TipPool,
+		CreatedAt: createdAt,
+	}, nil
+}
+
+// saleSelect is shared by the sale read paths so every listing returns the
+// same columns in the order scanSale expects.
+const saleSelect = `SELECT s.id, COALESCE(s.receipt_number, ''), s.kind, COALESCE(s.original_sale_id, 0), s.subtotal, s.discount_amount, s.tax_amount,
+                s.rounding_amount, s.total_amount, s.paid_amount, s.payment_method,
+                (SELECT COALESCE(SUM(t.tip_amount), 0) FROM sale_tenders t WHERE t.sale_id = s.id),
+                COALESCE(s.user_id, 0), COALESCE(u.name, ''), s.terminal_id, COALESCE(s.shift_id, 0), s.created_at
+         FROM sales s
+         LEFT JOIN users u ON s.user_id = u.id`
+
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-func (r *SaleRepository) GetAll(ctx context.Context) ([]models.Sale, error) {
-	rows, err := r.db.QueryContext(ctx,
-		`SELECT id, total_amount, paid_amount, payment_method, created_at
-         FROM sales ORDER BY id DESC`,
+func scanSale(row rowScanner, s *models.Sale) error {
+	return row.Scan(
+		&s.ID,
+		&s.ReceiptNumber,
+		&s.Kind,
+		&s.OriginalSaleID,
+		&s.Subtotal,
+		&s.DiscountAmount,
+		&s.TaxAmount,
+		&s.RoundingAmount,
+		&s.TotalAmount,
+		&s.PaidAmount,
+		&s.PaymentMethod,
+		&s.TipAmount,
+		&s.UserID,
+		&s.CashierName,
+		&s.TerminalID,
+		&s.ShiftID,
+		&s.CreatedAt,
 	)
+}
+
+func (f SaleFilter) where() (string, []any) {
+	var conds []string
+	var args []any
+	if f.ReceiptNumber != "" {
+		conds = append(conds, `s.receipt_number LIKE ? ESCAPE '\'`)
+		args = append(args, escapeLike(f.ReceiptNumber)+"%")
+	}
+	if f.UserID > 0 {
+		conds = append(conds, `s.user_id = ?`)
+		args = append(args, f.UserID)
+	}
+	if !f.From.IsZero() {
+		conds = append(conds, `s.created_at >= ?`)
+		args = append(args, f.From)
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, `s.created_at < ?`)
+		args = append(args, f.To)
+	}
+	if f.PaymentMethod == paymentMethodSplit {
+		conds = append(conds, `s.payment_method = ?`)
+		args = append(args, f.PaymentMethod)
+	} else if f.PaymentMethod != "" {
+		conds = append(conds, `EXISTS (SELECT 1 FROM sale_tenders t WHERE t.sale_id = s.id AND t.method = ?)`)
+		args = append(args, f.PaymentMethod)
+	}
+	if f.MinTotal != nil {
+		conds = append(conds, `s.total_amount >= ?`)
+		args = append(args, *f.MinTotal)
+	}
+	if f.MaxTotal != nil {
+		conds = append(conds, `s.total_amount <= ?`)
+		args = append(args, *f.MaxTotal)
+	}
+	if f.ProductID > 0 {
+		conds = append(conds, `EXISTS (SELECT 1 FROM sale_items si WHERE si.sale_id = s.id AND si.product_id = ?)`)
+		args = append(args, f.ProductID)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return ` WHERE ` + strings.Join(conds, " AND "), args
+}
+
+// GetAll returns one page of sales matching filter, in the filter's sort
+// order: ascending unless Desc is set.
+func (r *SaleRepository) GetAll(ctx context.Context, filter SaleFilter) (*SalePage, error) {
+	if filter.Sort == "" {
+		filter.Sort = SaleSortCreatedAt
+	}
+	filter.Limit = pageLimit(filter.Limit)
+
+	where, args := filter.where()
+
+	page := &SalePage{Items: []models.Sale{}}
+	if !filter.SkipCount {
+		if err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM sales s`+where, args...).Scan(&page.TotalCount); err != nil {
+			return nil, err
+		}
+	}
+
+	// ids grow with created_at, so date ordering only needs the id
+	sortCol := ""
+	if filter.Sort == SaleSortTotalAmount {
+		sortCol = "s.total_amount"
+	}
+
+	var cursor *listCursor
+	if filter.Cursor != "" {
+		c, err := decodeListCursor(filter.Cursor, filter.Sort, filter.Desc)
+		if err != nil {
+			return nil, err
+		}
+		cursor = &c
+	}
+
+	cond, cursorArgs, order := keyset(sortCol, "s.id", filter.Desc, cursor)
+	if cond != "" {
+		if where == "" {
+			where = ` WHERE ` + cond
+		} else {
+			where += ` AND ` + cond
+		}
+		args = append(args, cursorArgs...)
+	}
+
+	// fetch one extra row to know whether there is a next page
+	rows, err := r.db.QueryContext(ctx, saleSelect+where+order+` LIMIT ?`, append(args, filter.Limit+1)...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var sales []models.Sale
 	for rows.Next() {
 		var s models.Sale
-		if err := rows.Scan(
-			&s.ID,
-			&s.TotalAmount,
-			&s.PaidAmount,
-			&s.PaymentMethod,
-			&s.CreatedAt,
-		); err != nil {
+		if err := scanSale(rows, &s); err != nil {
 			return nil, err
 		}
-		sales = append(sales, s)
+		page.Items = append(page.Items, s)
 	}
 
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return sales, nil
+	if len(page.Items) > filter.Limit {
+		page.Items = page.Items[:filter.Limit]
+		last := page.Items[len(page.Items)-1]
+		c := listCursor{Sort: filter.Sort, Desc: filter.Desc, ID: last.ID}
+		if filter.Sort == SaleSortTotalAmount {
+			c.Key = last.TotalAmount
+		}
+		page.NextCursor = c.encode()
+	}
+
+	return page, nil
 }
 
 func (r *SaleRepository) GetByID(ctx context.Context, id int64) (*models.Sale, error) {
 	var s models.Sale
 
-	row := r.db.QueryRowContext(ctx,
-		`SELECT id, total_amount, paid_amount, payment_method, created_at
-         FROM sales WHERE id = ?`,
-		id,
-	)
+	row := r.db.QueryRowContext(ctx, saleSelect+` WHERE s.id = ?`, id)
 
-	if err := row.Scan(
-		&s.ID,
-		&s.TotalAmount,
-		&s.PaidAmount,
-		&s.PaymentMethod,
-		&s.CreatedAt,
-	); err != nil {
+	if err := scanSale(row, &s); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, sql.ErrNoRows
 		}
@@ -217,7 +581,9 @@ func (r *SaleRepository) GetByID(ctx context.Context, id int64) (*models.Sale, e
 	}
 
 	itemsRows, err := r.db.QueryContext(ctx,
-		`SELECT si.id, si.sale_id, si.product_id, p.name, si.quantity, si.unit_price, si.line_total, si.created_at
+		`SELECT si.id, si.sale_id, si.product_id, p.name, si.quantity, si.list_price, si.unit_price,
+                si.discount_amount, si.tax_amount, si.line_total, si.unit_cost, COALESCE(si.returned_item_id, 0),
+                COALESCE(si.barcode, ''), si.weight, COALESCE(si.lot, ''), COALESCE(si.expiry_date, ''), si.created_at
          FROM sale_items si
          JOIN products p ON si.product_id = p.id
          WHERE si.sale_id = ?
@@ -237,8 +603,17 @@ func (r *SaleRepository) GetByID(ctx context.Context, id int64) (*models.Sale, e
 			&item.ProductID,
 			&item.ProductName,
 			&item.Quantity,
+			&item.ListPrice,
 			&item.UnitPrice,
+			&item.DiscountAmount,
+			&item.TaxAmount,
 			&item.LineTotal,
+			&item.UnitCost,
+			&item.ReturnedItemID,
+			&item.Barcode,
+			&item.Weight,
+			&item.Lot,
+			&item.ExpiryDate,
 			&item.CreatedAt,
 		); err != nil {
 			return nil, err
@@ -250,5 +625,51 @@ func (r *SaleRepository) GetByID(ctx context.Context, id int64) (*models.Sale, e
 		return nil, err
 	}
 
+	components, err := saleItemComponents(ctx, r.db, id)
+	if err != nil {
+		return nil, err
+	}
+	for i := range s.Items {
+		s.Items[i].Components = components[s.Items[i].ID]
+	}
+
+	tenderRows, err := r.db.QueryContext(ctx,
+		`SELECT id, sale_id, method, amount, tip_amount, COALESCE(tip_user_id, 0), tip_pool, created_at
+         FROM sale_tenders
+         WHERE sale_id = ?
+         ORDER BY id`,
+		id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer tenderRows.Close()
+
+	for tenderRows.Next() {
+		var t models.SaleTender
+		if err := tenderRows.Scan(
+			&t.ID,
+			&t.SaleID,
+			&t.Method,
+			&t.Amount,
+			&t.TipAmount,
+			&t.TipUserID,
+			&t.TipPool,
+			&t.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		s.Tenders = append(s.Tenders, t)
+	}
+
+	if err := tenderRows.Err(); err != nil {
+		return nil, err
+	}
+
 	return &s, nil
 }
+
+// escapeLike escapes LIKE wildcards so user input matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,457 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"pos-backend/internal/models"
+)
+
+const (
+	ShiftStatusOpen   = "open"
+	ShiftStatusClosed = "closed"
+
+	CashMovementPaidIn  = "paid_in"
+	CashMovementPaidOut = "paid_out"
+
+	paymentMethodCash  = "cash"
+	paymentMethodSplit = "split"
+)
+
+var (
+	ErrShiftAlreadyOpen = errors.New("terminal already has an open shift")
+	ErrShiftClosed      = errors.New("shift is closed")
+	ErrShiftNotClosed   = errors.New("shift is still open")
+)
+
+type ShiftRepository struct {
+	db *sql.DB
+}
+
+func NewShiftRepository(db *sql.DB) *ShiftRepository {
+	return &ShiftRepository{db: db}
+}
+
+type OpenShiftParams struct {
+	TerminalID   string
+	UserID       int64
+	OpeningFloat float64
+}
+
+type ShiftFilter struct {
+	TerminalID string
+	Status     string
+}
+
+type PaymentMethodTotal struct {
+	PaymentMethod string  `json:"payment_method"`
+	Count         int64   `json:"count"`
+	Total         float64 `json:"total"`
+	Tips          float64 `json:"tips"`
+}
+
+// ShiftReport is an X report while the shift is open and a Z report once
+// it has been closed and counted.
+type ShiftReport struct {
+	Type          string                `json:"type"` // "X" or "Z"
+	Shift         models.Shift          `json:"shift"`
+	SalesCount    int64                 `json:"sales_count"`
+	SalesTotal    float64               `json:"sales_total"`
+	Payments      []PaymentMethodTotal  `json:"payments"`
+	CashSales     float64               `json:"cash_sales"`
+	CashRounding  float64               `json:"cash_rounding"` // included in cash_sales
+	Tips          float64               `json:"tips"`          // all tenders, not revenue
+	CashTips      float64               `json:"cash_tips"`     // left in the drawer
+	LayawayTotal  float64               `json:"layaway_total"` // deposits and installments net of refunds
+	LayawayCash   float64               `json:"layaway_cash"`
+	PaidIn        float64               `json:"paid_in"`
+	PaidOut       float64               `json:"paid_out"`
+	ExpectedCash  float64               `json:"expected_cash"`
+	CountedCash   *float64              `json:"counted_cash,omitempty"`
+	Variance      *float64              `json:"variance,omitempty"`
+	CashMovements []models.CashMovement `json:"cash_movements"`
+	GeneratedAt   time.Time             `json:"generated_at"`
+}
+
+const shiftSelect = `SELECT sh.id, sh.terminal_id, sh.user_id, COALESCE(u.name, ''), sh.status, sh.opening_float,
+                sh.expected_cash, sh.counted_cash, sh.variance, sh.opened_at, sh.closed_at, sh.closed_by
+         FROM shifts sh
+         LEFT JOIN users u ON sh.user_id = u.id`
+
+func scanShift(row rowScanner, sh *models.Shift) error {
+	return row.Scan(
+		&sh.ID,
+		&sh.TerminalID,
+		&sh.UserID,
+		&sh.CashierName,
+		&sh.Status,
+		&sh.OpeningFloat,
+		&sh.ExpectedCash,
+		&sh.CountedCash,
+		&sh.Variance,
+		&sh.OpenedAt,
+		&sh.ClosedAt,
+		&sh.ClosedBy,
+	)
+}
+
+func (r *ShiftRepository) Open(ctx context.Context, params *OpenShiftParams) (*models.Shift, error) {
+	now := time.Now().UTC()
+
+	res, err := r.db.ExecContext(ctx,
+		`INSERT INTO shifts (terminal_id, user_id, status, opening_float, opened_at)
+         VALUES (?, ?, ?, ?, ?)`,
+		params.TerminalID, params.UserID, ShiftStatusOpen, params.OpeningFloat, now,
+	)
+	if err != nil {
+		// the partial unique index allows one open shift per terminal
+		if isUniqueViolation(err) {
+			return nil, ErrShiftAlreadyOpen
+		}
+		return nil, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetByID(ctx, id)
+}
+
+func (r *ShiftRepository) GetAll(ctx context.Context, filter ShiftFilter) ([]models.Shift, error) {
+	var conds []string
+	var args []any
+	if filter.TerminalID != "" {
+		conds = append(conds, `sh.terminal_id = ?`)
+		args = append(args, filter.TerminalID)
+	}
+	if filter.Status != "" {
+		conds = append(conds, `sh.status = ?`)
+		args = append(args, filter.Status)
+	}
+
+	query := shiftSelect
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	query += ` ORDER BY sh.id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var shifts []models.Shift
+	for rows.Next() {
+		var sh models.Shift
+		if err := scanShift(rows, &sh); err != nil {
+			return nil, err
+		}
+		shifts = append(shifts, sh)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return shifts, nil
+}
+
+func (r *ShiftRepository) GetByID(ctx context.Context, id int64) (*models.Shift, error) {
+	return getShift(ctx, r.db, id)
+}
+
+// GetCurrent returns the open shift on a terminal, or sql.ErrNoRows.
+func (r *ShiftRepository) GetCurrent(ctx context.Context, terminalID string) (*models.Shift, error) {
+	var sh models.Shift
+	row := r.db.QueryRowContext(ctx,
+		shiftSelect+` WHERE sh.terminal_id = ? AND sh.status = ?`,
+		terminalID, ShiftStatusOpen,
+	)
+	if err := scanShift(row, &sh); err != nil {
+		return nil, err
+	}
+	return &sh, nil
+}
+
+func (r *ShiftRepository) AddCashMovement(ctx context.Context, m *models.CashMovement) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	sh, err := getShift(ctx, tx, m.ShiftID)
+	if err != nil {
+		return err
+	}
+	if sh.Status != ShiftStatusOpen {
+		err = ErrShiftClosed
+		return err
+	}
+
+	m.CreatedAt = time.Now().UTC()
+
+	res, err := tx.ExecContext(ctx,
+		`INSERT INTO cash_movements (shift_id, kind, amount, reason, user_id, created_at)
+         VALUES (?, ?, ?, ?, ?, ?)`,
+		m.ShiftID, m.Kind, m.Amount, m.Reason, m.UserID, m.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+
+	m.ID, err = res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Close records the counted cash, freezes the expected amount and variance
+// and returns the resulting Z report.
+func (r *ShiftRepository) Close(ctx context.Context, id int64, countedCash float64, closedBy int64) (*ShiftReport, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	sh, err := getShift(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sh.Status != ShiftStatusOpen {
+		err = ErrShiftClosed
+		return nil, err
+	}
+
+	report, err := buildShiftReport(ctx, tx, sh)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	variance := roundMoney(countedCash - report.ExpectedCash)
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE shifts
+         SET status = ?, expected_cash = ?, counted_cash = ?, variance = ?, closed_at = ?, closed_by = ?
+         WHERE id = ?`,
+		ShiftStatusClosed, report.ExpectedCash, countedCash, variance, now, closedBy, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	sh.Status = ShiftStatusClosed
+	sh.ExpectedCash = &report.ExpectedCash
+	sh.CountedCash = &countedCash
+	sh.Variance = &variance
+	sh.ClosedAt = &now
+	sh.ClosedBy = &closedBy
+
+	report.Type = "Z"
+	report.Shift = *sh
+	report.CountedCash = &countedCash
+	report.Variance = &variance
+
+	return report, nil
+}
+
+// XReport is a mid-shift snapshot. It does not change the shift.
+func (r *ShiftRepository) XReport(ctx context.Context, id int64) (*ShiftReport, error) {
+	sh, err := getShift(ctx, r.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if sh.Status != ShiftStatusOpen {
+		return nil, ErrShiftClosed
+	}
+
+	report, err := buildShiftReport(ctx, r.db, sh)
+	if err != nil {
+		return nil, err
+	}
+	report.Type = "X"
+
+	return report, nil
+}
+
+// ZReport reproduces the closing report of a closed shift.
+func (r *ShiftRepository) ZReport(ctx context.Context, id int64) (*ShiftReport, error) {
+	sh, err := getShift(ctx, r.db, id)
+	if err != nil {
+		return nil, err
+	}
+	if sh.Status != ShiftStatusClosed {
+		return nil, ErrShiftNotClosed
+	}
+
+	report, err := buildShiftReport(ctx, r.db, sh)
+	if err != nil {
+		return nil, err
+	}
+	report.Type = "Z"
+	report.CountedCash = sh.CountedCash
+	report.Variance = sh.Variance
+	if sh.ExpectedCash != nil {
+		report.ExpectedCash = *sh.ExpectedCash
+	}
+
+	return report, nil
+}
+
+func getShift(ctx context.Context, q dbtx, id int64) (*models.Shift, error) {
+	var sh models.Shift
+	row := q.QueryRowContext(ctx, shiftSelect+` WHERE sh.id = ?`, id)
+	if err := scanShift(row, &sh); err != nil {
+		return nil, err
+	}
+	return &sh, nil
+}
+
+// openShiftID returns the open shift on a terminal, or 0 if there is none.
+func openShiftID(ctx context.Context, q dbtx, terminalID string) (int64, error) {
+	if terminalID == "" {
+		return 0, nil
+	}
+
+	var id int64
+	err := q.QueryRowContext(ctx,
+		`SELECT id FROM shifts WHERE terminal_id = ? AND status = ?`,
+		terminalID, ShiftStatusOpen,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return id, err
+}
+
+func buildShiftReport(ctx context.Context, q dbtx, sh *models.Shift) (*ShiftReport, error) {
+	report := &ShiftReport{
+		Shift:       *sh,
+		Payments:    []PaymentMethodTotal{},
+		GeneratedAt: time.Now().UTC(),
+	}
+
+	err := q.QueryRowContext(ctx,
+		`SELECT COUNT(*), COALESCE(SUM(total_amount), 0), COALESCE(SUM(rounding_amount), 0)
+         FROM sales
+         WHERE shift_id = ?`,
+		sh.ID,
+	).Scan(&report.SalesCount, &report.SalesTotal, &report.CashRounding)
+	if err != nil {
+		return nil, err
+	}
+
+	// payments are broken down per tender so split sales land in the right
+	// bucket; rounding only ever occurs on sales with a cash tender
+	rows, err := q.QueryContext(ctx,
+		`SELECT t.method, COUNT(*), COALESCE(SUM(t.amount), 0), COALESCE(SUM(t.tip_amount), 0)
+         FROM sale_tenders t
+         JOIN sales s ON t.sale_id = s.id
+         WHERE s.shift_id = ?
+         GROUP BY t.method
+         ORDER BY t.method`,
+		sh.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pt PaymentMethodTotal
+		if err := rows.Scan(&pt.PaymentMethod, &pt.Count, &pt.Total, &pt.Tips); err != nil {
+			return nil, err
+		}
+		report.Payments = append(report.Payments, pt)
+		report.Tips += pt.Tips
+		if pt.PaymentMethod == paymentMethodCash {
+			report.CashSales += pt.Total
+			report.CashTips += pt.Tips
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	err = q.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(amount), 0), COALESCE(SUM(CASE WHEN method = ? THEN amount ELSE 0 END), 0)
+         FROM layaway_payments
+         WHERE shift_id = ?`,
+		paymentMethodCash, sh.ID,
+	).Scan(&report.LayawayTotal, &report.LayawayCash)
+	if err != nil {
+		return nil, err
+	}
+
+	movements, err := q.QueryContext(ctx,
+		`SELECT id, shift_id, kind, amount, reason, user_id, created_at
+         FROM cash_movements
+         WHERE shift_id = ?
+         ORDER BY id`,
+		sh.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer movements.Close()
+
+	report.CashMovements = []models.CashMovement{}
+	for movements.Next() {
+		var m models.CashMovement
+		if err := movements.Scan(&m.ID, &m.ShiftID, &m.Kind, &m.Amount, &m.Reason, &m.UserID, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		report.CashMovements = append(report.CashMovements, m)
+		switch m.Kind {
+		case CashMovementPaidIn:
+			report.PaidIn += m.Amount
+		case CashMovementPaidOut:
+			report.PaidOut += m.Amount
+		}
+	}
+
+	if err := movements.Err(); err != nil {
+		return nil, err
+	}
+
+	report.SalesTotal = roundMoney(report.SalesTotal)
+	report.CashSales = roundMoney(report.CashSales)
+	report.CashRounding = roundMoney(report.CashRounding)
+	report.Tips = roundMoney(report.Tips)
+	report.CashTips = roundMoney(report.CashTips)
+	report.LayawayTotal = roundMoney(report.LayawayTotal)
+	report.LayawayCash = roundMoney(report.LayawayCash)
+	report.PaidIn = roundMoney(report.PaidIn)
+	report.PaidOut = roundMoney(report.PaidOut)
+
+	// cash tender amounts already exclude change handed back, and cash tips
+	// stay in the drawer until paid out; completed layaways are settled by
+	// their earlier payments, not by the "layaway" tender on the sale
+	report.ExpectedCash = roundMoney(sh.OpeningFloat + report.CashSales + report.CashTips + report.LayawayCash +
+		report.PaidIn - report.PaidOut)
+
+	return report, nil
+}
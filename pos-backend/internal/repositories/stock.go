@@ -0,0 +1,80 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"time"
+)
+
+// dbtx is satisfied by both *sql.DB and *sql.Tx so helpers can run inside
+// or outside a transaction.
+type dbtx interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+const reservationSourceParkedSale = "parked_sale"
+
+// Quantities may be fractional (0.372 kg). Stock arithmetic is rounded to
+// six decimals, finer than any unit's precision, so repeated sales of
+// fractions do not leave float dust behind.
+const quantityScale = 6
+
+func roundQuantity(q float64) float64 {
+	return math.Round(q*1e6) / 1e6
+}
+
+// reservedStock returns the quantity of a product held by active soft
+// reservations. Expired reservations are ignored even if not yet purged, and
+// so is the hold of parkedSaleID, a resumed cart being rung up (0 = none).
+func reservedStock(ctx context.Context, q dbtx, productID, parkedSaleID int64, now time.Time) (float64, error) {
+	var reserved float64
+	err := q.QueryRowContext(ctx,
+		`SELECT COALESCE(SUM(quantity), 0)
+         FROM stock_reservations
+         WHERE product_id = ? AND (expires_at IS NULL OR expires_at > ?)
+           AND NOT (source = ? AND source_id = ?)`,
+		productID, now, reservationSourceParkedSale, parkedSaleID,
+	).Scan(&reserved)
+	return roundQuantity(reserved), err
+}
+
+// deductStock takes quantity off a product's shelf count. The stock check
+// is part of the UPDATE itself, so two tills can never both sell the last
+// unit: unless negative stock is allowed, the row only changes while
+// enough unreserved stock is left. Negative quantities put stock back and
+// always apply. Stock is part of a product edit, so the version moves too.
+func deductStock(ctx context.Context, q dbtx, productID int64, quantity float64, allowNegative bool, now time.Time) error {
+	res, err := q.ExecContext(ctx,
+		`UPDATE products SET stock = ROUND(stock - ?, ?), version = version + 1
+         WHERE id = ?
+           AND (? <= 0
+                OR COALESCE(allow_negative_stock, ?) = 1
+                OR ROUND(stock - ?, ?) >= (SELECT ROUND(COALESCE(SUM(r.quantity), 0), ?)
+                                           FROM stock_reservations r
+                                           WHERE r.product_id = products.id AND (r.expires_at IS NULL OR r.expires_at > ?)))`,
+		quantity, quantityScale, productID, quantity, allowNegative, quantity, quantityScale, quantityScale, now,
+	)
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+func releaseReservations(ctx context.Context, q dbtx, source string, sourceID int64) error {
+	_, err := q.ExecContext(ctx,
+		`DELETE FROM stock_reservations WHERE source = ? AND source_id = ?`,
+		source, sourceID,
+	)
+	return err
+}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"pos-backend/internal/models"
+)
+
+// UnitPieces is the unit products are counted in unless told otherwise.
+const UnitPieces = "pcs"
+
+// maxUnitDecimals keeps unit precision within what stock arithmetic
+// rounds to.
+const maxUnitDecimals = 4
+
+// weightUnits gives, for units that measure weight, how many of the unit
+// make a kilogram. Scale labels carry kilograms.
+var weightUnits = map[string]float64{
+	"kg": 1,
+	"g":  1000,
+}
+
+var (
+	ErrUnitNotFound     = errors.New("unit not found")
+	ErrUnitExists       = errors.New("a unit with this code already exists")
+	ErrInvalidUnit      = errors.New("invalid unit")
+	ErrInvalidQuantity  = errors.New("quantity does not fit the unit's precision")
+	ErrProductUnitTaken = errors.New("the product already has a unit with this name")
+)
+
+type UnitRepository struct {
+	db *sql.DB
+}
+
+func NewUnitRepository(db *sql.DB) *UnitRepository {
+	return &UnitRepository{db: db}
+}
+
+func (r *UnitRepository) GetAll(ctx context.Context) ([]models.Unit, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT code, name, decimals FROM units ORDER BY code`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var units []models.Unit
+	for rows.Next() {
+		var u models.Unit
+		if err := rows.Scan(&u.Code, &u.Name, &u.Decimals); err != nil {
+			return nil, err
+		}
+		units = append(units, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return units, nil
+}
+
+func (r *UnitRepository) Create(ctx context.Context, u *models.Unit) error {
+	u.Code = strings.ToLower(strings.TrimSpace(u.Code))
+	u.Name = strings.TrimSpace(u.Name)
+	if u.Code == "" || u.Name == "" {
+		return fmt.Errorf("%w: code and name are required", ErrInvalidUnit)
+	}
+	if u.Decimals < 0 || u.Decimals > maxUnitDecimals {
+		return fmt.Errorf("%w: decimals must be between 0 and %d", ErrInvalidUnit, maxUnitDecimals)
+	}
+
+	_, err := r.db.ExecContext(ctx,
+		`INSERT INTO units (code, name, decimals) VALUES (?, ?, ?)`,
+		u.Code, u.Name, u.Decimals,
+	)
+	if isUniqueViolation(err) {
+		return ErrUnitExists
+	}
+	return err
+}
+
+// fitsPrecision reports whether q has no more than decimals decimal places.
+func fitsPrecision(q float64, decimals int) bool {
+	scaled := q * math.Pow10(decimals)
+	return math.Abs(scaled-math.Round(scaled)) < 1e-6
+}
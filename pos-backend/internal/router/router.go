@@ -15,6 +15,11 @@ func NewRouter(
 	authHandler *handlers.AuthHandler,
 	userHandler *handlers.UserHandler,
 	reportHandler *handlers.ReportHandler,
+	parkedSaleHandler *handlers.ParkedSaleHandler,
+	shiftHandler *handlers.ShiftHandler,
+	layawayHandler *handlers.LayawayHandler,
+	categoryHandler *handlers.CategoryHandler,
+	unitHandler *handlers.UnitHandler,
 ) http.Handler {
 	r := chi.NewRouter()
 
@@ -33,6 +38,11 @@ func NewRouter(
 		authHandler.RegisterRoutes(api)
 		userHandler.RegisterRoutes(api)
 		reportHandler.RegisterRoutes(api)
+		parkedSaleHandler.RegisterRoutes(api)
+		shiftHandler.RegisterRoutes(api)
+		layawayHandler.RegisterRoutes(api)
+		categoryHandler.RegisterRoutes(api)
+		unitHandler.RegisterRoutes(api)
 	})
 
 	return r
@@ -41,8 +51,9 @@ func NewRouter(
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+		w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
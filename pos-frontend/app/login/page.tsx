@@ -1,7 +1,7 @@
 // app/login/page.tsx
 "use client";
 
-import { FormEvent, useState } from "react";
+import { FormEvent, useEffect, useState } from "react";
 import { useRouter } from "next/navigation";
 import { useAuth } from "@/components/AuthContext";
 
@@ -10,16 +10,22 @@ export default function LoginPage() {
   const router = useRouter();
   const [email, setEmail] = useState("admin@example.com");
   const [password, setPassword] = useState("secret123");
+  const [terminalId, setTerminalId] = useState("");
   const [loading, setLoading] = useState(false);
   const [error, setError] = useState<string | null>(null);
 
+  // a till remembers its own id between sign-ins
+  useEffect(() => {
+    setTerminalId(window.localStorage.getItem("terminalId") ?? "");
+  }, []);
+
   const handleSubmit = async (e: FormEvent) => {
     e.preventDefault();
     setError(null);
     setLoading(true);
 
     try {
-      await login(email, password);
+      await login(email, password, terminalId);
       router.push("/");
     } catch (err: any) {
       setError(err?.message ?? "Failed to login");
@@ -54,6 +60,16 @@ export default function LoginPage() {
             required
           />
         </div>
+        <div>
+          <label className="mb-1 block text-sm font-medium">Terminal</label>
+          <input
+            type="text"
+            className="w-full rounded border px-3 py-2 text-sm"
+            value={terminalId}
+            onChange={(e) => setTerminalId(e.target.value)}
+            placeholder="e.g. T1 — leave empty for back office"
+          />
+        </div>
         {error && <p className="text-sm text-red-600">{error}</p>}
         <button
           type="submit"
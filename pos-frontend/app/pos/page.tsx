@@ -4,11 +4,29 @@ import { useEffect, useMemo, useState } from "react";
 import { useRouter } from "next/navigation";
 import { ProtectedPage } from "@/components/ProtectedPage";
 import { apiFetch } from "@/lib/api";
-import type { Product, Sale } from "@/lib/types";
+import type { BarcodeLookup, Product, ProductPage, Sale } from "@/lib/types";
 
 type CartItem = {
+  key: string; // product id, or the barcode for scale-label lines
   product: Product;
   quantity: number;
+  barcode?: string; // scale labels are sold by barcode at the printed price
+  scans?: number; // barcode lines: times the code was scanned
+  weighed?: boolean; // quantity is the weight on the label
+  unitPrice?: number;
+};
+
+// Goods counted in these units take the weight on their scale label as
+// the quantity; value is units per kilogram.
+const WEIGHT_UNITS: Record<string, number> = { kg: 1, g: 1000 };
+
+// Smallest quantity step a product's unit allows, e.g. 0.001 for kg
+const quantityStep = (product: Product) =>
+  Math.pow(10, -(product.quantity_decimals ?? 0));
+
+const roundQuantity = (product: Product, quantity: number) => {
+  const scale = Math.pow(10, product.quantity_decimals ?? 0);
+  return Math.round(quantity * scale) / scale;
 };
 
 export default function POSPage() {
@@ -27,76 +45,133 @@ export default function POSPage() {
   const [checkoutError, setCheckoutError] = useState<string | null>(null);
   const [checkoutSuccess, setCheckoutSuccess] = useState<string | null>(null);
 
-  // Load products from backend
-  useEffect(() => {
+  // Search is done by the backend so large catalogs stay fast. A newer
+  // search aborts the one in flight, so a slow response for an older
+  // query can never replace the results of the latest one.
+  const loadProducts = (q: string, signal: AbortSignal) => {
     setLoadingProducts(true);
     setProductsError(null);
 
-    apiFetch<Product[]>("/api/products")
+    // only sellable items: variants rather than the products they belong to
+    const params = new URLSearchParams({ limit: "50", level: "variant" });
+    if (q.trim()) params.set("q", q.trim());
+
+    apiFetch<ProductPage>(`/api/products?${params.toString()}`, { signal })
       .then((data) => {
-        setProducts(data ?? []);
+        setProducts(data?.items ?? []);
       })
       .catch((err: any) => {
+        if (signal.aborted) return;
         setProductsError(err?.message ?? "Failed to load products");
         setProducts([]);
       })
       .finally(() => {
-        setLoadingProducts(false);
+        if (!signal.aborted) setLoadingProducts(false);
       });
-  }, []);
+  };
+
+  // Load products from backend, debounced while typing
+  useEffect(() => {
+    const controller = new AbortController();
+    const timer = setTimeout(() => loadProducts(search, controller.signal), 250);
+    return () => {
+      clearTimeout(timer);
+      controller.abort();
+    };
+  }, [search]);
 
   const productList = products ?? [];
   const cartList = cart ?? [];
 
-  // Filter products by search
-  const filteredProducts = useMemo(() => {
-    const q = search.trim().toLowerCase();
-    if (!q) return productList;
-
-    return productList.filter(
-      (p) =>
-        p.name.toLowerCase().includes(q) ||
-        p.sku.toLowerCase().includes(q) ||
-        String(p.id).includes(q)
-    );
-  }, [productList, search]);
-
   // Cart helpers
-  const addToCart = (product: Product) => {
+  const addToCart = (product: Product, units = 1) => {
     setCart((prev) => {
       const current = prev ?? [];
-      const existing = current.find((ci) => ci.product.id === product.id);
+      const key = `p${product.id}`;
+      const existing = current.find((ci) => ci.key === key);
       if (!existing) {
         if (product.stock <= 0) return current;
-        return [...current, { product, quantity: 1 }];
+        return [
+          ...current,
+          { key, product, quantity: Math.min(units, product.stock) },
+        ];
       }
 
-      const newQty = Math.min(existing.quantity + 1, product.stock);
+      const newQty = Math.min(existing.quantity + units, product.stock);
       return current.map((ci) =>
-        ci.product.id === product.id ? { ...ci, quantity: newQty } : ci
+        ci.key === key ? { ...ci, quantity: newQty } : ci
       );
     });
   };
 
-  const updateCartQuantity = (productId: number, quantity: number) => {
+  // Each scale label or GS1 code is its own line, priced from the code
+  const addLabelToCart = (found: BarcodeLookup) => {
+    const perKg = WEIGHT_UNITS[found.product.unit];
+    const byWeight = found.weight != null && perKg != null;
+    // goods stocked by weight sell the label weight at the unit price, or
+    // at the label price spread over that weight when one is printed
+    const perScan = byWeight
+      ? roundQuantity(found.product, found.weight! * perKg)
+      : 1;
+    // a scale label prices a per-kg product by its weight; a GS1 weight on
+    // anything else only describes the pack
+    const labelWeight = found.rule ? found.weight ?? 1 : 1;
+    const unitPrice = byWeight
+      ? found.price != null && perScan > 0
+        ? found.price / perScan
+        : found.product.price
+      : found.price ?? Math.round(found.product.price * labelWeight * 100) / 100;
+    setCart((prev) => {
+      const current = prev ?? [];
+      if (current.some((ci) => ci.key === found.code)) {
+        // the same scale label twice is a double scan; the same GS1 lot
+        // is another unit
+        if (found.rule) return current;
+        return current.map((ci) =>
+          ci.key === found.code
+            ? {
+                ...ci,
+                quantity: roundQuantity(found.product, ci.quantity + perScan),
+                scans: (ci.scans ?? 1) + 1,
+              }
+            : ci
+        );
+      }
+      return [
+        ...current,
+        {
+          key: found.code,
+          product: found.product,
+          quantity: perScan,
+          barcode: found.code,
+          scans: 1,
+          weighed: byWeight,
+          unitPrice,
+        },
+      ];
+    });
+  };
+
+  const updateCartQuantity = (key: string, quantity: number) => {
     setCart((prev) => {
       const current = prev ?? [];
       const updated = current
         .map((ci) => {
-          if (ci.product.id !== productId) return ci;
+          if (ci.key !== key) return ci;
           const maxQty = ci.product.stock;
-          const q = Math.max(1, Math.min(quantity, maxQty));
-          return { ...ci, quantity: q };
+          const step = quantityStep(ci.product);
+          const q = Math.max(step, Math.min(roundQuantity(ci.product, quantity), maxQty));
+          return ci.barcode ? { ...ci, quantity: q, scans: q } : { ...ci, quantity: q };
         })
         .filter((ci) => ci.quantity > 0);
       return updated;
     });
   };
 
-  const removeFromCart = (productId: number) => {
+  const removeFromCart = (key: string) => {
     setCart((prev) => {
       const current = prev ?? [];
-      return current.filter((ci) => ci.product.id !== productId);
+      return current.filter((ci) => ci.key !== key);
     });
   };
 
@@ -105,11 +180,45 @@ export default function POSPage() {
     setPaidAmount(""); // clear paid amount manually
   };
 
+  // Scanners type the code and press Enter; a case-pack barcode adds
+  // its pack quantity
+  const handleScan = async (code: string) => {
+    if (!code.trim()) return;
+    try {
+      const found = await apiFetch<BarcodeLookup>(
+        `/api/products/by-barcode/${encodeURIComponent(code.trim())}`
+      );
+      if (found.product.archived_at) {
+        setCheckoutError(`${found.product.name} is archived and no longer sold.`);
+        setSearch("");
+        return;
+      }
+      if (found.expired) {
+        setCheckoutError(
+          `${found.product.name} expired on ${found.expiry_date} and cannot be sold.`
+        );
+        setSearch("");
+        return;
+      }
+      // labels and GS1 codes are sold by code so the lot, weight or
+      // printed price travel with the line
+      if (found.rule || found.lot || found.expiry_date || found.weight || found.price) {
+        addLabelToCart(found);
+      } else {
+        addToCart(found.product, found.pack_quantity);
+      }
+      setSearch("");
+    } catch {
+      // not a barcode; leave the text as a search
+    }
+  };
+
   // Totals
   const cartSubtotal = useMemo(
     () =>
       cartList.reduce(
-        (sum, item) => sum + item.product.price * item.quantity,
+        (sum, item) =>
+          sum + (item.unitPrice ?? item.product.price) * item.quantity,
         0
       ),
     [cartList]
@@ -141,10 +250,11 @@ export default function POSPage() {
     setSubmitting(true);
     try {
       const payload = {
-        items: cartList.map((ci) => ({
-          product_id: ci.product.id,
-          quantity: ci.quantity,
-        })),
+        items: cartList.map((ci) =>
+          ci.barcode
+            ? { barcode: ci.barcode, quantity: ci.scans ?? 1 }
+            : { product_id: ci.product.id, quantity: ci.quantity }
+        ),
         payment_method: paymentMethod,
         paid_amount: paidNumber,
       };
@@ -161,19 +271,8 @@ export default function POSPage() {
       );
       clearCart();
 
-      // Refresh products
-      setLoadingProducts(true);
-      apiFetch<Product[]>("/api/products")
-        .then((data) => {
-          setProducts(data ?? []);
-        })
-        .catch((err: any) => {
-          setProductsError(err?.message ?? "Failed to refresh products");
-          setProducts([]);
-        })
-        .finally(() => {
-          setLoadingProducts(false);
-        });
+      // Refresh products; nothing aborts this load, the page is leaving
+      loadProducts(search, new AbortController().signal);
 
       router.push(`/sales/${sale.id}`);
     } catch (err: any) {
@@ -193,10 +292,13 @@ export default function POSPage() {
           <div className="mb-3">
             <input
               type="text"
-              placeholder="Search by name, SKU or ID..."
+              placeholder="Search by name or SKU, or scan a barcode..."
               className="w-full rounded border px-3 py-2 text-sm"
               value={search}
               onChange={(e) => setSearch(e.target.value)}
+              onKeyDown={(e) => {
+                if (e.key === "Enter") handleScan(search);
+              }}
             />
           </div>
 
@@ -220,7 +322,7 @@ export default function POSPage() {
                   </tr>
                 </thead>
                 <tbody>
-                  {filteredProducts.length === 0 && (
+                  {productList.length === 0 && (
                     <tr>
                       <td
                         colSpan={5}
@@ -230,7 +332,7 @@ export default function POSPage() {
                       </td>
                     </tr>
                   )}
-                  {filteredProducts.map((p) => (
+                  {productList.map((p) => (
                     <tr key={p.id} className="border-t">
                       <td className="px-2 py-2">{p.name}</td>
                       <td className="px-2 py-2">{p.sku}</td>
@@ -277,7 +379,7 @@ export default function POSPage() {
                 </thead>
                 <tbody>
                   {cartList.map((ci) => (
-                    <tr key={ci.product.id} className="border-t">
+                    <tr key={ci.key} className="border-t">
                       <td className="px-2 py-2">
                         <div className="text-sm font-medium">{ci.product.name}</div>
                         <div className="text-xs text-gray-600">SKU: {ci.product.sku}</div>
@@ -285,23 +387,29 @@ export default function POSPage() {
                       <td className="px-2 py-2 text-right">
                         <input
                           type="number"
-                          min={1}
+                          min={quantityStep(ci.product)}
+                          step={quantityStep(ci.product)}
                           max={ci.product.stock}
+                          readOnly={ci.weighed}
                           value={ci.quantity}
                           onChange={(e) =>
-                            updateCartQuantity(ci.product.id, Number(e.target.value))
+                            updateCartQuantity(ci.key, Number(e.target.value))
                           }
                           className="w-16 rounded border px-2 py-1 text-sm"
                         />
                         <div className="mt-1 text-xs text-gray-500">
-                          Stock: {ci.product.stock}
+                          Stock: {ci.product.stock} {ci.product.unit}
                         </div>
                       </td>
-                      <td className="px-2 py-2 text-right">{ci.product.price.toFixed(2)}</td>
-                      <td className="px-2 py-2 text-right">{(ci.product.price * ci.quantity).toFixed(2)}</td>
+                      <td className="px-2 py-2 text-right">
+                        {(ci.unitPrice ?? ci.product.price).toFixed(2)}
+                      </td>
+                      <td className="px-2 py-2 text-right">
+                        {((ci.unitPrice ?? ci.product.price) * ci.quantity).toFixed(2)}
+                      </td>
                       <td className="px-2 py-2 text-right">
                         <button
-                          onClick={() => removeFromCart(ci.product.id)}
+                          onClick={() => removeFromCart(ci.key)}
                           className="rounded bg-red-500 px-2 py-1 text-xs font-medium text-white hover:bg-red-600"
                         >
                           X
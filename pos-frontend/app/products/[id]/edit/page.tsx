@@ -45,10 +45,14 @@ export default function EditProductPage() {
     name: string;
     sku: string;
     price: number;
+    cost: number | null;
     stock: number;
   }) => {
+    // only the form's fields change; If-Match refuses the edit (412) when
+    // someone else saved the product after it was loaded here
     await apiFetch(`/api/products/${id}`, {
-      method: "PUT",
+      method: "PATCH",
+      headers: product ? { "If-Match": `"${product.version}"` } : {},
       body: JSON.stringify(data),
     });
     router.push("/products");
@@ -13,6 +13,7 @@ export default function NewProductPage() {
     name: string;
     sku: string;
     price: number;
+    cost: number | null;
     stock: number;
   }) => {
     await apiFetch("/api/products", {
@@ -5,7 +5,7 @@ import Link from "next/link";
 import { useEffect, useState } from "react";
 import { ProtectedPage } from "@/components/ProtectedPage";
 import { apiFetch } from "@/lib/api";
-import type { Product } from "@/lib/types";
+import type { Product, ProductPage } from "@/lib/types";
 
 export default function ProductsPage() {
   // Allow products to be null initially / on error, and handle it safely
@@ -13,14 +13,25 @@ export default function ProductsPage() {
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
   const [actionMessage, setActionMessage] = useState<string | null>(null);
+  const [nextCursor, setNextCursor] = useState<string | null>(null);
 
-  const loadProducts = () => {
+  const loadProducts = (cursor?: string) => {
     setLoading(true);
     setError(null);
 
-    apiFetch<Product[]>("/api/products")
+    // the back office sees archived products too, marked as such
+    const params = new URLSearchParams({
+      sort: "name",
+      limit: "100",
+      status: "all",
+    });
+    if (cursor) params.set("cursor", cursor);
+
+    apiFetch<ProductPage>(`/api/products?${params.toString()}`)
       .then((data) => {
-        setProducts(data);
+        const items = data?.items ?? [];
+        setProducts((prev) => (cursor ? [...(prev ?? []), ...items] : items));
+        setNextCursor(data?.next_cursor ?? null);
       })
       .catch((err: any) => {
         setError(err?.message ?? "Failed to load products");
@@ -53,6 +64,18 @@ export default function ProductsPage() {
     }
   };
 
+  // Archived products leave the POS but keep their sales history
+  const handleArchive = async (p: Product) => {
+    const action = p.archived_at ? "unarchive" : "archive";
+    try {
+      await apiFetch(`/api/products/${p.id}/${action}`, { method: "POST" });
+      setActionMessage(`Product #${p.id} ${action}d.`);
+      loadProducts();
+    } catch (err: any) {
+      setError(err?.message ?? `Failed to ${action} product`);
+    }
+  };
+
   // Safely derive whether we have any products
   const productList = products ?? [];
   const hasProducts = productList.length > 0;
@@ -73,10 +96,9 @@ export default function ProductsPage() {
         {actionMessage && (
           <p className="text-sm text-gray-700">{actionMessage}</p>
         )}
-        {loading && <p className="text-gray-600">Loading products...</p>}
         {error && <p className="text-sm text-red-600">{error}</p>}
 
-        {!loading && !error && (
+        {products !== null && !error && (
           <div className="overflow-x-auto rounded border bg-white">
             <table className="min-w-full text-sm">
               <thead className="bg-gray-100">
@@ -103,7 +125,14 @@ export default function ProductsPage() {
                 {productList.map((p) => (
                   <tr key={p.id} className="border-t">
                     <td className="px-3 py-2">{p.id}</td>
-                    <td className="px-3 py-2">{p.name}</td>
+                    <td className="px-3 py-2">
+                      {p.name}
+                      {p.archived_at && (
+                        <span className="ml-2 rounded bg-gray-200 px-1.5 py-0.5 text-xs text-gray-600">
+                          Archived
+                        </span>
+                      )}
+                    </td>
                     <td className="px-3 py-2">{p.sku}</td>
                     <td className="px-3 py-2 text-right">
                       {p.price.toFixed(2)}
@@ -117,6 +146,12 @@ export default function ProductsPage() {
                         >
                           Edit
                         </Link>
+                        <button
+                          onClick={() => handleArchive(p)}
+                          className="rounded bg-gray-100 px-2 py-1 text-xs font-medium text-gray-800 hover:bg-gray-200"
+                        >
+                          {p.archived_at ? "Unarchive" : "Archive"}
+                        </button>
                         <button
                           onClick={() => handleDelete(p.id)}
                           className="rounded bg-red-500 px-2 py-1 text-xs font-medium text-white hover:bg-red-600"
@@ -131,6 +166,17 @@ export default function ProductsPage() {
             </table>
           </div>
         )}
+
+        {loading && <p className="text-gray-600">Loading products...</p>}
+
+        {!loading && nextCursor && (
+          <button
+            onClick={() => loadProducts(nextCursor)}
+            className="rounded border bg-white px-3 py-1 text-sm hover:bg-gray-50"
+          >
+            Load more
+          </button>
+        )}
       </div>
     </ProtectedPage>
   );
@@ -4,30 +4,126 @@ import { useEffect, useState } from "react";
 import Link from "next/link";
 import { ProtectedPage } from "@/components/ProtectedPage";
 import { apiFetch } from "@/lib/api";
-import type { Sale } from "@/lib/types";
+import type { Sale, SalePage } from "@/lib/types";
+
+const PAGE_SIZE = 50;
 
 export default function SalesListPage() {
   const [sales, setSales] = useState<Sale[]>([]);
+  const [nextCursor, setNextCursor] = useState<string | null>(null);
+  const [totalCount, setTotalCount] = useState(0);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
 
-  useEffect(() => {
-    apiFetch<Sale[]>("/api/sales")
+  // Filters
+  const [from, setFrom] = useState("");
+  const [to, setTo] = useState("");
+  const [paymentMethod, setPaymentMethod] = useState("");
+  const [receiptNumber, setReceiptNumber] = useState("");
+  const [sort, setSort] = useState("-created_at");
+
+  const buildQuery = (cursor?: string) => {
+    const params = new URLSearchParams({ limit: String(PAGE_SIZE), sort });
+    if (from) params.set("from", from);
+    if (to) params.set("to", to);
+    if (paymentMethod) params.set("payment_method", paymentMethod);
+    if (receiptNumber.trim()) params.set("receipt_number", receiptNumber.trim());
+    if (cursor) params.set("cursor", cursor);
+    return `/api/sales?${params.toString()}`;
+  };
+
+  const loadPage = (cursor?: string) => {
+    setLoading(true);
+    setError(null);
+
+    apiFetch<SalePage>(buildQuery(cursor))
       .then((data) => {
-        setSales(data || []);
+        const items = data?.items || [];
+        setSales((prev) => (cursor ? [...prev, ...items] : items));
+        setNextCursor(data?.next_cursor || null);
+        setTotalCount(data?.total_count ?? 0);
       })
       .catch((err) => {
         setError(err?.message || "Failed to load sales");
       })
       .finally(() => setLoading(false));
-  }, []);
+  };
+
+  // Reload from the first page whenever a filter changes
+  useEffect(() => {
+    loadPage();
+    // eslint-disable-next-line react-hooks/exhaustive-deps
+  }, [from, to, paymentMethod, receiptNumber, sort]);
 
   return (
     <ProtectedPage>
       <div className="space-y-4">
         <h1 className="text-xl font-bold">Sales</h1>
 
-        {loading && <p>Loading...</p>}
+        <div className="flex flex-wrap items-end gap-3 rounded border bg-white p-3 text-sm">
+          <div>
+            <label className="mb-1 block font-medium">From</label>
+            <input
+              type="date"
+              value={from}
+              onChange={(e) => setFrom(e.target.value)}
+              className="rounded border px-2 py-1"
+            />
+          </div>
+
+          <div>
+            <label className="mb-1 block font-medium">To</label>
+            <input
+              type="date"
+              value={to}
+              onChange={(e) => setTo(e.target.value)}
+              className="rounded border px-2 py-1"
+            />
+          </div>
+
+          <div>
+            <label className="mb-1 block font-medium">Payment</label>
+            <select
+              value={paymentMethod}
+              onChange={(e) => setPaymentMethod(e.target.value)}
+              className="rounded border px-2 py-1"
+            >
+              <option value="">All</option>
+              <option value="cash">Cash</option>
+              <option value="card">Card</option>
+              <option value="split">Split</option>
+            </select>
+          </div>
+
+          <div>
+            <label className="mb-1 block font-medium">Receipt #</label>
+            <input
+              type="text"
+              value={receiptNumber}
+              onChange={(e) => setReceiptNumber(e.target.value)}
+              className="rounded border px-2 py-1"
+            />
+          </div>
+
+          <div>
+            <label className="mb-1 block font-medium">Sort</label>
+            <select
+              value={sort}
+              onChange={(e) => setSort(e.target.value)}
+              className="rounded border px-2 py-1"
+            >
+              <option value="-created_at">Newest first</option>
+              <option value="created_at">Oldest first</option>
+              <option value="-total_amount">Highest total</option>
+              <option value="total_amount">Lowest total</option>
+            </select>
+          </div>
+
+          <span className="text-xs text-gray-600">
+            {totalCount} sale{totalCount === 1 ? "" : "s"}
+          </span>
+        </div>
+
         {error && <p className="text-red-600">{error}</p>}
 
         {!loading && !error && sales.length === 0 && (
@@ -39,8 +135,9 @@ export default function SalesListPage() {
             <table className="min-w-full text-sm">
               <thead className="bg-gray-50">
                 <tr>
-                  <th className="px-3 py-2 text-left">ID</th>
+                  <th className="px-3 py-2 text-left">Receipt</th>
                   <th className="px-3 py-2 text-left">Date</th>
+                  <th className="px-3 py-2 text-left">Cashier</th>
                   <th className="px-3 py-2 text-left">Total</th>
                   <th className="px-3 py-2 text-left">Payment</th>
                   <th className="px-3 py-2"></th>
@@ -49,10 +146,18 @@ export default function SalesListPage() {
               <tbody>
                 {sales.map((sale) => (
                   <tr key={sale.id} className="border-t">
-                    <td className="px-3 py-2">#{sale.id}</td>
+                    <td className="px-3 py-2">
+                      {sale.receipt_number || `#${sale.id}`}
+                      {sale.kind === "exchange" && (
+                        <span className="ml-1 text-xs text-gray-500">
+                          (exchange)
+                        </span>
+                      )}
+                    </td>
                     <td className="px-3 py-2">
                       {new Date(sale.created_at).toLocaleString()}
                     </td>
+                    <td className="px-3 py-2">{sale.cashier_name || "-"}</td>
                     <td className="px-3 py-2">{sale.total_amount.toFixed(2)}</td>
                     <td className="px-3 py-2 capitalize">{sale.payment_method}</td>
                     <td className="px-3 py-2">
@@ -69,6 +174,17 @@ export default function SalesListPage() {
             </table>
           </div>
         )}
+
+        {loading && <p>Loading...</p>}
+
+        {!loading && nextCursor && (
+          <button
+            onClick={() => loadPage(nextCursor)}
+            className="rounded border bg-white px-3 py-1 text-sm hover:bg-gray-50"
+          >
+            Load more
+          </button>
+        )}
       </div>
     </ProtectedPage>
   );
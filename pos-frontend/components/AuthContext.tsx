@@ -14,7 +14,7 @@ import type { User, LoginResponse } from "@/lib/types";
 type AuthContextValue = {
   user: User | null;
   loading: boolean;
-  login: (email: string, password: string) => Promise<void>;
+  login: (email: string, password: string, terminalId?: string) => Promise<void>;
   logout: () => void;
 };
 
@@ -52,14 +52,18 @@ export function AuthProvider({ children }: { children: ReactNode }) {
       });
   }, []);
 
-  const login = async (email: string, password: string) => {
+  // The session is bound to the till it signs in on; sales and shifts are
+  // booked against that terminal by the backend.
+  const login = async (email: string, password: string, terminalId = "") => {
+    const terminal_id = terminalId.trim();
     const data = await apiFetch<LoginResponse>("/api/auth/login", {
       method: "POST",
-      body: JSON.stringify({ email, password }),
+      body: JSON.stringify({ email, password, terminal_id }),
     });
 
     if (typeof window !== "undefined") {
       window.localStorage.setItem("authToken", data.token);
+      window.localStorage.setItem("terminalId", terminal_id);
     }
     setUser(data.user);
   };
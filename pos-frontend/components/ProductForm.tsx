@@ -10,6 +10,7 @@ type ProductFormProps = {
     name: string;
     sku: string;
     price: number;
+    cost: number | null;
     stock: number;
   }) => Promise<void>;
   submitLabel: string;
@@ -28,6 +29,10 @@ export function ProductForm({
     initialProduct ? initialProduct.price : ("" as any)
   );
 
+  // cost is optional; left blank it is unknown and reports leave the
+  // product's sales out of margins
+  const [cost, setCost] = useState(initialProduct?.cost ?? ("" as any));
+
   /** 👇 CHANGE #2 – stock starts empty unless editing */
   const [stock, setStock] = useState(
     initialProduct ? initialProduct.stock : ("" as any)
@@ -45,6 +50,7 @@ export function ProductForm({
         name: name.trim(),
         sku: sku.trim(),
         price: Number(price),
+        cost: cost === "" ? null : Number(cost),
         stock: Number(stock),
       });
     } catch (err: any) {
@@ -91,6 +97,17 @@ export function ProductForm({
             required
           />
         </div>
+        <div>
+          <label className="mb-1 block text-sm font-medium">Cost</label>
+          <input
+            type="number"
+            min={0}
+            step="0.01"
+            className="w-full rounded border px-3 py-2 text-sm"
+            value={cost}
+            onChange={(e) => setCost(e.target.value)}
+          />
+        </div>
         <div>
           <label className="mb-1 block text-sm font-medium">Stock</label>
           <input
@@ -13,9 +13,132 @@ export type Product = {
   name: string;
   sku: string;
   price: number;
+  cost: number | null; // unit cost to the store, null when unknown
   stock: number;
+  allow_negative_stock?: boolean | null;
+  plu?: string;
+  category_id?: number | null;
+  parent_id?: number | null;
+  own_price?: boolean;
+  unit: string;
+  quantity_decimals: number;
+  archived_at?: string; // archived products are hidden from the POS
+  version: number; // send back as If-Match: "<version>" when editing
+  units?: ProductUnit[];
   created_at: string;
   updated_at: string;
+  barcodes?: Barcode[];
+  options?: Record<string, string>;
+  option_types?: ProductOption[];
+  variants?: Product[];
+  components?: KitComponent[]; // set on kits; stock is then the kits they make up
+};
+
+export type KitComponent = {
+  product_id: number;
+  product_name?: string;
+  quantity: number; // per kit
+};
+
+export type Unit = {
+  code: string;
+  name: string;
+  decimals: number;
+};
+
+// A purchase unit, e.g. a case holding `factor` of the product's unit
+export type ProductUnit = {
+  id: number;
+  product_id: number;
+  name: string;
+  factor: number;
+  created_at: string;
+};
+
+export type ProductOption = {
+  id: number;
+  name: string;
+  values: { id: number; value: string; code: string }[];
+};
+
+export type VariantMatrix = {
+  created: Product[];
+  variants: Product[];
+};
+
+export type Barcode = {
+  id: number;
+  product_id: number;
+  code: string;
+  symbology: "ean13" | "ean8" | "upca" | "code128";
+  pack_quantity: number;
+  created_at: string;
+};
+
+export type BarcodeRule = {
+  id: number;
+  prefix: string;
+  plu_length: number;
+  value_kind: "weight" | "price";
+  value_length: number;
+  value_decimals: number;
+  created_at: string;
+};
+
+export type BarcodeLookup = {
+  product: Product;
+  barcode?: Barcode;
+  rule?: BarcodeRule;
+  code: string;
+  pack_quantity: number;
+  weight?: number; // kg from a scale label or GS1 code
+  price?: number; // price printed on the label
+  lot?: string; // GS1 batch/lot
+  serial?: string;
+  expiry_date?: string; // YYYY-MM-DD
+  expired?: boolean;
+};
+
+// Outcome of POST /products/import; with dry_run nothing is written
+export type ProductImportResult = {
+  dry_run: boolean;
+  applied: boolean;
+  created: number;
+  updated: number;
+  unchanged: number;
+  invalid: number;
+  rows: {
+    line: number;
+    sku: string;
+    action?: "create" | "update" | "unchanged";
+    product_id?: number;
+    changes?: { field: string; from: string | null; to: string }[];
+    errors?: string[];
+  }[];
+};
+
+export type PriceChange = {
+  id: number;
+  product_id: number;
+  product_name?: string;
+  price: number;
+  effective_at: string;
+  status: "scheduled" | "applied" | "cancelled";
+  created_at: string;
+  applied_at?: string;
+};
+
+export type PriceHistory = {
+  product_id: number;
+  price: number;
+  history: { price: number; effective_at: string }[]; // newest first
+  scheduled: PriceChange[]; // soonest first
+};
+
+export type ProductPage = {
+  items: Product[];
+  next_cursor?: string;
+  total_count: number;
 };
 
 export type SaleItem = {
@@ -26,18 +149,42 @@ export type SaleItem = {
   quantity: number;
   unit_price: number;
   line_total: number;
+  unit_cost: number | null; // as of the sale, null when unknown
+  barcode?: string;
+  weight?: number;
+  lot?: string;
+  expiry_date?: string;
+  components?: SaleItemComponent[]; // kit lines
   created_at: string;
 };
 
+// What a kit line took from one component and the revenue allocated to it
+export type SaleItemComponent = {
+  product_id: number;
+  product_name?: string;
+  quantity: number;
+  revenue: number;
+  unit_cost: number | null;
+};
+
 export type Sale = {
   id: number;
+  receipt_number?: string;
+  kind?: "sale" | "exchange";
   total_amount: number;
   paid_amount: number;
   payment_method: string;
+  cashier_name?: string;
   created_at: string;
   items?: SaleItem[];
 };
 
+export type SalePage = {
+  items: Sale[];
+  next_cursor?: string;
+  total_count: number;
+};
+
 export type LoginResponse = {
   token: string;
   user: User;
@@ -56,9 +203,46 @@ export type DailySalesRow = {
   total_revenue: number;
 };
 
+export type Category = {
+  id: number;
+  name: string;
+  parent_id: number | null;
+  sort_order: number;
+  active: boolean;
+  created_at: string;
+  updated_at: string;
+  children?: Category[];
+};
+
+export type CategorySalesRow = {
+  category_id: number;
+  category_name: string;
+  parent_id: number | null;
+  depth: number;
+  quantity: number;
+  revenue: number;
+  own_revenue: number;
+};
+
+// Gross profit for one product, category, day or cashier. Lines sold
+// without a known cost are left out of cost and gross_profit and counted
+// in uncosted_revenue; margin_percent is null without costed revenue
+export type GrossProfitRow = {
+  id?: number;
+  name?: string;
+  date?: string;
+  quantity: number;
+  revenue: number;
+  cost: number;
+  gross_profit: number;
+  margin_percent: number | null;
+  uncosted_revenue: number;
+};
+
 export type TopProductRow = {
   product_id: number;
   product_name: string;
+  parent_id?: number;
   quantity: number;
   revenue: number;
 };